@@ -0,0 +1,134 @@
+// Package audit records an append-only trail of state changing broker
+// operations and who triggered them.
+package audit
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// OutcomeSuccess marks operations that succeeded
+	OutcomeSuccess string = "success"
+	// OutcomeAccepted marks asynchronous operations that were started
+	OutcomeAccepted string = "accepted"
+	// OutcomeFailure marks operations that failed
+	OutcomeFailure string = "failure"
+
+	defaultQueryLimit int = 100
+)
+
+// ErrNotQueryable is returned if no configured sink can be queried
+var ErrNotQueryable = errors.New("no queryable audit sink configured")
+
+// Event is one audit record
+type Event struct {
+	Time       time.Time `json:"time"`
+	RequestID  string    `json:"request_id,omitempty"`
+	Principal  string    `json:"principal,omitempty"`
+	Platform   string    `json:"platform,omitempty"`
+	UserID     string    `json:"user_id,omitempty"`
+	UserName   string    `json:"user_name,omitempty"`
+	Operation  string    `json:"operation"`
+	InstanceID string    `json:"instance_id,omitempty"`
+	BindingID  string    `json:"binding_id,omitempty"`
+	Foundation string    `json:"foundation,omitempty"`
+	Outcome    string    `json:"outcome"`
+	Status     int       `json:"status,omitempty"`
+}
+
+// Query filters audit events. Empty fields match all events.
+type Query struct {
+	Operation  string
+	InstanceID string
+	Foundation string
+	Platform   string
+	UserID     string
+	Since      time.Time
+	Until      time.Time
+	Limit      int
+}
+
+// Sink writes audit events
+type Sink interface {
+	Write(event Event) error
+}
+
+// Reader is implemented by sinks that can be queried
+type Reader interface {
+	Query(query Query) ([]Event, error)
+}
+
+// Auditor writes events to all its sinks
+type Auditor struct {
+	sinks []Sink
+}
+
+// New creates an auditor writing to sinks
+func New(sinks ...Sink) *Auditor {
+	return &Auditor{sinks: sinks}
+}
+
+// Record writes event to all sinks. Failing sinks are logged and do not
+// stop the other sinks.
+func (a *Auditor) Record(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+
+	for _, sink := range a.sinks {
+		if err := sink.Write(event); err != nil {
+			log.WithField("operation", event.Operation).Errorf("Error writing audit event: %v", err)
+		}
+	}
+}
+
+// Query returns matching events, oldest first, from the first sink that
+// can be queried
+func (a *Auditor) Query(query Query) ([]Event, error) {
+	for _, sink := range a.sinks {
+		if reader, ok := sink.(Reader); ok {
+			return reader.Query(query)
+		}
+	}
+	return nil, ErrNotQueryable
+}
+
+// Close closes all sinks that hold resources like open files
+func (a *Auditor) Close() error {
+	var result error
+	for _, sink := range a.sinks {
+		if closer, ok := sink.(io.Closer); ok {
+			if err := closer.Close(); err != nil && result == nil {
+				result = err
+			}
+		}
+	}
+	return result
+}
+
+// Matches checks whether event is selected by query, ignoring Limit
+func (q Query) Matches(event Event) bool {
+	return (q.Operation == "" || q.Operation == event.Operation) &&
+		(q.InstanceID == "" || q.InstanceID == event.InstanceID) &&
+		(q.Foundation == "" || q.Foundation == event.Foundation) &&
+		(q.Platform == "" || q.Platform == event.Platform) &&
+		(q.UserID == "" || q.UserID == event.UserID) &&
+		(q.Since.IsZero() || !event.Time.Before(q.Since)) &&
+		(q.Until.IsZero() || event.Time.Before(q.Until))
+}
+
+// limit returns the last query.Limit events
+func (q Query) limit(events []Event) []Event {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultQueryLimit
+	}
+	if len(events) > limit {
+		return events[len(events)-limit:]
+	}
+	return events
+}
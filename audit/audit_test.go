@@ -0,0 +1,71 @@
+package audit
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type failingSink struct{}
+
+func (failingSink) Write(event Event) error {
+	return errors.New("broken")
+}
+
+func TestRecordAndQuery(t *testing.T) {
+	memory := NewMemorySink(10)
+	auditor := New(failingSink{}, memory)
+
+	auditor.Record(Event{Operation: "provision", InstanceID: "a", Platform: "cloudfoundry", Outcome: OutcomeSuccess})
+	auditor.Record(Event{Operation: "provision", InstanceID: "b", Platform: "kubernetes", Outcome: OutcomeFailure})
+	auditor.Record(Event{Operation: "deprovision", InstanceID: "a", Platform: "cloudfoundry", Outcome: OutcomeSuccess})
+
+	events, err := auditor.Query(Query{InstanceID: "a"})
+	assert.Nil(t, err)
+	assert.Len(t, events, 2)
+	assert.Equal(t, "provision", events[0].Operation)
+	assert.False(t, events[0].Time.IsZero())
+
+	events, _ = auditor.Query(Query{Platform: "kubernetes"})
+	assert.Len(t, events, 1)
+
+	events, _ = auditor.Query(Query{Limit: 1})
+	assert.Len(t, events, 1)
+	assert.Equal(t, "deprovision", events[0].Operation)
+}
+
+func TestQueryNotQueryable(t *testing.T) {
+	_, err := New(failingSink{}).Query(Query{})
+	assert.Equal(t, ErrNotQueryable, err)
+}
+
+func TestQueryTimeRange(t *testing.T) {
+	now := time.Now()
+	query := Query{Since: now.Add(-time.Minute), Until: now}
+
+	assert.True(t, query.Matches(Event{Time: now.Add(-time.Second)}))
+	assert.False(t, query.Matches(Event{Time: now.Add(-time.Hour)}))
+	assert.False(t, query.Matches(Event{Time: now}))
+}
+
+func TestMemorySinkDropsOldest(t *testing.T) {
+	memory := NewMemorySink(2)
+	memory.Write(Event{Operation: "1"})
+	memory.Write(Event{Operation: "2"})
+	memory.Write(Event{Operation: "3"})
+
+	events, _ := memory.Query(Query{})
+	assert.Len(t, events, 2)
+	assert.Equal(t, "2", events[0].Operation)
+}
+
+func TestCloseClosesFileSinks(t *testing.T) {
+	file, err := NewFileSink(t.TempDir() + "/audit.log")
+	assert.NoError(t, err)
+
+	auditor := New(NewMemorySink(10), file)
+	assert.NoError(t, auditor.Close())
+	assert.Error(t, file.Write(Event{Operation: "provision"}))
+}
@@ -0,0 +1,214 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// MemorySink keeps the most recent events in memory
+type MemorySink struct {
+	mutex  sync.Mutex
+	size   int
+	events []Event
+}
+
+// NewMemorySink creates a sink keeping up to size events
+func NewMemorySink(size int) *MemorySink {
+	return &MemorySink{size: size}
+}
+
+// Write appends event and drops the oldest event if the sink is full
+func (m *MemorySink) Write(event Event) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.events = append(m.events, event)
+	if len(m.events) > m.size {
+		m.events = m.events[len(m.events)-m.size:]
+	}
+	return nil
+}
+
+// Query returns matching events
+func (m *MemorySink) Query(query Query) ([]Event, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	result := []Event{}
+	for _, event := range m.events {
+		if query.Matches(event) {
+			result = append(result, event)
+		}
+	}
+	return query.limit(result), nil
+}
+
+// FileSink appends events as JSON lines to a file
+type FileSink struct {
+	mutex sync.Mutex
+	path  string
+	file  *os.File
+}
+
+// NewFileSink opens path for appending, the file is created if missing
+func NewFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{path: path, file: file}, nil
+}
+
+// Write appends event and syncs the file to disk
+func (f *FileSink) Write(event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if _, err := f.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return f.file.Sync()
+}
+
+// Query scans the file for matching events
+func (f *FileSink) Query(query Query) ([]Event, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	file, err := os.Open(f.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	result := []Event{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return nil, fmt.Errorf("corrupt audit file %v: %v", f.path, err)
+		}
+		if query.Matches(event) {
+			result = append(result, event)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return query.limit(result), nil
+}
+
+// Close closes the file
+func (f *FileSink) Close() error {
+	return f.file.Close()
+}
+
+const (
+	// syslog facility 13 is log audit
+	syslogFacilityAudit int = 13
+	syslogSeverityInfo  int = 6
+	syslogSeverityWarn  int = 4
+)
+
+// SyslogSink writes events as RFC 5424 syslog messages with the event as
+// JSON message. With octet counting each message is prefixed by its length
+// as required for syslog over TCP (RFC 6587), otherwise messages are
+// separated by newlines.
+type SyslogSink struct {
+	mutex         sync.Mutex
+	writer        io.Writer
+	hostname      string
+	appName       string
+	octetCounting bool
+}
+
+// NewSyslogSink creates a sink writing to writer
+func NewSyslogSink(writer io.Writer, appName string, octetCounting bool) *SyslogSink {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+
+	return &SyslogSink{
+		writer:        writer,
+		hostname:      hostname,
+		appName:       appName,
+		octetCounting: octetCounting,
+	}
+}
+
+// Write writes event as syslog message
+func (s *SyslogSink) Write(event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	severity := syslogSeverityInfo
+	if event.Outcome == OutcomeFailure {
+		severity = syslogSeverityWarn
+	}
+
+	message := fmt.Sprintf("<%d>1 %v %v %v %d %v - %s",
+		syslogFacilityAudit*8+severity,
+		event.Time.UTC().Format(time.RFC3339Nano),
+		s.hostname,
+		s.appName,
+		os.Getpid(),
+		event.Operation,
+		data)
+
+	if s.octetCounting {
+		message = fmt.Sprintf("%d %v", len(message), message)
+	} else {
+		message += "\n"
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	_, err = io.WriteString(s.writer, message)
+	return err
+}
+
+// DialSyslogSink creates a syslog sink sending to a syslog server via udp
+// or tcp. The connection is established on the first event and again after
+// a failed write.
+func DialSyslogSink(network string, address string, appName string) *SyslogSink {
+	return NewSyslogSink(&dialWriter{network: network, address: address}, appName, network == "tcp")
+}
+
+// dialWriter is not safe for concurrent use, SyslogSink serializes writes
+type dialWriter struct {
+	network string
+	address string
+	conn    net.Conn
+}
+
+func (d *dialWriter) Write(data []byte) (int, error) {
+	if d.conn == nil {
+		conn, err := net.DialTimeout(d.network, d.address, 5*time.Second)
+		if err != nil {
+			return 0, err
+		}
+		d.conn = conn
+	}
+
+	n, err := d.conn.Write(data)
+	if err != nil {
+		d.conn.Close()
+		d.conn = nil
+	}
+	return n, err
+}
@@ -0,0 +1,94 @@
+package audit
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileSink(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "audit")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+
+	sink, err := NewFileSink(path)
+	assert.Nil(t, err)
+	assert.Nil(t, sink.Write(Event{Operation: "provision", InstanceID: "a", Outcome: OutcomeSuccess}))
+	assert.Nil(t, sink.Close())
+
+	// reopening appends to the existing trail
+	sink, err = NewFileSink(path)
+	assert.Nil(t, err)
+	defer sink.Close()
+	assert.Nil(t, sink.Write(Event{Operation: "bind", InstanceID: "a", BindingID: "x", Outcome: OutcomeSuccess}))
+
+	events, err := sink.Query(Query{InstanceID: "a"})
+	assert.Nil(t, err)
+	assert.Len(t, events, 2)
+	assert.Equal(t, "x", events[1].BindingID)
+
+	data, _ := ioutil.ReadFile(path)
+	assert.Equal(t, 2, strings.Count(string(data), "\n"))
+}
+
+func TestSyslogSink(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewSyslogSink(&buf, "cf-api-broker", false)
+
+	event := Event{
+		Time:       time.Date(2020, 12, 20, 13, 11, 22, 0, time.UTC),
+		Operation:  "provision",
+		InstanceID: "a",
+		Outcome:    OutcomeFailure,
+	}
+	assert.Nil(t, sink.Write(event))
+
+	line := buf.String()
+	assert.True(t, strings.HasPrefix(line, "<108>1 2020-12-20T13:11:22Z "))
+	assert.Contains(t, line, " cf-api-broker ")
+	assert.Contains(t, line, " provision - {")
+	assert.Contains(t, line, `"instance_id":"a"`)
+	assert.True(t, strings.HasSuffix(line, "}\n"))
+}
+
+func TestSyslogSinkOctetCounting(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewSyslogSink(&buf, "cf-api-broker", true)
+
+	assert.Nil(t, sink.Write(Event{Operation: "bind", Outcome: OutcomeSuccess}))
+
+	parts := strings.SplitN(buf.String(), " ", 2)
+	assert.Equal(t, strconv.Itoa(len(parts[1])), parts[0])
+	assert.True(t, strings.HasPrefix(parts[1], "<110>1 "))
+}
+
+func TestDialSyslogSink(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+
+	received := make(chan string)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		data := make([]byte, 4096)
+		n, _ := conn.Read(data)
+		received <- string(data[:n])
+	}()
+
+	sink := DialSyslogSink("tcp", listener.Addr().String(), "cf-api-broker")
+	assert.Nil(t, sink.Write(Event{Operation: "unbind", Outcome: OutcomeSuccess}))
+
+	assert.Contains(t, <-received, "unbind - {")
+}
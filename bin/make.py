@@ -2,6 +2,7 @@
 
 import os
 import argparse
+from datetime import datetime, timezone
 
 def test(verbose):
     print ("-- vet & test broker")
@@ -63,7 +64,8 @@ def ldflags():
 
 
     # TDOD: version (consider goreleaser) 
-    return F"-ldflags=\"-X 'main.Version=dev' -X 'main.Commit={commit}'\""
+    buildTime = datetime.now(timezone.utc).strftime("%Y-%m-%dT%H:%M:%SZ")
+    return F"-ldflags=\"-X 'main.Version=dev' -X 'main.Commit={commit.strip()}' -X 'main.BuildTime={buildTime}'\""
 
 def main():
   parser = argparse.ArgumentParser(description="Make tool for cloud foundry api broker", epilog="(c) 2020 by KLÄFF-Soft)")
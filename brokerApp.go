@@ -1,19 +1,23 @@
 package main
 
 import (
-	"log"
-	"net/http"
+	"context"
+	"net"
+	"os/signal"
+	"syscall"
 
 	"flag"
 	"os"
 
+	log "github.com/sirupsen/logrus"
 	"github.com/sklevenz/cf-api-broker/config"
 	"github.com/sklevenz/cf-api-broker/server"
+	"github.com/sklevenz/cf-api-broker/tracing"
 )
 
 const (
-	staticDir string = "./static"
-	defaultPort             = "5000"
+	staticDir   string = "./static"
+	defaultPort        = "5000"
 )
 
 var (
@@ -21,6 +25,8 @@ var (
 	Version string = "n/a"
 	// Commit set by go build via -ldflags "'-X main.Commit=123'"
 	Commit string = "n/a"
+	// BuildTime set by go build via -ldflags "'-X main.BuildTime=2020-06-01T12:00:00Z'"
+	BuildTime string = "n/a"
 
 	// ConfigPath keeps path to configuration file
 	configPath string
@@ -39,21 +45,76 @@ func main() {
 		port = defaultPort
 	}
 
-
-	log.Printf("start application on port %v", port)
-	log.Printf("version %v", Version)
-	log.Printf("commit %v", Commit)
+	log.Infof("start application on port %v", port)
+	log.Infof("version %v", Version)
+	log.Infof("commit %v", Commit)
 
 	if err := config.Read(configPath); err != nil {
 		log.Fatalf("could not read configuration %v", err)
 	}
 
-	server.SetBuildVersion(Version, Commit)
+	if err := server.ConfigureLogging(); err != nil {
+		log.Fatalf("could not configure logging: %v", err)
+	}
+
+	if tracingConfig := config.Get().Tracing; tracingConfig.Endpoint != "" {
+		shutdown, err := tracing.Setup(context.Background(), tracing.Options{
+			Endpoint:       tracingConfig.Endpoint,
+			Insecure:       tracingConfig.Insecure,
+			SampleRatio:    tracingConfig.SampleRatio,
+			ServiceVersion: Version,
+		})
+		if err != nil {
+			log.Fatalf("could not configure tracing: %v", err)
+		}
+		server.OnShutdown("tracing", shutdown)
+		log.Infof("export traces to %v", tracingConfig.Endpoint)
+	}
+
+	if err := server.ConfigureAudit(); err != nil {
+		log.Fatalf("could not configure audit: %v", err)
+	}
+	server.OnShutdown("audit", server.CloseAudit)
+
+	if err := server.ConfigureStore(); err != nil {
+		log.Fatalf("could not configure store: %v", err)
+	}
+	if err := server.RecoverMigrations(context.Background()); err != nil {
+		log.Fatalf("could not recover migrations: %v", err)
+	}
+	if err := server.CheckFoundationReferences(context.Background()); err != nil {
+		log.Fatalf("could not configure foundations: %v", err)
+	}
+	server.OnShutdown("migrations", server.StopMigrations)
+	server.OnShutdown("health", server.StartHealthChecks())
+	server.OnShutdown("reaper", server.StartBindingReaper())
+
+	server.SetBuildVersion(Version, Commit, BuildTime)
 	brokerServer := server.NewRouter(staticDir)
 
-	log.Printf("call server: http://localhost:%v", port)
+	tlsConfig, err := server.NewTLSConfig()
+	if err != nil {
+		log.Fatalf("could not configure TLS: %v", err)
+	}
 
-	if err := http.ListenAndServe(":"+port, brokerServer); err != nil {
+	listener, err := net.Listen("tcp", ":"+port)
+	if err != nil {
 		log.Fatalf("could not listen on port %v: %v", port, err)
 	}
+
+	if tlsConfig != nil {
+		log.Infof("call server: https://localhost:%v", port)
+	} else {
+		log.Infof("call server: http://localhost:%v", port)
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
+
+	httpServer := server.NewHTTPServer(":"+port, brokerServer, tlsConfig)
+	if err := server.Serve(httpServer, listener, stop); err != nil {
+		log.Fatalf("server stopped with error: %v", err)
+	}
+
+	log.Info("server stopped")
 }
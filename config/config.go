@@ -1,36 +1,237 @@
 package config
 
 import (
+	"fmt"
 	"hash/fnv"
 	"io/ioutil"
-	"log"
 	"os"
+	"regexp"
+	"strings"
+	"text/template"
 	"time"
 
+	log "github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v2"
 )
 
 const (
 	// AuthTypeBasic basic authentification
 	AuthTypeBasic string = "basic"
+	// AuthTypeOAuth2 JWT bearer token authentification
+	AuthTypeOAuth2 string = "oauth2"
+	// AuthTypeMTLS client certificate authentification, requires TLS
+	AuthTypeMTLS string = "mtls"
+
+	// StoreTypeMemory keeps instances in memory only
+	StoreTypeMemory string = "memory"
+	// StoreTypeFile persists instances to a JSON file
+	StoreTypeFile string = "file"
 )
 
-// Configuration struct for server configuration
+// Credential is a basic auth user accepted by the broker. Password is either
+// plain text or a bcrypt hash. NotBefore and NotAfter are optional and limit
+// the time window the credential is valid, which allows credential rotation.
+type Credential struct {
+	UserName  string    `yaml:"username"`
+	Password  string    `yaml:"password"`
+	NotBefore time.Time `yaml:"notBefore"`
+	NotAfter  time.Time `yaml:"notAfter"`
+}
+
+// ValidAt checks whether t lies in the validity window of the credential
+func (c Credential) ValidAt(t time.Time) bool {
+	if !c.NotBefore.IsZero() && t.Before(c.NotBefore) {
+		return false
+	}
+	if !c.NotAfter.IsZero() && t.After(c.NotAfter) {
+		return false
+	}
+	return true
+}
+
+// Auth configures how a group of routes authenticates requests
+type Auth struct {
+	AuthType  string `yaml:"authtype"`
+	BasicAuth struct {
+		UserName    string       `yaml:"username"`
+		Password    string       `yaml:"password"`
+		Credentials []Credential `yaml:"credentials"`
+	} `yaml:"basicauth"`
+	OAuth2 struct {
+		JWKSURL            string        `yaml:"jwksURL"`
+		Keys               []string      `yaml:"keys"`
+		Issuer             string        `yaml:"issuer"`
+		Audience           string        `yaml:"audience"`
+		Scopes             []string      `yaml:"scopes"`
+		KeyRefreshInterval time.Duration `yaml:"keyRefreshInterval"`
+	} `yaml:"oauth2"`
+	MTLS struct {
+		Subjects []string `yaml:"subjects"`
+		SANs     []string `yaml:"sans"`
+	} `yaml:"mtls"`
+}
+
+// Credentials returns all basic auth credentials, the single
+// username/password pair first followed by the credentials list
+func (a Auth) Credentials() []Credential {
+	credentials := []Credential{}
+
+	if a.BasicAuth.UserName != "" {
+		credentials = append(credentials, Credential{UserName: a.BasicAuth.UserName, Password: a.BasicAuth.Password})
+	}
+
+	return append(credentials, a.BasicAuth.Credentials...)
+}
+
+// TokenBucket configures a rate limit of Rate requests per second with bursts
+// of up to Burst requests. A rate of zero disables the limit.
+type TokenBucket struct {
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
+}
+
+// RateLimit configures rate limits of a route group per client IP and per
+// authenticated identity
+type RateLimit struct {
+	IP       TokenBucket `yaml:"ip"`
+	Identity TokenBucket `yaml:"identity"`
+}
+
+// CloudFoundry is a foundation instances are placed on. A cordoned
+// foundation receives no new instances but keeps serving existing ones.
+type CloudFoundry struct {
+	APIURL   string   `yaml:"apiURL"`
+	UAAURL   string   `yaml:"uaaURL"`
+	UserName string   `yaml:"username"`
+	Password string   `yaml:"password"`
+	Labels   []string `yaml:"labels"`
+	Region   string   `yaml:"region"`
+	Cordoned bool     `yaml:"cordoned"`
+}
+
+// InstanceMetadata configures the labels and attributes returned with the
+// metadata of instances. Values are text templates rendered with the
+// placement of the instance, values rendering empty are left out. Without
+// templates instances have no metadata.
+type InstanceMetadata struct {
+	Labels     map[string]string `yaml:"labels"`
+	Attributes map[string]string `yaml:"attributes"`
+}
+
+// Dashboard configures the dashboards of instances. URL is the external URL
+// of the broker, dashboard links are signed with SigningKey and expire after
+// TokenTTL. Without URL or signing key instances have no dashboard. The
+// signing key must be a secret of the deployment, anyone knowing it can open
+// the dashboard of every instance.
+type Dashboard struct {
+	URL        string        `yaml:"url"`
+	SigningKey string        `yaml:"signingKey"`
+	TokenTTL   time.Duration `yaml:"tokenTTL"`
+}
+
+// MetadataFuncs are the functions available in instance metadata templates
+var MetadataFuncs = template.FuncMap{"join": strings.Join}
+
+// Plan configures a service plan of the catalog. Binding credentials expire
+// CredentialTTL after they are issued and should be renewed RenewBefore
+// their expiry. Without a TTL credentials do not expire.
+//
+// Bindings may request one of Roles or a subset of Scopes with their
+// parameters and get DefaultRole or DefaultScopes otherwise.
+//
+// MaintenanceInfo is announced in the catalog, its version is a semantic
+// version. Instances are upgraded when the platform requests a new version.
+type Plan struct {
+	CredentialTTL   time.Duration   `yaml:"credentialTTL"`
+	RenewBefore     time.Duration   `yaml:"renewBefore"`
+	Roles           []string        `yaml:"roles"`
+	Scopes          []string        `yaml:"scopes"`
+	DefaultRole     string          `yaml:"defaultRole"`
+	DefaultScopes   []string        `yaml:"defaultScopes"`
+	MaintenanceInfo MaintenanceInfo `yaml:"maintenanceInfo"`
+}
+
+// MaintenanceInfo is the maintenance version of a plan
+type MaintenanceInfo struct {
+	Version     string `yaml:"version"`
+	Description string `yaml:"description"`
+}
+
+// semVer matches semantic versions as defined by https://semver.org
+var semVer = regexp.MustCompile(`^(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)(?:-((?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*)(?:\.(?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*))*))?(?:\+([0-9a-zA-Z-]+(?:\.[0-9a-zA-Z-]+)*))?$`)
+
+// Configuration struct for server configuration. The inlined Auth
+// authenticates platforms calling the /v2 API, Admin authenticates
+// operational endpoints listed in AdminRoutes. Routes listed in PublicRoutes
+// require no authentication. Routes are referenced by their mux route name.
 type Configuration struct {
 	Server struct {
-		AuthType  string `yaml:"authtype"`
-		BasicAuth struct {
-			UserName string `yaml:"username"`
-			Password string `yaml:"password"`
-		} `yaml:"basicauth"`
+		Auth         `yaml:",inline"`
+		Admin        Auth     `yaml:"admin"`
+		PublicRoutes []string `yaml:"publicRoutes"`
+		AdminRoutes  []string `yaml:"adminRoutes"`
+		RateLimits   struct {
+			// TrustForwardedFor takes client IPs from X-Forwarded-For. Enable
+			// it only behind a trusted proxy like the Cloud Foundry router,
+			// otherwise clients choose the IP they are limited by.
+			TrustForwardedFor bool      `yaml:"trustForwardedFor"`
+			Public            RateLimit `yaml:"public"`
+			Platform          RateLimit `yaml:"platform"`
+			Admin             RateLimit `yaml:"admin"`
+			AuthFailures      struct {
+				Threshold  int           `yaml:"threshold"`
+				Lockout    time.Duration `yaml:"lockout"`
+				MaxLockout time.Duration `yaml:"maxLockout"`
+			} `yaml:"authFailures"`
+		} `yaml:"rateLimits"`
+		Timeouts struct {
+			ReadHeader          time.Duration `yaml:"readHeader"`
+			Read                time.Duration `yaml:"read"`
+			Write               time.Duration `yaml:"write"`
+			Idle                time.Duration `yaml:"idle"`
+			ShutdownGracePeriod time.Duration `yaml:"shutdownGracePeriod"`
+			ShutdownHooks       time.Duration `yaml:"shutdownHooks"`
+		} `yaml:"timeouts"`
+		TLS struct {
+			CertFile     string `yaml:"certFile"`
+			KeyFile      string `yaml:"keyFile"`
+			ClientCAFile string `yaml:"clientCAFile"`
+		} `yaml:"tls"`
 	} `yaml:"server"`
-	CloudFoundries map[string]struct {
-		APIURL   string   `yaml:"apiURL"`
-		UAAURL   string   `yaml:"uaaURL"`
-		UserName string   `yaml:"username"`
-		Password string   `yaml:"password"`
-		Labels   []string `yaml:"labels"`
-	} `yaml:"cloudfoundries"`
+	Audit struct {
+		File   string `yaml:"file"`
+		Syslog struct {
+			Network string `yaml:"network"`
+			Address string `yaml:"address"`
+		} `yaml:"syslog"`
+	} `yaml:"audit"`
+	Tracing struct {
+		Endpoint    string  `yaml:"endpoint"`
+		Insecure    bool    `yaml:"insecure"`
+		SampleRatio float64 `yaml:"sampleRatio"`
+	} `yaml:"tracing"`
+	Log struct {
+		Level  string `yaml:"level"`
+		Format string `yaml:"format"`
+	} `yaml:"log"`
+	Store struct {
+		Type string `yaml:"type"`
+		Path string `yaml:"path"`
+	} `yaml:"store"`
+	Health struct {
+		Interval         time.Duration `yaml:"interval"`
+		Timeout          time.Duration `yaml:"timeout"`
+		Window           int           `yaml:"window"`
+		DegradedBelow    float64       `yaml:"degradedBelow"`
+		UnavailableBelow float64       `yaml:"unavailableBelow"`
+	} `yaml:"health"`
+	Reaper struct {
+		Interval time.Duration `yaml:"interval"`
+	} `yaml:"reaper"`
+	Dashboard        Dashboard               `yaml:"dashboard"`
+	InstanceMetadata InstanceMetadata        `yaml:"instanceMetadata"`
+	Plans            map[string]Plan         `yaml:"plans"`
+	CloudFoundries   map[string]CloudFoundry `yaml:"cloudfoundries"`
 }
 
 var (
@@ -42,29 +243,62 @@ var (
 // Read cloud foundry data structure from YAML file.
 func Read(configPath string) error {
 
-	log.Printf("Reading file %v", configPath)
+	log.Infof("Reading file %v", configPath)
 	dat, err := ioutil.ReadFile(configPath)
 
 	if err != nil {
-		log.Printf("ERROR while reading config file: %v", err)
+		log.Errorf("Error while reading config file: %v", err)
 		return err
 	}
 
 	file, err := os.Stat(configPath)
 	if err != nil {
-		log.Printf("Error while reading last modified date: %v", err)
+		log.Errorf("Error while reading last modified date: %v", err)
+		return err
+	}
+
+	newCfg := &Configuration{}
+	if err := yaml.Unmarshal(dat, newCfg); err != nil {
+		log.Errorf("Error while parsing YAML file %v: %v", configPath, err)
+		return err
+	}
+	if err := validatePlans(newCfg.Plans); err != nil {
+		log.Errorf("Error while validating plans of %v: %v", configPath, err)
+		return err
+	}
+	if err := validateInstanceMetadata(newCfg.InstanceMetadata); err != nil {
+		log.Errorf("Error while validating instance metadata of %v: %v", configPath, err)
 		return err
 	}
 
+	cfg = newCfg
 	lastModified = file.ModTime()
 	lastModifiedHash = hash(file.ModTime().String())
+	log.Infof("Configuration read with %v cloud foundries", len(cfg.CloudFoundries))
 
-	if err := yaml.Unmarshal(dat, &cfg); err != nil {
-		log.Printf("Error while parsing YAML file %v: %v", configPath, err)
-		return err
+	return nil
+}
+
+// validatePlans checks that maintenance versions are semantic versions
+func validatePlans(plans map[string]Plan) error {
+	for name, plan := range plans {
+		version := plan.MaintenanceInfo.Version
+		if version != "" && !semVer.MatchString(version) {
+			return fmt.Errorf("maintenance version %v of plan %v is not a semantic version", version, name)
+		}
 	}
-	log.Println(cfg)
+	return nil
+}
 
+// validateInstanceMetadata checks that the metadata templates parse
+func validateInstanceMetadata(metadata InstanceMetadata) error {
+	for kind, templates := range map[string]map[string]string{"label": metadata.Labels, "attribute": metadata.Attributes} {
+		for name, text := range templates {
+			if _, err := template.New(name).Funcs(MetadataFuncs).Parse(text); err != nil {
+				return fmt.Errorf("invalid template of %v %v: %v", kind, name, err)
+			}
+		}
+	}
 	return nil
 }
 
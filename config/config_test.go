@@ -2,6 +2,7 @@ package config
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -28,3 +29,102 @@ func TestReadConfig(t *testing.T) {
 	assert.NotNil(t, Get().CloudFoundries["cf-eu10"])
 	assert.Equal(t, Get().CloudFoundries["cf-eu10"].UserName, "admin-eu10")
 }
+
+func TestReadCredentials(t *testing.T) {
+	err := Read("./config.yaml")
+	assert.Nil(t, err)
+
+	credentials := Get().Server.Credentials()
+	assert.Len(t, credentials, 3)
+	assert.Equal(t, "username", credentials[0].UserName)
+	assert.Equal(t, "rotated", credentials[1].UserName)
+	assert.False(t, credentials[1].NotBefore.IsZero())
+	assert.True(t, credentials[1].NotAfter.IsZero())
+	assert.False(t, credentials[2].ValidAt(time.Now()))
+}
+
+func TestReadRoutePolicies(t *testing.T) {
+	err := Read("./config.yaml")
+	assert.Nil(t, err)
+
+	assert.Equal(t, AuthTypeBasic, Get().Server.AuthType)
+	assert.Equal(t, AuthTypeBasic, Get().Server.Admin.AuthType)
+	assert.Equal(t, "admin", Get().Server.Admin.Credentials()[0].UserName)
+	assert.Contains(t, Get().Server.PublicRoutes, "health")
+	assert.Contains(t, Get().Server.AdminRoutes, "version")
+	assert.False(t, Get().Server.RateLimits.TrustForwardedFor, "no trusted proxy by default")
+}
+
+func TestReadTimeouts(t *testing.T) {
+	err := Read("./config.yaml")
+	assert.Nil(t, err)
+
+	assert.Equal(t, 5*time.Second, Get().Server.Timeouts.ReadHeader)
+	assert.Equal(t, 2*time.Minute, Get().Server.Timeouts.Idle)
+	assert.Equal(t, 30*time.Second, Get().Server.Timeouts.ShutdownGracePeriod)
+	assert.Equal(t, 10*time.Second, Get().Server.Timeouts.ShutdownHooks)
+}
+
+func TestReadStoreAndHealth(t *testing.T) {
+	err := Read("./config.yaml")
+	assert.Nil(t, err)
+
+	assert.Equal(t, StoreTypeMemory, Get().Store.Type)
+	assert.Equal(t, 30*time.Second, Get().Health.Interval)
+	assert.Equal(t, 5*time.Second, Get().Health.Timeout)
+	assert.Equal(t, 10, Get().Health.Window)
+	assert.Equal(t, 0.5, Get().Health.UnavailableBelow)
+}
+
+func TestReadPlans(t *testing.T) {
+	err := Read("./config.yaml")
+	assert.Nil(t, err)
+
+	assert.Equal(t, time.Minute, Get().Reaper.Interval)
+	assert.Equal(t, 90*24*time.Hour, Get().Plans["cloudcontroller"].CredentialTTL)
+	assert.Equal(t, 14*24*time.Hour, Get().Plans["cloudcontroller"].RenewBefore)
+	assert.Equal(t, []string{"space_auditor", "space_developer"}, Get().Plans["cloudcontroller"].Roles)
+	assert.Equal(t, "space_auditor", Get().Plans["cloudcontroller"].DefaultRole)
+	assert.Equal(t, "1.0.0", Get().Plans["cloudcontroller"].MaintenanceInfo.Version)
+}
+
+func TestValidatePlans(t *testing.T) {
+	assert.NoError(t, validatePlans(map[string]Plan{
+		"a": {},
+		"b": {MaintenanceInfo: MaintenanceInfo{Version: "1.2.3-rc.1+build.5"}},
+	}))
+	assert.EqualError(t, validatePlans(map[string]Plan{
+		"a": {MaintenanceInfo: MaintenanceInfo{Version: "1.2"}},
+	}), "maintenance version 1.2 of plan a is not a semantic version")
+}
+
+func TestReadInstanceMetadata(t *testing.T) {
+	err := Read("./config.yaml")
+	assert.Nil(t, err)
+
+	assert.Equal(t, "{{.Foundation}}", Get().InstanceMetadata.Labels["foundation"])
+	assert.Contains(t, Get().InstanceMetadata.Attributes, "api_url")
+	assert.Equal(t, "eu10", Get().CloudFoundries["cf-eu10"].Region)
+}
+
+func TestReadDashboard(t *testing.T) {
+	err := Read("./config.yaml")
+	assert.Nil(t, err)
+
+	assert.Equal(t, "http://localhost:5000", Get().Dashboard.URL)
+	assert.Empty(t, Get().Dashboard.SigningKey, "dashboards are off until a signing key is configured")
+	assert.Equal(t, 24*time.Hour, Get().Dashboard.TokenTTL)
+}
+
+func TestValidateInstanceMetadata(t *testing.T) {
+	assert.NoError(t, validateInstanceMetadata(InstanceMetadata{
+		Labels:     map[string]string{"foundation": "{{.Foundation}}"},
+		Attributes: map[string]string{"labels": `{{join .Labels ","}}`},
+	}))
+	assert.Error(t, validateInstanceMetadata(InstanceMetadata{
+		Attributes: map[string]string{"broken": "{{.Foundation"},
+	}))
+	assert.Error(t, validateInstanceMetadata(InstanceMetadata{
+		Labels: map[string]string{"unknown": "{{upper .Foundation}}"},
+	}), "unknown function")
+}
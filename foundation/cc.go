@@ -0,0 +1,150 @@
+package foundation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/sklevenz/cf-api-broker/metrics"
+)
+
+const (
+	ccOrganizationsPath string = "/v3/organizations"
+	ccSpacesPath        string = "/v3/spaces"
+	ccUsersPath         string = "/v3/users"
+	ccRolesPath         string = "/v3/roles"
+
+	// roleOrganizationUser is required to hold a role in a space of the org
+	roleOrganizationUser string = "organization_user"
+)
+
+var (
+	// ErrNotFound is returned if an org or space does not exist
+	ErrNotFound = errors.New("not found")
+)
+
+// Organization is a Cloud Foundry org
+type Organization struct {
+	GUID string `json:"guid"`
+	Name string `json:"name"`
+}
+
+// Space is a Cloud Foundry space in the org OrganizationGUID
+type Space struct {
+	GUID             string `json:"guid"`
+	Name             string `json:"name"`
+	OrganizationGUID string `json:"-"`
+}
+
+// Organization returns the org with guid
+func (c *Client) Organization(ctx context.Context, guid string) (*Organization, error) {
+	org := &Organization{}
+	if err := c.ccGet(ctx, ccOrganizationsPath+"/"+url.PathEscape(guid), org); err != nil {
+		return nil, err
+	}
+	return org, nil
+}
+
+// Space returns the space with guid
+func (c *Client) Space(ctx context.Context, guid string) (*Space, error) {
+	space := &struct {
+		Space
+		Relationships struct {
+			Organization struct {
+				Data struct {
+					GUID string `json:"guid"`
+				} `json:"data"`
+			} `json:"organization"`
+		} `json:"relationships"`
+	}{}
+	if err := c.ccGet(ctx, ccSpacesPath+"/"+url.PathEscape(guid), space); err != nil {
+		return nil, err
+	}
+	space.Space.OrganizationGUID = space.Relationships.Organization.Data.GUID
+	return &space.Space, nil
+}
+
+// GrantRole gives the UAA client clientID a Cloud Foundry role. Space roles
+// (space_*) are granted in spaceGUID, org roles in orgGUID. The client is
+// registered as Cloud Controller user and becomes member of the org first.
+func (c *Client) GrantRole(ctx context.Context, clientID string, role string, orgGUID string, spaceGUID string) error {
+	if err := c.ccPost(ctx, ccUsersPath, map[string]interface{}{"guid": clientID}); err != nil {
+		return err
+	}
+	if err := c.ccPost(ctx, ccRolesPath, roleRequest(roleOrganizationUser, clientID, "organization", orgGUID)); err != nil {
+		return err
+	}
+
+	if strings.HasPrefix(role, "space_") {
+		return c.ccPost(ctx, ccRolesPath, roleRequest(role, clientID, "space", spaceGUID))
+	}
+	if role != roleOrganizationUser {
+		return c.ccPost(ctx, ccRolesPath, roleRequest(strings.Replace(role, "org_", "organization_", 1), clientID, "organization", orgGUID))
+	}
+	return nil
+}
+
+// DeleteUser removes the Cloud Controller user of a client with all its
+// roles. Deleting a user that does not exist succeeds.
+func (c *Client) DeleteUser(ctx context.Context, clientID string) error {
+	request, err := c.ccRequest(ctx, http.MethodDelete, ccUsersPath+"/"+url.PathEscape(clientID), nil)
+	if err != nil {
+		return err
+	}
+
+	err = c.do(request, metrics.ComponentCC, http.StatusAccepted, nil)
+	if statusErr, ok := err.(*statusError); ok && statusErr.status == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
+
+func roleRequest(role string, clientID string, target string, guid string) map[string]interface{} {
+	return map[string]interface{}{
+		"type": role,
+		"relationships": map[string]interface{}{
+			"user": map[string]interface{}{"data": map[string]string{"guid": clientID}},
+			target: map[string]interface{}{"data": map[string]string{"guid": guid}},
+		},
+	}
+}
+
+func (c *Client) ccGet(ctx context.Context, path string, result interface{}) error {
+	request, err := c.ccRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+
+	err = c.do(request, metrics.ComponentCC, http.StatusOK, result)
+	if statusErr, ok := err.(*statusError); ok && statusErr.status == http.StatusNotFound {
+		return ErrNotFound
+	}
+	return err
+}
+
+// ccPost creates a resource. Resources that exist already are accepted, the
+// Cloud Controller answers them with 422 and a message that they already
+// exist.
+func (c *Client) ccPost(ctx context.Context, path string, resource interface{}) error {
+	body, err := json.Marshal(resource)
+	if err != nil {
+		return err
+	}
+	request, err := c.ccRequest(ctx, http.MethodPost, path, body)
+	if err != nil {
+		return err
+	}
+
+	err = c.do(request, metrics.ComponentCC, http.StatusCreated, nil)
+	if statusErr, ok := err.(*statusError); ok && statusErr.status == http.StatusUnprocessableEntity && strings.Contains(statusErr.body, "already") {
+		return nil
+	}
+	return err
+}
+
+func (c *Client) ccRequest(ctx context.Context, method string, path string, body []byte) (*http.Request, error) {
+	return c.authorizedRequest(ctx, method, strings.TrimSuffix(c.cf.APIURL, "/")+path, body)
+}
@@ -0,0 +1,53 @@
+package foundation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sklevenz/cf-api-broker/foundation/foundationtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrganizationAndSpace(t *testing.T) {
+	cf := foundationtest.NewServer()
+	defer cf.Close()
+	cf.AddOrganization("org-1", "team")
+	cf.AddSpace("space-1", "dev", "org-1")
+	client := NewClient("cf-test-cc", cf.Config())
+	ctx := context.Background()
+
+	org, err := client.Organization(ctx, "org-1")
+	assert.NoError(t, err)
+	assert.Equal(t, &Organization{GUID: "org-1", Name: "team"}, org)
+
+	space, err := client.Space(ctx, "space-1")
+	assert.NoError(t, err)
+	assert.Equal(t, &Space{GUID: "space-1", Name: "dev", OrganizationGUID: "org-1"}, space)
+
+	_, err = client.Organization(ctx, "unknown")
+	assert.Equal(t, ErrNotFound, err)
+	_, err = client.Space(ctx, "unknown")
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestGrantRole(t *testing.T) {
+	cf := foundationtest.NewServer()
+	defer cf.Close()
+	cf.AddOrganization("org-1", "team")
+	cf.AddSpace("space-1", "dev", "org-1")
+	client := NewClient("cf-test-roles", cf.Config())
+	ctx := context.Background()
+
+	assert.NoError(t, client.GrantRole(ctx, "client-1", "space_developer", "org-1", "space-1"))
+	assert.Equal(t, []string{"organization_user org-1", "space_developer space-1"}, cf.Roles("client-1"))
+	assert.NoError(t, client.GrantRole(ctx, "client-1", "space_developer", "org-1", "space-1"), "granting twice succeeds")
+
+	assert.NoError(t, client.GrantRole(ctx, "client-2", "org_manager", "org-1", "space-1"))
+	assert.Equal(t, []string{"organization_user org-1", "organization_manager org-1"}, cf.Roles("client-2"))
+
+	assert.Error(t, client.GrantRole(ctx, "client-3", "space_auditor", "org-1", "unknown"))
+
+	assert.NoError(t, client.DeleteUser(ctx, "client-1"))
+	assert.Nil(t, cf.Roles("client-1"))
+	assert.NoError(t, client.DeleteUser(ctx, "client-1"), "deleting a missing user succeeds")
+}
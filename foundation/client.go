@@ -0,0 +1,96 @@
+// Package foundation talks to the UAA and Cloud Controller of a Cloud
+// Foundry foundation.
+package foundation
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sklevenz/cf-api-broker/config"
+	"github.com/sklevenz/cf-api-broker/metrics"
+	"github.com/sklevenz/cf-api-broker/tracing"
+)
+
+const (
+	uaaHealthPath string = "/healthz"
+	ccRootPath    string = "/"
+
+	defaultTimeout time.Duration = 30 * time.Second
+)
+
+// Client calls the components of one foundation
+type Client struct {
+	name       string
+	cf         config.CloudFoundry
+	httpClient *http.Client
+
+	tokenMutex sync.Mutex
+	token      *token
+}
+
+// NewClient creates a client for the foundation name
+func NewClient(name string, cf config.CloudFoundry) *Client {
+	return &Client{
+		name: name,
+		cf:   cf,
+		httpClient: &http.Client{
+			Transport: tracing.Transport(nil),
+			Timeout:   defaultTimeout,
+		},
+	}
+}
+
+// Name returns the foundation name
+func (c *Client) Name() string {
+	return c.name
+}
+
+// APIURL returns the Cloud Controller URL of the foundation
+func (c *Client) APIURL() string {
+	return c.cf.APIURL
+}
+
+// UAAURL returns the UAA URL of the foundation
+func (c *Client) UAAURL() string {
+	return c.cf.UAAURL
+}
+
+// PingUAA checks that the UAA health endpoint reports ok
+func (c *Client) PingUAA(ctx context.Context) error {
+	return c.ping(ctx, metrics.ComponentUAA, c.cf.UAAURL+uaaHealthPath)
+}
+
+// PingCC checks that the Cloud Controller root endpoint answers
+func (c *Client) PingCC(ctx context.Context) error {
+	return c.ping(ctx, metrics.ComponentCC, strings.TrimSuffix(c.cf.APIURL, "/")+ccRootPath)
+}
+
+func (c *Client) ping(ctx context.Context, component string, url string) (err error) {
+	start := time.Now()
+	defer func() {
+		metrics.ObserveFoundationCall(c.name, component, start, err)
+	}()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	io.Copy(ioutil.Discard, response.Body)
+
+	if response.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("%v returned %v", url, response.Status)
+	}
+	return nil
+}
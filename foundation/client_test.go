@@ -0,0 +1,40 @@
+package foundation
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sklevenz/cf-api-broker/config"
+	"github.com/sklevenz/cf-api-broker/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPing(t *testing.T) {
+	uaa := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/healthz", r.URL.Path)
+		w.Write([]byte("ok"))
+	}))
+	defer uaa.Close()
+	cc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer cc.Close()
+
+	client := NewClient("cf-test-ping", config.CloudFoundry{APIURL: cc.URL + "/", UAAURL: uaa.URL})
+
+	assert.Equal(t, "cf-test-ping", client.Name())
+	assert.NoError(t, client.PingUAA(context.Background()))
+	assert.Error(t, client.PingCC(context.Background()))
+
+	assert.Equal(t, 0.0, testutil.ToFloat64(metrics.FoundationCallErrors.WithLabelValues("cf-test-ping", metrics.ComponentUAA)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.FoundationCallErrors.WithLabelValues("cf-test-ping", metrics.ComponentCC)))
+}
+
+func TestPingUnreachable(t *testing.T) {
+	client := NewClient("cf-test-unreachable", config.CloudFoundry{UAAURL: "http://127.0.0.1:1"})
+
+	assert.Error(t, client.PingUAA(context.Background()))
+}
@@ -0,0 +1,264 @@
+// Package foundationtest provides a fake foundation with the UAA and Cloud
+// Controller endpoints used by the broker, for tests.
+package foundationtest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/sklevenz/cf-api-broker/config"
+)
+
+// Server is a fake foundation serving UAA and Cloud Controller endpoints
+type Server struct {
+	*httptest.Server
+
+	mutex   sync.Mutex
+	clients map[string]map[string]interface{}
+	orgs    map[string]string
+	spaces  map[string][2]string
+	users   map[string][]string
+	fail    map[string]bool
+}
+
+// NewServer starts a fake foundation
+func NewServer() *Server {
+	s := &Server{
+		clients: map[string]map[string]interface{}{},
+		orgs:    map[string]string{},
+		spaces:  map[string][2]string{},
+		users:   map[string][]string{},
+		fail:    map[string]bool{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Config returns a foundation configuration pointing to the server
+func (s *Server) Config() config.CloudFoundry {
+	return config.CloudFoundry{APIURL: s.URL, UAAURL: s.URL, UserName: "admin", Password: "secret"}
+}
+
+// Fail makes requests whose "METHOD path" starts with prefix answer 500,
+// e.g. "POST /oauth/clients"
+func (s *Server) Fail(prefix string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.fail[prefix] = true
+}
+
+// Client returns the registered UAA client with id or nil
+func (s *Server) Client(id string) map[string]interface{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.clients[id]
+}
+
+// Clients returns the number of registered UAA clients
+func (s *Server) Clients() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.clients)
+}
+
+// AddOrganization creates an org
+func (s *Server) AddOrganization(guid string, name string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.orgs[guid] = name
+}
+
+// AddSpace creates a space in the org orgGUID
+func (s *Server) AddSpace(guid string, name string, orgGUID string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.spaces[guid] = [2]string{name, orgGUID}
+}
+
+// Roles returns the roles of a Cloud Controller user as "type guid" or nil
+// if the user does not exist
+func (s *Server) Roles(userGUID string) []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.users[userGUID]
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for prefix := range s.fail {
+		if strings.HasPrefix(r.Method+" "+r.URL.Path, prefix) {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	switch {
+	case r.URL.Path == "/" || r.URL.Path == "/healthz":
+		w.Write([]byte("ok"))
+	case r.Method == http.MethodPost && r.URL.Path == "/oauth/token":
+		if user, pw, ok := r.BasicAuth(); !ok || user != "cf" || pw != "" || r.FormValue("username") != "admin" || r.FormValue("password") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "admin-token", "expires_in": 3600})
+	case strings.HasPrefix(r.URL.Path, "/oauth/clients"):
+		if r.Header.Get("Authorization") != "Bearer admin-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		s.serveClients(w, r)
+	case strings.HasPrefix(r.URL.Path, "/v3/"):
+		if r.Header.Get("Authorization") != "Bearer admin-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		s.serveCC(w, r)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (s *Server) serveClients(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/oauth/clients"), "/")
+
+	switch {
+	case r.Method == http.MethodPost && id == "":
+		client := map[string]interface{}{}
+		if err := json.NewDecoder(r.Body).Decode(&client); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		clientID, _ := client["client_id"].(string)
+		if _, ok := s.clients[clientID]; ok {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		s.clients[clientID] = client
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(client)
+	case r.Method == http.MethodDelete && id != "":
+		client, ok := s.clients[id]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(s.clients, id)
+		json.NewEncoder(w).Encode(client)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) serveCC(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 2 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	guid := ""
+	if len(parts) > 2 {
+		guid = parts[2]
+	}
+
+	switch {
+	case r.Method == http.MethodGet && parts[1] == "organizations" && guid != "":
+		name, ok := s.orgs[guid]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"guid": guid, "name": name})
+	case r.Method == http.MethodGet && parts[1] == "spaces" && guid != "":
+		space, ok := s.spaces[guid]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"guid": guid,
+			"name": space[0],
+			"relationships": map[string]interface{}{
+				"organization": map[string]interface{}{"data": map[string]string{"guid": space[1]}},
+			},
+		})
+	case r.Method == http.MethodPost && parts[1] == "users":
+		user := map[string]string{}
+		json.NewDecoder(r.Body).Decode(&user)
+		if _, ok := s.users[user["guid"]]; ok {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			w.Write([]byte(`{"errors":[{"detail":"User with guid already exists."}]}`))
+			return
+		}
+		s.users[user["guid"]] = []string{}
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodDelete && parts[1] == "users" && guid != "":
+		if _, ok := s.users[guid]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(s.users, guid)
+		w.WriteHeader(http.StatusAccepted)
+	case r.Method == http.MethodPost && parts[1] == "roles":
+		s.serveRole(w, r)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (s *Server) serveRole(w http.ResponseWriter, r *http.Request) {
+	role := struct {
+		Type          string `json:"type"`
+		Relationships map[string]struct {
+			Data struct {
+				GUID string `json:"guid"`
+			} `json:"data"`
+		} `json:"relationships"`
+	}{}
+	json.NewDecoder(r.Body).Decode(&role)
+
+	user := role.Relationships["user"].Data.GUID
+	roles, ok := s.users[user]
+	if !ok {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		w.Write([]byte(`{"errors":[{"detail":"Invalid user."}]}`))
+		return
+	}
+
+	target := role.Relationships["space"].Data.GUID
+	if space, ok := s.spaces[target]; ok {
+		if !containsString(roles, "organization_user "+space[1]) {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			w.Write([]byte(`{"errors":[{"detail":"Users cannot be assigned roles in a space if they do not have a role in that space's organization."}]}`))
+			return
+		}
+	} else if _, ok := s.orgs[role.Relationships["organization"].Data.GUID]; ok {
+		target = role.Relationships["organization"].Data.GUID
+	} else {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		w.Write([]byte(`{"errors":[{"detail":"Invalid organization or space."}]}`))
+		return
+	}
+
+	entry := role.Type + " " + target
+	if containsString(roles, entry) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		w.Write([]byte(`{"errors":[{"detail":"User already has role."}]}`))
+		return
+	}
+	s.users[user] = append(roles, entry)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
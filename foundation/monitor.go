@@ -0,0 +1,143 @@
+package foundation
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sklevenz/cf-api-broker/metrics"
+)
+
+const (
+	// StateUnknown marks foundations that were not probed yet
+	StateUnknown string = "unknown"
+	// StateAvailable marks foundations that answer reliably
+	StateAvailable string = "available"
+	// StateDegraded marks foundations with occasional failed probes
+	StateDegraded string = "degraded"
+	// StateUnavailable marks foundations whose probes mostly fail
+	StateUnavailable string = "unavailable"
+)
+
+var states = []string{StateUnknown, StateAvailable, StateDegraded, StateUnavailable}
+
+// Status is the availability of a foundation within the monitoring window
+type Status struct {
+	Name         string    `json:"name"`
+	State        string    `json:"state"`
+	Availability float64   `json:"availability"`
+	Samples      int       `json:"samples"`
+	LastCheck    time.Time `json:"last_check,omitempty"`
+}
+
+// Placeable checks whether new instances may be placed on the foundation.
+// Foundations that were not probed yet are placeable.
+func (s Status) Placeable() bool {
+	return s.State == StateAvailable || s.State == StateUnknown
+}
+
+type window struct {
+	samples   []bool
+	next      int
+	lastCheck time.Time
+}
+
+// Monitor tracks the availability of foundations over a sliding window of
+// the last probes
+type Monitor struct {
+	size             int
+	degradedBelow    float64
+	unavailableBelow float64
+
+	mutex   sync.RWMutex
+	windows map[string]*window
+}
+
+// NewMonitor creates a monitor keeping size probes per foundation. A
+// foundation is degraded if its availability drops below degradedBelow and
+// unavailable below unavailableBelow.
+func NewMonitor(size int, degradedBelow float64, unavailableBelow float64) *Monitor {
+	return &Monitor{
+		size:             size,
+		degradedBelow:    degradedBelow,
+		unavailableBelow: unavailableBelow,
+		windows:          map[string]*window{},
+	}
+}
+
+// Observe records the outcome of a probe of foundation name
+func (m *Monitor) Observe(name string, up bool) {
+	m.mutex.Lock()
+	w, ok := m.windows[name]
+	if !ok {
+		w = &window{}
+		m.windows[name] = w
+	}
+	if len(w.samples) < m.size {
+		w.samples = append(w.samples, up)
+	} else {
+		w.samples[w.next] = up
+	}
+	w.next = (w.next + 1) % m.size
+	w.lastCheck = time.Now().UTC()
+	status := m.status(name)
+	m.mutex.Unlock()
+
+	metrics.FoundationAvailability.WithLabelValues(name).Set(status.Availability)
+	for _, state := range states {
+		value := 0.0
+		if state == status.State {
+			value = 1
+		}
+		metrics.FoundationState.WithLabelValues(name, state).Set(value)
+	}
+}
+
+// Status returns the current status of foundation name
+func (m *Monitor) Status(name string) Status {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.status(name)
+}
+
+// Statuses returns the status of all observed foundations ordered by name
+func (m *Monitor) Statuses() []Status {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	statuses := make([]Status, 0, len(m.windows))
+	for name := range m.windows {
+		statuses = append(statuses, m.status(name))
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+func (m *Monitor) status(name string) Status {
+	status := Status{Name: name, State: StateUnknown}
+
+	w, ok := m.windows[name]
+	if !ok || len(w.samples) == 0 {
+		return status
+	}
+
+	up := 0
+	for _, sample := range w.samples {
+		if sample {
+			up++
+		}
+	}
+	status.Samples = len(w.samples)
+	status.Availability = float64(up) / float64(len(w.samples))
+	status.LastCheck = w.lastCheck
+
+	switch {
+	case status.Availability < m.unavailableBelow:
+		status.State = StateUnavailable
+	case status.Availability < m.degradedBelow:
+		status.State = StateDegraded
+	default:
+		status.State = StateAvailable
+	}
+	return status
+}
@@ -0,0 +1,55 @@
+package foundation
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sklevenz/cf-api-broker/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMonitorStates(t *testing.T) {
+	monitor := NewMonitor(4, 0.9, 0.5)
+
+	assert.Equal(t, StateUnknown, monitor.Status("cf-a").State)
+	assert.True(t, monitor.Status("cf-a").Placeable())
+
+	for i := 0; i < 4; i++ {
+		monitor.Observe("cf-a", true)
+	}
+	assert.Equal(t, StateAvailable, monitor.Status("cf-a").State)
+	assert.Equal(t, 1.0, monitor.Status("cf-a").Availability)
+
+	monitor.Observe("cf-a", false)
+	status := monitor.Status("cf-a")
+	assert.Equal(t, StateDegraded, status.State)
+	assert.Equal(t, 0.75, status.Availability)
+	assert.Equal(t, 4, status.Samples)
+	assert.False(t, status.Placeable())
+
+	monitor.Observe("cf-a", false)
+	monitor.Observe("cf-a", false)
+	assert.Equal(t, StateUnavailable, monitor.Status("cf-a").State)
+
+	// old failures slide out of the window
+	for i := 0; i < 4; i++ {
+		monitor.Observe("cf-a", true)
+	}
+	assert.Equal(t, StateAvailable, monitor.Status("cf-a").State)
+}
+
+func TestMonitorStatusesAndMetrics(t *testing.T) {
+	monitor := NewMonitor(2, 0.9, 0.5)
+	monitor.Observe("cf-monitor-b", false)
+	monitor.Observe("cf-monitor-a", true)
+
+	statuses := monitor.Statuses()
+	assert.Len(t, statuses, 2)
+	assert.Equal(t, "cf-monitor-a", statuses[0].Name)
+	assert.Equal(t, StateUnavailable, statuses[1].State)
+	assert.False(t, statuses[1].LastCheck.IsZero())
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.FoundationAvailability.WithLabelValues("cf-monitor-a")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.FoundationState.WithLabelValues("cf-monitor-b", StateUnavailable)))
+	assert.Equal(t, 0.0, testutil.ToFloat64(metrics.FoundationState.WithLabelValues("cf-monitor-b", StateAvailable)))
+}
@@ -0,0 +1,176 @@
+package foundation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sklevenz/cf-api-broker/metrics"
+)
+
+const (
+	uaaTokenPath   string = "/oauth/token"
+	uaaClientsPath string = "/oauth/clients"
+
+	// uaaLoginClient is the public client used to obtain the admin token
+	// with the password grant
+	uaaLoginClient string = "cf"
+
+	tokenExpiryMargin time.Duration = 30 * time.Second
+)
+
+var (
+	// ErrClientExists is returned if a UAA client with the same id exists
+	ErrClientExists = errors.New("uaa client already exists")
+)
+
+// UAAClient is an OAuth client registered in the UAA of a foundation.
+// Clients use the client_credentials grant and get Authorities as scopes.
+type UAAClient struct {
+	ID          string   `json:"client_id"`
+	Secret      string   `json:"client_secret,omitempty"`
+	Authorities []string `json:"authorities"`
+	GrantTypes  []string `json:"authorized_grant_types"`
+	Name        string   `json:"name,omitempty"`
+}
+
+type token struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+	expiresAt   time.Time
+}
+
+// adminToken returns a cached token of the configured foundation user
+func (c *Client) adminToken(ctx context.Context) (string, error) {
+	c.tokenMutex.Lock()
+	defer c.tokenMutex.Unlock()
+
+	if c.token != nil && time.Now().Before(c.token.expiresAt) {
+		return c.token.AccessToken, nil
+	}
+
+	form := url.Values{
+		"grant_type": {"password"},
+		"username":   {c.cf.UserName},
+		"password":   {c.cf.Password},
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cf.UAAURL+uaaTokenPath, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	request.SetBasicAuth(uaaLoginClient, "")
+
+	t := &token{}
+	if err := c.do(request, metrics.ComponentUAA, http.StatusOK, t); err != nil {
+		return "", fmt.Errorf("could not get uaa token: %v", err)
+	}
+	t.expiresAt = time.Now().Add(time.Duration(t.ExpiresIn)*time.Second - tokenExpiryMargin)
+	c.token = t
+
+	return t.AccessToken, nil
+}
+
+// CreateUAAClient registers client in the UAA of the foundation
+func (c *Client) CreateUAAClient(ctx context.Context, client UAAClient) error {
+	if len(client.GrantTypes) == 0 {
+		client.GrantTypes = []string{"client_credentials"}
+	}
+	body, err := json.Marshal(client)
+	if err != nil {
+		return err
+	}
+
+	request, err := c.uaaRequest(ctx, http.MethodPost, uaaClientsPath, body)
+	if err != nil {
+		return err
+	}
+
+	err = c.do(request, metrics.ComponentUAA, http.StatusCreated, nil)
+	if statusErr, ok := err.(*statusError); ok && statusErr.status == http.StatusConflict {
+		return ErrClientExists
+	}
+	return err
+}
+
+// DeleteUAAClient removes the client with id from the UAA of the foundation.
+// Deleting a client that does not exist succeeds.
+func (c *Client) DeleteUAAClient(ctx context.Context, id string) error {
+	request, err := c.uaaRequest(ctx, http.MethodDelete, uaaClientsPath+"/"+url.PathEscape(id), nil)
+	if err != nil {
+		return err
+	}
+
+	err = c.do(request, metrics.ComponentUAA, http.StatusOK, nil)
+	if statusErr, ok := err.(*statusError); ok && statusErr.status == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
+
+func (c *Client) uaaRequest(ctx context.Context, method string, path string, body []byte) (*http.Request, error) {
+	return c.authorizedRequest(ctx, method, c.cf.UAAURL+path, body)
+}
+
+// authorizedRequest creates a request to url with the admin token
+func (c *Client) authorizedRequest(ctx context.Context, method string, url string, body []byte) (*http.Request, error) {
+	accessToken, err := c.adminToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", "Bearer "+accessToken)
+	request.Header.Set("Accept", "application/json")
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	return request, nil
+}
+
+// statusError is returned for unexpected response status codes
+type statusError struct {
+	url    string
+	status int
+	body   string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%v returned %v: %v", e.url, e.status, e.body)
+}
+
+// do sends request, records metrics and decodes a JSON response into result
+func (c *Client) do(request *http.Request, component string, expected int, result interface{}) (err error) {
+	start := time.Now()
+	defer func() {
+		metrics.ObserveFoundationCall(c.name, component, start, err)
+	}()
+
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != expected {
+		body, _ := ioutil.ReadAll(io.LimitReader(response.Body, 512))
+		return &statusError{url: request.URL.String(), status: response.StatusCode, body: strings.TrimSpace(string(body))}
+	}
+	if result == nil {
+		io.Copy(ioutil.Discard, response.Body)
+		return nil
+	}
+	return json.NewDecoder(response.Body).Decode(result)
+}
@@ -0,0 +1,54 @@
+package foundation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sklevenz/cf-api-broker/foundation/foundationtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUAAClients(t *testing.T) {
+	cf := foundationtest.NewServer()
+	defer cf.Close()
+	client := NewClient("cf-test-uaa", cf.Config())
+	ctx := context.Background()
+
+	err := client.CreateUAAClient(ctx, UAAClient{ID: "binding-1", Secret: "s3cret", Authorities: []string{"cloud_controller.read"}})
+	assert.NoError(t, err)
+	created := cf.Client("binding-1")
+	assert.Equal(t, "s3cret", created["client_secret"])
+	assert.Equal(t, []interface{}{"client_credentials"}, created["authorized_grant_types"])
+	assert.Equal(t, []interface{}{"cloud_controller.read"}, created["authorities"])
+
+	err = client.CreateUAAClient(ctx, UAAClient{ID: "binding-1", Secret: "other"})
+	assert.Equal(t, ErrClientExists, err)
+
+	assert.NoError(t, client.DeleteUAAClient(ctx, "binding-1"))
+	assert.Nil(t, cf.Client("binding-1"))
+	assert.NoError(t, client.DeleteUAAClient(ctx, "binding-1"), "deleting a missing client succeeds")
+}
+
+func TestUAAClientsFailure(t *testing.T) {
+	cf := foundationtest.NewServer()
+	defer cf.Close()
+	cf.Fail("POST /oauth/clients")
+	client := NewClient("cf-test-uaa-failure", cf.Config())
+
+	err := client.CreateUAAClient(context.Background(), UAAClient{ID: "binding-1"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "500")
+}
+
+func TestUAAAdminTokenRejected(t *testing.T) {
+	cf := foundationtest.NewServer()
+	defer cf.Close()
+	cfg := cf.Config()
+	cfg.Password = "wrong"
+	client := NewClient("cf-test-uaa-token", cfg)
+
+	err := client.CreateUAAClient(context.Background(), UAAClient{ID: "binding-1"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "uaa token")
+	assert.Equal(t, 0, cf.Clients())
+}
@@ -0,0 +1,188 @@
+// Package health probes components the broker depends on in the background
+// and caches the results for cheap readiness checks.
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// StatusUp marks a component that answered the last probe
+	StatusUp string = "up"
+	// StatusDown marks a component whose last probe failed
+	StatusDown string = "down"
+	// StatusUnknown marks a component that was not probed yet
+	StatusUnknown string = "unknown"
+)
+
+// Check probes one component. Checks of the same Group, e.g. the components
+// of one foundation, belong together.
+type Check struct {
+	Name     string
+	Group    string
+	Critical bool
+	Probe    func(ctx context.Context) error
+}
+
+// Result is the cached outcome of the last probe of a check
+type Result struct {
+	Name      string    `json:"name"`
+	Group     string    `json:"group,omitempty"`
+	Critical  bool      `json:"critical"`
+	Status    string    `json:"status"`
+	LatencyMs float64   `json:"latency_ms"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at,omitempty"`
+}
+
+// Up checks whether the component answered the last probe
+func (r Result) Up() bool {
+	return r.Status == StatusUp
+}
+
+// Checker runs checks periodically
+type Checker struct {
+	checks   []Check
+	interval time.Duration
+	timeout  time.Duration
+
+	mutex     sync.RWMutex
+	results   map[string]Result
+	observers []func(results []Result)
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewChecker creates a checker probing checks every interval, each probe
+// is cancelled after timeout
+func NewChecker(interval time.Duration, timeout time.Duration, checks ...Check) *Checker {
+	return &Checker{
+		checks:   checks,
+		interval: interval,
+		timeout:  timeout,
+		results:  map[string]Result{},
+	}
+}
+
+// Run probes all checks once and concurrently
+func (c *Checker) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, check := range c.checks {
+		wg.Add(1)
+		go func(check Check) {
+			defer wg.Done()
+			c.setResult(c.probe(ctx, check))
+		}(check)
+	}
+	wg.Wait()
+
+	c.mutex.RLock()
+	observers := c.observers
+	c.mutex.RUnlock()
+
+	results := c.Results()
+	for _, observer := range observers {
+		observer(results)
+	}
+}
+
+// OnRun registers observer to be called with all results after each round
+// of probes
+func (c *Checker) OnRun(observer func(results []Result)) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.observers = append(c.observers, observer)
+}
+
+func (c *Checker) probe(ctx context.Context, check Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check.Probe(ctx)
+
+	result := Result{
+		Name:      check.Name,
+		Group:     check.Group,
+		Critical:  check.Critical,
+		Status:    StatusUp,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+		CheckedAt: start.UTC(),
+	}
+	if err != nil {
+		result.Status = StatusDown
+		result.Error = err.Error()
+	}
+	return result
+}
+
+func (c *Checker) setResult(result Result) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.results[result.Name] = result
+}
+
+// Start probes all checks now and then every interval until Stop is called
+func (c *Checker) Start() {
+	c.stop = make(chan struct{})
+	c.done = make(chan struct{})
+
+	go func() {
+		defer close(c.done)
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+
+		for {
+			ctx, cancel := context.WithCancel(context.Background())
+			go func() {
+				select {
+				case <-c.stop:
+					cancel()
+				case <-ctx.Done():
+				}
+			}()
+			c.Run(ctx)
+			cancel()
+
+			select {
+			case <-c.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop ends periodic probing and waits for running probes to return
+func (c *Checker) Stop(ctx context.Context) error {
+	if c.stop == nil {
+		return nil
+	}
+	close(c.stop)
+
+	select {
+	case <-c.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Results returns the last result of each check in the order of the checks
+func (c *Checker) Results() []Result {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	results := make([]Result, 0, len(c.checks))
+	for _, check := range c.checks {
+		result, ok := c.results[check.Name]
+		if !ok {
+			result = Result{Name: check.Name, Group: check.Group, Critical: check.Critical, Status: StatusUnknown}
+		}
+		results = append(results, result)
+	}
+	return results
+}
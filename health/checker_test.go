@@ -0,0 +1,84 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	checker := NewChecker(time.Minute, time.Second,
+		Check{Name: "store", Critical: true, Probe: func(ctx context.Context) error { return nil }},
+		Check{Name: "cf.uaa", Group: "cf", Probe: func(ctx context.Context) error { return errors.New("unreachable") }},
+	)
+
+	results := checker.Results()
+	assert.Equal(t, StatusUnknown, results[0].Status)
+	assert.False(t, results[0].Up())
+
+	checker.Run(context.Background())
+	results = checker.Results()
+
+	assert.Equal(t, "store", results[0].Name)
+	assert.True(t, results[0].Up())
+	assert.True(t, results[0].Critical)
+	assert.False(t, results[0].CheckedAt.IsZero())
+
+	assert.Equal(t, "cf", results[1].Group)
+	assert.Equal(t, StatusDown, results[1].Status)
+	assert.Equal(t, "unreachable", results[1].Error)
+}
+
+func TestRunTimeout(t *testing.T) {
+	checker := NewChecker(time.Minute, 10*time.Millisecond,
+		Check{Name: "slow", Probe: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}},
+	)
+
+	checker.Run(context.Background())
+
+	assert.Equal(t, StatusDown, checker.Results()[0].Status)
+	assert.GreaterOrEqual(t, checker.Results()[0].LatencyMs, 10.0)
+}
+
+func TestStartAndStop(t *testing.T) {
+	var probes int32
+	checker := NewChecker(10*time.Millisecond, time.Second,
+		Check{Name: "store", Probe: func(ctx context.Context) error {
+			atomic.AddInt32(&probes, 1)
+			return nil
+		}},
+	)
+
+	checker.Start()
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&probes) >= 3 }, time.Second, time.Millisecond)
+	assert.NoError(t, checker.Stop(context.Background()))
+
+	stopped := atomic.LoadInt32(&probes)
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, stopped, atomic.LoadInt32(&probes))
+	assert.True(t, checker.Results()[0].Up())
+}
+
+func TestOnRun(t *testing.T) {
+	checker := NewChecker(time.Minute, time.Second,
+		Check{Name: "store", Probe: func(ctx context.Context) error { return nil }},
+	)
+
+	rounds := [][]Result{}
+	checker.OnRun(func(results []Result) {
+		rounds = append(rounds, results)
+	})
+
+	checker.Run(context.Background())
+	checker.Run(context.Background())
+
+	assert.Len(t, rounds, 2)
+	assert.True(t, rounds[1][0].Up())
+}
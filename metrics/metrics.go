@@ -0,0 +1,113 @@
+// Package metrics defines the Prometheus metrics of the broker and the
+// handler exposing them in Prometheus text format.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace string = "cf_api_broker"
+
+const (
+	// ComponentUAA labels calls to the UAA of a foundation
+	ComponentUAA string = "uaa"
+	// ComponentCC labels calls to the cloud controller of a foundation
+	ComponentCC string = "cc"
+)
+
+var (
+	registry = prometheus.NewRegistry()
+
+	// Requests counts HTTP requests by mux route name, method and status
+	Requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "status"})
+
+	// RequestDuration observes HTTP request latencies by mux route name and status
+	RequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latencies by route and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "status"})
+
+	// AsyncOperationsInFlight counts running asynchronous operations by type
+	AsyncOperationsInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "async_operations_in_flight",
+		Help:      "Asynchronous operations currently running by operation.",
+	}, []string{"operation"})
+
+	// Instances counts service instances by foundation and plan
+	Instances = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "service_instances",
+		Help:      "Service instances by foundation and plan.",
+	}, []string{"foundation", "plan"})
+
+	// FoundationCallDuration observes latencies of UAA and CC calls by foundation
+	FoundationCallDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "foundation_call_duration_seconds",
+		Help:      "Latencies of UAA and cloud controller calls by foundation.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"foundation", "component"})
+
+	// FoundationCallErrors counts failed UAA and CC calls by foundation
+	FoundationCallErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "foundation_call_errors_total",
+		Help:      "Failed UAA and cloud controller calls by foundation.",
+	}, []string{"foundation", "component"})
+
+	// FoundationAvailability is the share of successful probes per foundation
+	// within the monitoring window
+	FoundationAvailability = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "foundation_availability_ratio",
+		Help:      "Share of successful probes within the monitoring window by foundation.",
+	}, []string{"foundation"})
+
+	// FoundationState is 1 for the current state of a foundation and 0 for
+	// all other states
+	FoundationState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "foundation_state",
+		Help:      "Current state of a foundation, 1 for the active state.",
+	}, []string{"foundation", "state"})
+)
+
+func init() {
+	registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		Requests,
+		RequestDuration,
+		AsyncOperationsInFlight,
+		Instances,
+		FoundationCallDuration,
+		FoundationCallErrors,
+		FoundationAvailability,
+		FoundationState,
+	)
+}
+
+// Handler serves all broker metrics in Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// ObserveFoundationCall records latency and outcome of a call to the UAA or
+// cloud controller of a foundation
+func ObserveFoundationCall(foundation string, component string, start time.Time, err error) {
+	FoundationCallDuration.WithLabelValues(foundation, component).Observe(time.Since(start).Seconds())
+	if err != nil {
+		FoundationCallErrors.WithLabelValues(foundation, component).Inc()
+	}
+}
@@ -0,0 +1,33 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObserveFoundationCall(t *testing.T) {
+	ObserveFoundationCall("cf-eu10", ComponentUAA, time.Now(), nil)
+	ObserveFoundationCall("cf-eu10", ComponentUAA, time.Now(), errors.New("failed"))
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(FoundationCallErrors.WithLabelValues("cf-eu10", ComponentUAA)))
+	assert.Equal(t, 0.0, testutil.ToFloat64(FoundationCallErrors.WithLabelValues("cf-eu10", ComponentCC)))
+}
+
+func TestHandler(t *testing.T) {
+	Instances.WithLabelValues("cf-eu10", "cloudcontroller").Set(3)
+
+	request, _ := http.NewRequest(http.MethodGet, "/metrics", nil)
+	response := httptest.NewRecorder()
+
+	Handler().ServeHTTP(response, request)
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Contains(t, response.Body.String(), `cf_api_broker_service_instances{foundation="cf-eu10",plan="cloudcontroller"} 3`)
+	assert.Contains(t, response.Body.String(), "go_goroutines")
+}
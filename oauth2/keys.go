@@ -0,0 +1,218 @@
+package oauth2
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultRefreshInterval    time.Duration = time.Hour
+	defaultMinRefreshInterval time.Duration = time.Minute
+)
+
+// ErrUnknownKey is returned if no key for a token could be found
+var ErrUnknownKey = errors.New("no key found to verify token")
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+// keyCache holds static keys and keys fetched from a JWKS endpoint. JWKS keys
+// are fetched again after refreshInterval or if a token references an
+// unknown key id, which handles key rotation of the authorization server.
+type keyCache struct {
+	jwksURL            string
+	client             *http.Client
+	refreshInterval    time.Duration
+	minRefreshInterval time.Duration
+
+	staticKeys []crypto.PublicKey
+
+	mutex     sync.Mutex
+	jwksKeys  map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+func (c *keyCache) lookup(ctx context.Context, kid string) ([]crypto.PublicKey, error) {
+	if c.jwksURL != "" {
+		key, err := c.lookupJWKS(ctx, kid)
+		if err == nil {
+			return []crypto.PublicKey{key}, nil
+		}
+		if len(c.staticKeys) == 0 {
+			return nil, err
+		}
+	}
+
+	if len(c.staticKeys) == 0 {
+		return nil, ErrUnknownKey
+	}
+	return c.staticKeys, nil
+}
+
+func (c *keyCache) lookupJWKS(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	key, found := c.jwksKeys[kid]
+
+	expired := now.Sub(c.fetchedAt) > c.refreshInterval
+	missing := !found && now.Sub(c.fetchedAt) > c.minRefreshInterval
+
+	if c.jwksKeys == nil || expired || missing {
+		keys, err := c.fetch(ctx)
+		if err != nil {
+			if found {
+				// keep serving the cached key while the endpoint is not reachable
+				return key, nil
+			}
+			return nil, err
+		}
+		c.jwksKeys = keys
+		c.fetchedAt = now
+		key, found = c.jwksKeys[kid]
+	}
+
+	if !found {
+		return nil, ErrUnknownKey
+	}
+	return key, nil
+}
+
+func (c *keyCache) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, c.jwksURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("fetching JWKS from %v failed: %v", c.jwksURL, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching JWKS from %v failed: HTTP status %v", c.jwksURL, response.StatusCode)
+	}
+
+	var set jsonWebKeySet
+	if err := json.NewDecoder(response.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("parsing JWKS from %v failed: %v", c.jwksURL, err)
+	}
+
+	// keys the broker cannot use are skipped, the set fails only if none
+	// remains
+	keys := map[string]crypto.PublicKey{}
+	var skipped error
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			log.Warnf("Skipping key %v of JWKS from %v: %v", jwk.Kid, c.jwksURL, err)
+			skipped = err
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	if len(keys) == 0 && skipped != nil {
+		return nil, fmt.Errorf("JWKS from %v has no usable key: %v", c.jwksURL, skipped)
+	}
+
+	return keys, nil
+}
+
+func (jwk jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeBigInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %v of key %v", jwk.Crv, jwk.Kid)
+		}
+		x, err := decodeBigInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %v of key %v", jwk.Kty, jwk.Kid)
+	}
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+// ParsePublicKey parses a PEM encoded PKIX public key or certificate
+func ParsePublicKey(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	}
+}
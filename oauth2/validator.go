@@ -0,0 +1,285 @@
+// Package oauth2 validates JWT bearer tokens issued by an OAuth2
+// authorization server such as UAA.
+package oauth2
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const defaultLeeway time.Duration = 30 * time.Second
+
+var (
+	// ErrMalformedToken is returned for tokens that are not a signed JWT
+	ErrMalformedToken = errors.New("malformed token")
+	// ErrInvalidSignature is returned if the token signature does not verify
+	ErrInvalidSignature = errors.New("invalid token signature")
+	// ErrExpired is returned for tokens used outside their validity period
+	ErrExpired = errors.New("token expired or not yet valid")
+	// ErrInvalidIssuer is returned for tokens of a foreign issuer
+	ErrInvalidIssuer = errors.New("invalid token issuer")
+	// ErrInvalidAudience is returned for tokens not issued for the broker
+	ErrInvalidAudience = errors.New("invalid token audience")
+	// ErrInsufficientScope is returned if the token lacks required scopes
+	ErrInsufficientScope = errors.New("insufficient token scope")
+)
+
+// Options configure a Validator. Either JWKSURL or StaticKeys must be set.
+type Options struct {
+	JWKSURL         string
+	StaticKeys      []crypto.PublicKey
+	Issuer          string
+	Audience        string
+	Scopes          []string
+	RefreshInterval time.Duration
+	HTTPClient      *http.Client
+}
+
+// Claims are the validated token claims relevant for the broker
+type Claims struct {
+	Subject   string
+	Issuer    string
+	Audience  []string
+	Scopes    []string
+	ClientID  string
+	UserName  string
+	ExpiresAt time.Time
+}
+
+// Validator validates JWT bearer tokens
+type Validator struct {
+	issuer   string
+	audience string
+	scopes   []string
+	leeway   time.Duration
+	keys     *keyCache
+	now      func() time.Time
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// stringList unmarshals a JSON string or array of strings. Space separated
+// strings are split, as used by the scope claim of RFC 8693.
+type stringList []string
+
+func (l *stringList) UnmarshalJSON(data []byte) error {
+	var list []string
+	if err := json.Unmarshal(data, &list); err == nil {
+		*l = list
+		return nil
+	}
+
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	*l = strings.Fields(value)
+	return nil
+}
+
+type payload struct {
+	Subject   string     `json:"sub"`
+	Issuer    string     `json:"iss"`
+	Audience  stringList `json:"aud"`
+	Scope     stringList `json:"scope"`
+	Scp       stringList `json:"scp"`
+	ClientID  string     `json:"client_id"`
+	UserName  string     `json:"user_name"`
+	ExpiresAt *int64     `json:"exp"`
+	NotBefore *int64     `json:"nbf"`
+}
+
+// NewValidator creates a validator
+func NewValidator(options Options) (*Validator, error) {
+	if options.JWKSURL == "" && len(options.StaticKeys) == 0 {
+		return nil, errors.New("either a JWKS URL or static keys are required")
+	}
+
+	client := options.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	refreshInterval := options.RefreshInterval
+	if refreshInterval <= 0 {
+		refreshInterval = defaultRefreshInterval
+	}
+
+	return &Validator{
+		issuer:   options.Issuer,
+		audience: options.Audience,
+		scopes:   options.Scopes,
+		leeway:   defaultLeeway,
+		now:      time.Now,
+		keys: &keyCache{
+			jwksURL:            options.JWKSURL,
+			client:             client,
+			refreshInterval:    refreshInterval,
+			minRefreshInterval: defaultMinRefreshInterval,
+			staticKeys:         options.StaticKeys,
+		},
+	}, nil
+}
+
+// Validate verifies signature, validity period, issuer, audience and scopes
+// of a token and returns its claims
+func (v *Validator) Validate(ctx context.Context, token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformedToken
+	}
+
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, ErrMalformedToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+
+	keys, err := v.keys.lookup(ctx, h.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	verified := false
+	for _, key := range keys {
+		if err := verify(h.Alg, key, signed, signature); err == nil {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, ErrInvalidSignature
+	}
+
+	var p payload
+	if err := decodeSegment(parts[1], &p); err != nil {
+		return nil, ErrMalformedToken
+	}
+
+	return v.validateClaims(&p)
+}
+
+func (v *Validator) validateClaims(p *payload) (*Claims, error) {
+	now := v.now()
+
+	if p.ExpiresAt == nil || now.After(time.Unix(*p.ExpiresAt, 0).Add(v.leeway)) {
+		return nil, ErrExpired
+	}
+	if p.NotBefore != nil && now.Add(v.leeway).Before(time.Unix(*p.NotBefore, 0)) {
+		return nil, ErrExpired
+	}
+
+	if v.issuer != "" && p.Issuer != v.issuer {
+		return nil, ErrInvalidIssuer
+	}
+	if v.audience != "" && !contains(p.Audience, v.audience) {
+		return nil, ErrInvalidAudience
+	}
+
+	scopes := append(append([]string{}, p.Scope...), p.Scp...)
+	for _, scope := range v.scopes {
+		if !contains(scopes, scope) {
+			return nil, ErrInsufficientScope
+		}
+	}
+
+	return &Claims{
+		Subject:   p.Subject,
+		Issuer:    p.Issuer,
+		Audience:  p.Audience,
+		Scopes:    scopes,
+		ClientID:  p.ClientID,
+		UserName:  p.UserName,
+		ExpiresAt: time.Unix(*p.ExpiresAt, 0),
+	}, nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func verify(alg string, key crypto.PublicKey, signed []byte, signature []byte) error {
+	if len(alg) != 5 {
+		return fmt.Errorf("unsupported algorithm %v", alg)
+	}
+
+	var hashFunc crypto.Hash
+	var h hash.Hash
+
+	switch alg[2:] {
+	case "256":
+		hashFunc, h = crypto.SHA256, sha256.New()
+	case "384":
+		hashFunc, h = crypto.SHA384, sha512.New384()
+	case "512":
+		hashFunc, h = crypto.SHA512, sha512.New()
+	}
+	if h == nil {
+		return fmt.Errorf("unsupported algorithm %v", alg)
+	}
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch alg[:2] {
+	case "RS":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return ErrInvalidSignature
+		}
+		return rsa.VerifyPKCS1v15(rsaKey, hashFunc, digest, signature)
+	case "PS":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return ErrInvalidSignature
+		}
+		return rsa.VerifyPSS(rsaKey, hashFunc, digest, signature, nil)
+	case "ES":
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(signature)%2 != 0 {
+			return ErrInvalidSignature
+		}
+		size := len(signature) / 2
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(ecKey, digest, r, s) {
+			return ErrInvalidSignature
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported algorithm %v", alg)
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
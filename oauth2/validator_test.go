@@ -0,0 +1,231 @@
+package oauth2
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func sign(t *testing.T, key crypto.Signer, kid string, claims map[string]interface{}) string {
+	alg := "RS256"
+	if _, ok := key.(*ecdsa.PrivateKey); ok {
+		alg = "ES256"
+	}
+
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		s, err := rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		assert.Nil(t, err)
+		signature = s
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		assert.Nil(t, err)
+		signature = append(padded(r, 32), padded(s, 32)...)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func padded(i *big.Int, size int) []byte {
+	b := i.Bytes()
+	return append(make([]byte, size-len(b)), b...)
+}
+
+func validClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"sub":       "platform",
+		"iss":       "https://uaa.example.com/oauth/token",
+		"aud":       []string{"cf-api-broker"},
+		"scope":     []string{"cf-api-broker.platform"},
+		"client_id": "cf",
+		"exp":       time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func jwks(keys map[string]*rsa.PrivateKey) []byte {
+	set := jsonWebKeySet{}
+	for kid, key := range keys {
+		set.Keys = append(set.Keys, jsonWebKey{
+			Kty: "RSA",
+			Kid: kid,
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		})
+	}
+	data, _ := json.Marshal(set)
+	return data
+}
+
+func TestValidateStaticKeys(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	validator, err := NewValidator(Options{
+		StaticKeys: []crypto.PublicKey{&rsaKey.PublicKey, &ecKey.PublicKey},
+		Issuer:     "https://uaa.example.com/oauth/token",
+		Audience:   "cf-api-broker",
+		Scopes:     []string{"cf-api-broker.platform"},
+	})
+	assert.Nil(t, err)
+
+	claims, err := validator.Validate(context.Background(), sign(t, rsaKey, "", validClaims()))
+	assert.Nil(t, err)
+	assert.Equal(t, "platform", claims.Subject)
+	assert.Equal(t, "cf", claims.ClientID)
+
+	_, err = validator.Validate(context.Background(), sign(t, ecKey, "", validClaims()))
+	assert.Nil(t, err)
+}
+
+func TestValidateRejectsInvalidTokens(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	validator, _ := NewValidator(Options{
+		StaticKeys: []crypto.PublicKey{&key.PublicKey},
+		Issuer:     "https://uaa.example.com/oauth/token",
+		Audience:   "cf-api-broker",
+		Scopes:     []string{"cf-api-broker.platform"},
+	})
+
+	_, err := validator.Validate(context.Background(), "abc")
+	assert.Equal(t, ErrMalformedToken, err)
+
+	_, err = validator.Validate(context.Background(), sign(t, otherKey, "", validClaims()))
+	assert.Equal(t, ErrInvalidSignature, err)
+
+	claims := validClaims()
+	claims["exp"] = time.Now().Add(-time.Hour).Unix()
+	_, err = validator.Validate(context.Background(), sign(t, key, "", claims))
+	assert.Equal(t, ErrExpired, err)
+
+	claims = validClaims()
+	claims["nbf"] = time.Now().Add(time.Hour).Unix()
+	_, err = validator.Validate(context.Background(), sign(t, key, "", claims))
+	assert.Equal(t, ErrExpired, err)
+
+	claims = validClaims()
+	claims["iss"] = "https://evil.example.com"
+	_, err = validator.Validate(context.Background(), sign(t, key, "", claims))
+	assert.Equal(t, ErrInvalidIssuer, err)
+
+	claims = validClaims()
+	claims["aud"] = "other"
+	_, err = validator.Validate(context.Background(), sign(t, key, "", claims))
+	assert.Equal(t, ErrInvalidAudience, err)
+
+	claims = validClaims()
+	claims["scope"] = "openid cloud_controller.read"
+	_, err = validator.Validate(context.Background(), sign(t, key, "", claims))
+	assert.Equal(t, ErrInsufficientScope, err)
+}
+
+func TestValidateRejectsUnsignedToken(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	validator, _ := NewValidator(Options{StaticKeys: []crypto.PublicKey{&key.PublicKey}})
+
+	header, _ := json.Marshal(map[string]string{"alg": "none"})
+	payload, _ := json.Marshal(validClaims())
+	token := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload) + "."
+
+	_, err := validator.Validate(context.Background(), token)
+	assert.Equal(t, ErrInvalidSignature, err)
+}
+
+func TestValidateJWKSRotation(t *testing.T) {
+	oldKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	newKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	keys := atomic.Value{}
+	keys.Store(map[string]*rsa.PrivateKey{"old": oldKey})
+	var fetches int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		w.Write(jwks(keys.Load().(map[string]*rsa.PrivateKey)))
+	}))
+	defer server.Close()
+
+	validator, _ := NewValidator(Options{JWKSURL: server.URL})
+	validator.keys.minRefreshInterval = 0
+
+	_, err := validator.Validate(context.Background(), sign(t, oldKey, "old", validClaims()))
+	assert.Nil(t, err)
+	_, err = validator.Validate(context.Background(), sign(t, oldKey, "old", validClaims()))
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fetches))
+
+	keys.Store(map[string]*rsa.PrivateKey{"new": newKey})
+
+	_, err = validator.Validate(context.Background(), sign(t, newKey, "new", validClaims()))
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&fetches))
+
+	_, err = validator.Validate(context.Background(), sign(t, oldKey, "unknown", validClaims()))
+	assert.Equal(t, ErrUnknownKey, err)
+}
+
+func TestValidateJWKSSkipsUnusableKeys(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	set := jsonWebKeySet{}
+	assert.NoError(t, json.Unmarshal(jwks(map[string]*rsa.PrivateKey{"rsa": key}), &set))
+	set.Keys = append(set.Keys,
+		jsonWebKey{Kty: "oct", Kid: "hmac", Use: "sig"},
+		jsonWebKey{Kty: "OKP", Kid: "ed25519", Crv: "Ed25519"},
+		jsonWebKey{Kty: "EC", Kid: "secp256k1", Crv: "secp256k1"},
+	)
+	published := atomic.Value{}
+	published.Store(set)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := json.Marshal(published.Load())
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	validator, _ := NewValidator(Options{JWKSURL: server.URL})
+	validator.keys.minRefreshInterval = 0
+
+	_, err := validator.Validate(context.Background(), sign(t, key, "rsa", validClaims()))
+	assert.Nil(t, err, "unusable keys do not break the set")
+
+	published.Store(jsonWebKeySet{Keys: set.Keys[1:]})
+	_, err = validator.keys.fetch(context.Background())
+	assert.Error(t, err, "no usable key")
+}
+
+func TestParsePublicKey(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	data := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	parsed, err := ParsePublicKey(data)
+	assert.Nil(t, err)
+	assert.Equal(t, key.PublicKey.N, parsed.(*rsa.PublicKey).N)
+
+	_, err = ParsePublicKey([]byte("no pem"))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,56 @@
+// Package placement selects the foundation a new service instance is
+// created on.
+package placement
+
+import (
+	"errors"
+	"sort"
+)
+
+// ErrNoFoundation is returned if no candidate can take new instances
+var ErrNoFoundation = errors.New("no foundation available for placement")
+
+// Candidate is a foundation that may receive new instances
+type Candidate struct {
+	Name      string
+	Labels    []string
+	Instances int
+}
+
+// Select returns the candidate with the fewest instances among those having
+// all labels, ties are broken by name to keep placement deterministic
+func Select(candidates []Candidate, labels []string) (Candidate, error) {
+	sorted := []Candidate{}
+	for _, candidate := range candidates {
+		if hasLabels(candidate, labels) {
+			sorted = append(sorted, candidate)
+		}
+	}
+	if len(sorted) == 0 {
+		return Candidate{}, ErrNoFoundation
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Instances != sorted[j].Instances {
+			return sorted[i].Instances < sorted[j].Instances
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+	return sorted[0], nil
+}
+
+func hasLabels(candidate Candidate, labels []string) bool {
+	for _, label := range labels {
+		found := false
+		for _, l := range candidate.Labels {
+			if l == label {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
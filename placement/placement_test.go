@@ -0,0 +1,46 @@
+package placement
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelect(t *testing.T) {
+	selected, err := Select([]Candidate{
+		{Name: "cf-c", Instances: 1},
+		{Name: "cf-b", Instances: 0},
+		{Name: "cf-a", Instances: 2},
+	}, nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "cf-b", selected.Name)
+}
+
+func TestSelectTieBreak(t *testing.T) {
+	selected, err := Select([]Candidate{{Name: "cf-b"}, {Name: "cf-a"}}, nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "cf-a", selected.Name)
+}
+
+func TestSelectNoCandidates(t *testing.T) {
+	_, err := Select(nil, nil)
+
+	assert.Equal(t, ErrNoFoundation, err)
+}
+
+func TestSelectLabels(t *testing.T) {
+	candidates := []Candidate{
+		{Name: "cf-eu10", Labels: []string{"master", "aws"}},
+		{Name: "cf-eu10-001", Labels: []string{"scaleout", "aws"}, Instances: 3},
+		{Name: "cf-eu10-002", Labels: []string{"scaleout", "aws"}, Instances: 5},
+	}
+
+	selected, err := Select(candidates, []string{"aws", "scaleout"})
+	assert.NoError(t, err)
+	assert.Equal(t, "cf-eu10-001", selected.Name)
+
+	_, err = Select(candidates, []string{"azure"})
+	assert.Equal(t, ErrNoFoundation, err)
+}
@@ -0,0 +1,88 @@
+// Package ratelimit provides keyed token bucket rate limiting and lockout of
+// clients after repeated authentication failures.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const cleanupInterval time.Duration = time.Minute
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter is a token bucket rate limiter with one bucket per key. Each bucket
+// holds up to burst tokens and is refilled with rate tokens per second.
+type Limiter struct {
+	rate  float64
+	burst float64
+	now   func() time.Time
+
+	mutex       sync.Mutex
+	buckets     map[string]*bucket
+	lastCleanup time.Time
+}
+
+// NewLimiter creates a limiter. A rate of zero or less disables limiting.
+func NewLimiter(rate float64, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &Limiter{
+		rate:    rate,
+		burst:   float64(burst),
+		now:     time.Now,
+		buckets: map[string]*bucket{},
+	}
+}
+
+// Allow takes a token from the bucket of key. If the bucket is empty it
+// returns false and the duration until the next token is available.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	if l == nil || l.rate <= 0 {
+		return true, 0
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	l.cleanup(now)
+
+	b, found := l.buckets[key]
+	if !found {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+		return false, wait
+	}
+
+	b.tokens--
+	return true, 0
+}
+
+// cleanup removes buckets that are full again, they behave like new ones
+func (l *Limiter) cleanup(now time.Time) {
+	if now.Sub(l.lastCleanup) < cleanupInterval {
+		return
+	}
+	l.lastCleanup = now
+
+	full := time.Duration(l.burst / l.rate * float64(time.Second))
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > full {
+			delete(l.buckets, key)
+		}
+	}
+}
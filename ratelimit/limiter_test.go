@@ -0,0 +1,58 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Now()
+	limiter := NewLimiter(2, 3)
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		ok, _ := limiter.Allow("a")
+		assert.True(t, ok)
+	}
+
+	ok, wait := limiter.Allow("a")
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, wait)
+
+	ok, _ = limiter.Allow("b")
+	assert.True(t, ok)
+
+	now = now.Add(500 * time.Millisecond)
+	ok, _ = limiter.Allow("a")
+	assert.True(t, ok)
+	ok, _ = limiter.Allow("a")
+	assert.False(t, ok)
+}
+
+func TestLimiterDisabled(t *testing.T) {
+	limiter := NewLimiter(0, 0)
+
+	for i := 0; i < 100; i++ {
+		ok, _ := limiter.Allow("a")
+		assert.True(t, ok)
+	}
+
+	var nilLimiter *Limiter
+	ok, _ := nilLimiter.Allow("a")
+	assert.True(t, ok)
+}
+
+func TestLimiterCleanup(t *testing.T) {
+	now := time.Now()
+	limiter := NewLimiter(1, 1)
+	limiter.now = func() time.Time { return now }
+
+	limiter.Allow("a")
+	assert.Len(t, limiter.buckets, 1)
+
+	now = now.Add(2 * cleanupInterval)
+	limiter.Allow("b")
+	assert.Len(t, limiter.buckets, 1)
+}
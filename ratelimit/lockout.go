@@ -0,0 +1,117 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+type failures struct {
+	count       int
+	last        time.Time
+	lockedUntil time.Time
+}
+
+// Lockout locks out keys after repeated failures. Once threshold failures
+// are reached each further failure doubles the lockout, starting with
+// lockout and capped at maxLockout. Failures are forgotten after maxLockout
+// without a new failure.
+type Lockout struct {
+	threshold  int
+	lockout    time.Duration
+	maxLockout time.Duration
+	now        func() time.Time
+
+	mutex       sync.Mutex
+	entries     map[string]*failures
+	lastCleanup time.Time
+}
+
+// NewLockout creates a lockout. A threshold of zero or less disables it.
+func NewLockout(threshold int, lockout time.Duration, maxLockout time.Duration) *Lockout {
+	if maxLockout < lockout {
+		maxLockout = lockout
+	}
+
+	return &Lockout{
+		threshold:  threshold,
+		lockout:    lockout,
+		maxLockout: maxLockout,
+		now:        time.Now,
+		entries:    map[string]*failures{},
+	}
+}
+
+// Locked checks whether key is locked out and returns the remaining lockout
+func (l *Lockout) Locked(key string) (bool, time.Duration) {
+	if l == nil || l.threshold <= 0 {
+		return false, 0
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	l.cleanup(now)
+
+	f, found := l.entries[key]
+	if !found || !now.Before(f.lockedUntil) {
+		return false, 0
+	}
+	return true, f.lockedUntil.Sub(now)
+}
+
+// Failure records a failure for key
+func (l *Lockout) Failure(key string) {
+	if l == nil || l.threshold <= 0 {
+		return
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	f, found := l.entries[key]
+	if !found || now.Sub(f.last) > l.maxLockout {
+		f = &failures{}
+		l.entries[key] = f
+	}
+
+	f.count++
+	f.last = now
+
+	if f.count >= l.threshold {
+		duration := l.lockout
+		for i := l.threshold; i < f.count && duration < l.maxLockout; i++ {
+			duration *= 2
+		}
+		if duration > l.maxLockout {
+			duration = l.maxLockout
+		}
+		f.lockedUntil = now.Add(duration)
+	}
+}
+
+// Success forgets the failures of key
+func (l *Lockout) Success(key string) {
+	if l == nil || l.threshold <= 0 {
+		return
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	delete(l.entries, key)
+}
+
+func (l *Lockout) cleanup(now time.Time) {
+	if now.Sub(l.lastCleanup) < cleanupInterval {
+		return
+	}
+	l.lastCleanup = now
+
+	for key, f := range l.entries {
+		if now.Sub(f.last) > l.maxLockout && !now.Before(f.lockedUntil) {
+			delete(l.entries, key)
+		}
+	}
+}
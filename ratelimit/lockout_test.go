@@ -0,0 +1,64 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockout(t *testing.T) {
+	now := time.Now()
+	lockout := NewLockout(3, time.Second, 4*time.Second)
+	lockout.now = func() time.Time { return now }
+
+	lockout.Failure("a")
+	lockout.Failure("a")
+	locked, _ := lockout.Locked("a")
+	assert.False(t, locked)
+
+	lockout.Failure("a")
+	locked, remaining := lockout.Locked("a")
+	assert.True(t, locked)
+	assert.Equal(t, time.Second, remaining)
+
+	lockout.Failure("a")
+	_, remaining = lockout.Locked("a")
+	assert.Equal(t, 2*time.Second, remaining)
+
+	lockout.Failure("a")
+	lockout.Failure("a")
+	_, remaining = lockout.Locked("a")
+	assert.Equal(t, 4*time.Second, remaining)
+
+	locked, _ = lockout.Locked("b")
+	assert.False(t, locked)
+
+	now = now.Add(4 * time.Second)
+	locked, _ = lockout.Locked("a")
+	assert.False(t, locked)
+}
+
+func TestLockoutSuccessResets(t *testing.T) {
+	lockout := NewLockout(2, time.Second, time.Minute)
+
+	lockout.Failure("a")
+	lockout.Success("a")
+	lockout.Failure("a")
+
+	locked, _ := lockout.Locked("a")
+	assert.False(t, locked)
+}
+
+func TestLockoutForgetsOldFailures(t *testing.T) {
+	now := time.Now()
+	lockout := NewLockout(2, time.Second, time.Minute)
+	lockout.now = func() time.Time { return now }
+
+	lockout.Failure("a")
+	now = now.Add(2 * time.Minute)
+	lockout.Failure("a")
+
+	locked, _ := lockout.Locked("a")
+	assert.False(t, locked)
+}
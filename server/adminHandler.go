@@ -0,0 +1,360 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sklevenz/cf-api-broker/config"
+	"github.com/sklevenz/cf-api-broker/store"
+)
+
+const (
+	defaultPerPage int = 50
+	maxPerPage     int = 500
+)
+
+// pagination describes the page of a list response
+type pagination struct {
+	TotalResults int `json:"total_results"`
+	TotalPages   int `json:"total_pages"`
+	Page         int `json:"page"`
+	PerPage      int `json:"per_page"`
+}
+
+// listResponse is a page of resources
+type listResponse struct {
+	Pagination pagination  `json:"pagination"`
+	Resources  interface{} `json:"resources"`
+}
+
+// adminBinding is a binding with the foundation and plan of its instance.
+// The client secret is never part of the admin view.
+type adminBinding struct {
+	ID               string                 `json:"id"`
+	InstanceID       string                 `json:"instance_id"`
+	PredecessorID    string                 `json:"predecessor_id,omitempty"`
+	Parameters       map[string]interface{} `json:"parameters,omitempty"`
+	ClientID         string                 `json:"client_id,omitempty"`
+	Role             string                 `json:"role,omitempty"`
+	Scopes           []string               `json:"scopes,omitempty"`
+	RotationRequired bool                   `json:"rotation_required,omitempty"`
+	SourceFoundation string                 `json:"source_foundation,omitempty"`
+	RetiredClients   []store.RetiredClient  `json:"retired_clients,omitempty"`
+	ExpiresAt        *time.Time             `json:"expires_at,omitempty"`
+	RenewBefore      *time.Time             `json:"renew_before,omitempty"`
+	State            string                 `json:"state"`
+	CreatedAt        time.Time              `json:"created_at"`
+	UpdatedAt        time.Time              `json:"updated_at"`
+	Foundation       string                 `json:"foundation,omitempty"`
+	PlanID           string                 `json:"plan_id,omitempty"`
+}
+
+func newAdminBinding(binding *store.Binding, instance *store.Instance) adminBinding {
+	return adminBinding{
+		ID:               binding.ID,
+		InstanceID:       binding.InstanceID,
+		PredecessorID:    binding.PredecessorID,
+		Parameters:       binding.Parameters,
+		ClientID:         binding.ClientID,
+		Role:             binding.Role,
+		Scopes:           binding.Scopes,
+		RotationRequired: binding.RotationRequired,
+		SourceFoundation: binding.SourceFoundation,
+		RetiredClients:   binding.RetiredClients,
+		ExpiresAt:        optionalTime(binding.ExpiresAt),
+		RenewBefore:      optionalTime(binding.RenewBefore),
+		State:            binding.State,
+		CreatedAt:        binding.CreatedAt,
+		UpdatedAt:        binding.UpdatedAt,
+		Foundation:       instance.Foundation,
+		PlanID:           instance.PlanID,
+	}
+}
+
+// optionalTime returns nil for the zero time, which is left out of JSON
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// foundationSummary describes a configured foundation without credentials
+type foundationSummary struct {
+	Name         string         `json:"name"`
+	APIURL       string         `json:"api_url"`
+	UAAURL       string         `json:"uaa_url"`
+	Labels       []string       `json:"labels"`
+	State        string         `json:"state"`
+	Availability float64        `json:"availability"`
+	Samples      int            `json:"samples"`
+	LastCheck    time.Time      `json:"last_check,omitempty"`
+	Cordoned     bool           `json:"cordoned"`
+	Placeable    bool           `json:"placeable"`
+	Instances    int            `json:"instances"`
+	Bindings     int            `json:"bindings"`
+	Plans        map[string]int `json:"plans"`
+}
+
+// paginate reads the page and per_page query parameters and returns the
+// range of total results to return
+func paginate(r *http.Request, total int) (int, int, pagination, error) {
+	p := pagination{TotalResults: total, Page: 1, PerPage: defaultPerPage}
+	values := r.URL.Query()
+
+	if value := values.Get("page"); value != "" {
+		page, err := strconv.Atoi(value)
+		if err != nil || page < 1 {
+			return 0, 0, p, fmt.Errorf("invalid page: %v", value)
+		}
+		p.Page = page
+	}
+	if value := values.Get("per_page"); value != "" {
+		perPage, err := strconv.Atoi(value)
+		if err != nil || perPage < 1 || perPage > maxPerPage {
+			return 0, 0, p, fmt.Errorf("invalid per_page, must be between 1 and %v: %v", maxPerPage, value)
+		}
+		p.PerPage = perPage
+	}
+
+	p.TotalPages = (total + p.PerPage - 1) / p.PerPage
+	start := (p.Page - 1) * p.PerPage
+	if start > total {
+		start = total
+	}
+	end := start + p.PerPage
+	if end > total {
+		end = total
+	}
+	return start, end, p, nil
+}
+
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	writeJSONStatus(w, http.StatusOK, value)
+}
+
+func writeJSONStatus(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set(headerContentType, contentTypeJSON)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+// instanceMatches applies the instance filters foundation, plan_id,
+// platform, organization_guid and space_guid of a request
+func instanceMatches(r *http.Request, instance *store.Instance) bool {
+	values := r.URL.Query()
+	return (values.Get("foundation") == "" || values.Get("foundation") == instance.Foundation) &&
+		(values.Get("plan_id") == "" || values.Get("plan_id") == instance.PlanID) &&
+		(values.Get("platform") == "" || values.Get("platform") == instance.Platform) &&
+		(values.Get("organization_guid") == "" || values.Get("organization_guid") == instance.OrganizationGUID) &&
+		(values.Get("space_guid") == "" || values.Get("space_guid") == instance.SpaceGUID)
+}
+
+// instancesHandler lists instances filtered by foundation, plan_id,
+// platform, organization_guid, space_guid and state
+func instancesHandler(w http.ResponseWriter, r *http.Request) {
+	instances, err := instanceStore.ListInstances(r.Context())
+	if err != nil {
+		handleHTTPError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	state := r.URL.Query().Get("state")
+	selected := []*store.Instance{}
+	for _, instance := range instances {
+		if instanceMatches(r, instance) && (state == "" || state == instance.State) {
+			selected = append(selected, instance)
+		}
+	}
+
+	start, end, p, err := paginate(r, len(selected))
+	if err != nil {
+		handleHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, listResponse{Pagination: p, Resources: selected[start:end]})
+}
+
+// instanceHandler returns one instance
+func instanceHandler(w http.ResponseWriter, r *http.Request) {
+	instance, err := instanceStore.GetInstance(r.Context(), mux.Vars(r)["instance_id"])
+	if errors.Is(err, store.ErrNotFound) {
+		handleHTTPError(w, http.StatusNotFound, fmt.Errorf("instance %v not found", mux.Vars(r)["instance_id"]))
+		return
+	}
+	if err != nil {
+		handleHTTPError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, instance)
+}
+
+// instanceOperationsHandler returns the operation history of an instance,
+// which is kept after the instance is deprovisioned
+func instanceOperationsHandler(w http.ResponseWriter, r *http.Request) {
+	instanceID := mux.Vars(r)["instance_id"]
+	operations, err := instanceStore.ListOperations(r.Context(), instanceID)
+	if err != nil {
+		handleHTTPError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if len(operations) == 0 {
+		if _, err := instanceStore.GetInstance(r.Context(), instanceID); errors.Is(err, store.ErrNotFound) {
+			handleHTTPError(w, http.StatusNotFound, fmt.Errorf("instance %v not found", instanceID))
+			return
+		}
+	}
+
+	start, end, p, err := paginate(r, len(operations))
+	if err != nil {
+		handleHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, listResponse{Pagination: p, Resources: operations[start:end]})
+}
+
+// bindingsHandler lists bindings filtered by instance_id, state, expired and
+// the instance filters foundation, plan_id, platform, organization_guid and
+// space_guid.
+// With expired=true bindings past their expiry are listed, whether their
+// credentials were revoked yet or not.
+func bindingsHandler(w http.ResponseWriter, r *http.Request) {
+	bindings, err := instanceStore.ListBindings(r.Context())
+	if err != nil {
+		handleHTTPError(w, http.StatusInternalServerError, err)
+		return
+	}
+	instances, err := instanceStore.ListInstances(r.Context())
+	if err != nil {
+		handleHTTPError(w, http.StatusInternalServerError, err)
+		return
+	}
+	byID := map[string]*store.Instance{}
+	for _, instance := range instances {
+		byID[instance.ID] = instance
+	}
+
+	values := r.URL.Query()
+	expired := values.Get("expired") == "true"
+	now := time.Now()
+	selected := []adminBinding{}
+	for _, binding := range bindings {
+		instance, ok := byID[binding.InstanceID]
+		if !ok {
+			instance = &store.Instance{ID: binding.InstanceID}
+		}
+		if (values.Get("instance_id") != "" && values.Get("instance_id") != binding.InstanceID) ||
+			(values.Get("state") != "" && values.Get("state") != binding.State) ||
+			(expired && !binding.Expired(now)) ||
+			!instanceMatches(r, instance) {
+			continue
+		}
+		selected = append(selected, newAdminBinding(binding, instance))
+	}
+
+	start, end, p, err := paginate(r, len(selected))
+	if err != nil {
+		handleHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, listResponse{Pagination: p, Resources: selected[start:end]})
+}
+
+// foundationSummaries returns the configured foundations with their
+// monitored availability and the instances and bindings placed on them
+func foundationSummaries(r *http.Request) ([]foundationSummary, error) {
+	instances, err := instanceStore.ListInstances(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	bindings, err := instanceStore.ListBindings(r.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	foundationOf := map[string]string{}
+	instanceCounts := map[string]int{}
+	planCounts := map[string]map[string]int{}
+	for _, instance := range instances {
+		foundationOf[instance.ID] = instance.Foundation
+		instanceCounts[instance.Foundation]++
+		if planCounts[instance.Foundation] == nil {
+			planCounts[instance.Foundation] = map[string]int{}
+		}
+		planCounts[instance.Foundation][instance.PlanID]++
+	}
+	bindingCounts := map[string]int{}
+	for _, binding := range bindings {
+		bindingCounts[foundationOf[binding.InstanceID]]++
+	}
+
+	cfs := config.Get().CloudFoundries
+	names := make([]string, 0, len(cfs))
+	for name := range cfs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	foundations := []foundationSummary{}
+	for _, name := range names {
+		status := foundationMonitor.Status(name)
+		labels := cfs[name].Labels
+		if labels == nil {
+			labels = []string{}
+		}
+		plans := planCounts[name]
+		if plans == nil {
+			plans = map[string]int{}
+		}
+		foundations = append(foundations, foundationSummary{
+			Name:         name,
+			APIURL:       cfs[name].APIURL,
+			UAAURL:       cfs[name].UAAURL,
+			Labels:       labels,
+			State:        status.State,
+			Availability: status.Availability,
+			Samples:      status.Samples,
+			LastCheck:    status.LastCheck,
+			Cordoned:     isCordoned(name),
+			Placeable:    status.Placeable() && !isCordoned(name),
+			Instances:    instanceCounts[name],
+			Bindings:     bindingCounts[name],
+			Plans:        plans,
+		})
+	}
+	return foundations, nil
+}
+
+// foundationsHandler returns summaries of all configured foundations
+func foundationsHandler(w http.ResponseWriter, r *http.Request) {
+	foundations, err := foundationSummaries(r)
+	if err != nil {
+		handleHTTPError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, map[string][]foundationSummary{"foundations": foundations})
+}
+
+// foundationHandler returns the summary of one foundation
+func foundationHandler(w http.ResponseWriter, r *http.Request) {
+	foundations, err := foundationSummaries(r)
+	if err != nil {
+		handleHTTPError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	name := mux.Vars(r)["foundation"]
+	for _, foundation := range foundations {
+		if foundation.Name == name {
+			writeJSON(w, foundation)
+			return
+		}
+	}
+	handleHTTPError(w, http.StatusNotFound, fmt.Errorf("foundation %v not found", name))
+}
@@ -0,0 +1,228 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sklevenz/cf-api-broker/foundation"
+	"github.com/sklevenz/cf-api-broker/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func getAdmin(t *testing.T, path string, result interface{}) int {
+	request, _ := http.NewRequest(http.MethodGet, path, nil)
+	request.SetBasicAuth("admin", "admin")
+	response := httptest.NewRecorder()
+	NewRouter(staticDir).ServeHTTP(response, request)
+
+	if result != nil && response.Code == http.StatusOK {
+		assert.Nil(t, json.Unmarshal(response.Body.Bytes(), result))
+	}
+	return response.Code
+}
+
+func TestFoundations(t *testing.T) {
+	defer useMonitor(foundation.NewMonitor(2, 0.9, 0.5))()
+	foundationMonitor.Observe("cf-eu10-001", true)
+	foundationMonitor.Observe("cf-eu10-002", false)
+
+	result := map[string][]foundationSummary{}
+	assert.Equal(t, http.StatusOK, getAdmin(t, "/admin/v1/foundations/", &result))
+
+	foundations := result["foundations"]
+	assert.Len(t, foundations, 3)
+	assert.Equal(t, "cf-eu10", foundations[0].Name)
+	assert.Equal(t, foundation.StateUnknown, foundations[0].State)
+	assert.True(t, foundations[0].Placeable)
+	assert.Equal(t, "https://api.cf.eu10.hana.ondemand.com", foundations[0].APIURL)
+	assert.Equal(t, []string{"master", "aws"}, foundations[0].Labels)
+	assert.Equal(t, foundation.StateAvailable, foundations[1].State)
+	assert.Equal(t, foundation.StateUnavailable, foundations[2].State)
+	assert.False(t, foundations[2].Placeable)
+}
+
+func TestFoundationsHideCredentials(t *testing.T) {
+	request, _ := http.NewRequest(http.MethodGet, "/admin/v1/foundations/", nil)
+	request.SetBasicAuth("admin", "admin")
+	response := httptest.NewRecorder()
+	NewRouter(staticDir).ServeHTTP(response, request)
+
+	assert.NotContains(t, response.Body.String(), "admin-eu10")
+	assert.NotContains(t, response.Body.String(), "password")
+}
+
+func TestFoundationsRequireAdmin(t *testing.T) {
+	request, _ := http.NewRequest(http.MethodGet, "/admin/v1/foundations/", nil)
+	request.SetBasicAuth("username", "password")
+	response := httptest.NewRecorder()
+	NewRouter(staticDir).ServeHTTP(response, request)
+
+	assert.Equal(t, http.StatusUnauthorized, response.Code)
+}
+
+func seedStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	for _, instance := range []*store.Instance{
+		{ID: "i1", PlanID: "cloudcontroller", Foundation: "cf-eu10", OrganizationGUID: "org-a", SpaceGUID: "space-a", State: store.StateSucceeded},
+		{ID: "i2", PlanID: "cloudcontroller", Foundation: "cf-eu10-001", OrganizationGUID: "org-a", SpaceGUID: "space-b", State: store.StateSucceeded},
+		{ID: "i3", PlanID: "other", Foundation: "cf-eu10-001", OrganizationGUID: "org-b", SpaceGUID: "space-c", State: store.StateFailed},
+	} {
+		assert.NoError(t, instanceStore.PutInstance(ctx, instance))
+	}
+	for _, binding := range []*store.Binding{
+		{ID: "b1", InstanceID: "i1", ClientID: "cf-api-broker-b1", ClientSecret: "TOPSECRET", State: store.StateSucceeded},
+		{ID: "b2", InstanceID: "i2", State: store.StateSucceeded},
+		{ID: "b3", InstanceID: "i2", State: store.StateInProgress},
+	} {
+		assert.NoError(t, instanceStore.PutBinding(ctx, binding))
+	}
+	assert.NoError(t, instanceStore.PutOperation(ctx, &store.Operation{ID: "o1", InstanceID: "i2", Type: store.OperationProvision, State: store.StateSucceeded, StartedAt: now.Add(-time.Hour)}))
+	assert.NoError(t, instanceStore.PutOperation(ctx, &store.Operation{ID: "o2", InstanceID: "i2", BindingID: "b2", Type: store.OperationBind, State: store.StateSucceeded, StartedAt: now}))
+	assert.NoError(t, instanceStore.PutOperation(ctx, &store.Operation{ID: "o3", InstanceID: "gone", Type: store.OperationDeprovision, State: store.StateSucceeded, StartedAt: now}))
+}
+
+type instancesPage struct {
+	Pagination pagination        `json:"pagination"`
+	Resources  []*store.Instance `json:"resources"`
+}
+
+func instanceIDs(page instancesPage) []string {
+	ids := []string{}
+	for _, instance := range page.Resources {
+		ids = append(ids, instance.ID)
+	}
+	return ids
+}
+
+func TestAdminInstances(t *testing.T) {
+	defer useMemoryStore()()
+	seedStore(t)
+
+	for query, expected := range map[string][]string{
+		"":                                 {"i1", "i2", "i3"},
+		"?foundation=cf-eu10-001":          {"i2", "i3"},
+		"?plan_id=cloudcontroller":         {"i1", "i2"},
+		"?organization_guid=org-a":         {"i1", "i2"},
+		"?space_guid=space-c":              {"i3"},
+		"?state=failed":                    {"i3"},
+		"?foundation=cf-eu10&state=failed": {},
+	} {
+		page := instancesPage{}
+		assert.Equal(t, http.StatusOK, getAdmin(t, "/admin/v1/instances/"+query, &page), query)
+		assert.Equal(t, expected, instanceIDs(page), query)
+	}
+}
+
+func TestAdminInstancesPagination(t *testing.T) {
+	defer useMemoryStore()()
+	seedStore(t)
+
+	page := instancesPage{}
+	assert.Equal(t, http.StatusOK, getAdmin(t, "/admin/v1/instances/?per_page=2&page=2", &page))
+	assert.Equal(t, []string{"i3"}, instanceIDs(page))
+	assert.Equal(t, pagination{TotalResults: 3, TotalPages: 2, Page: 2, PerPage: 2}, page.Pagination)
+
+	page = instancesPage{}
+	assert.Equal(t, http.StatusOK, getAdmin(t, "/admin/v1/instances/?per_page=2&page=5", &page))
+	assert.Empty(t, page.Resources)
+
+	assert.Equal(t, http.StatusBadRequest, getAdmin(t, "/admin/v1/instances/?page=0", nil))
+	assert.Equal(t, http.StatusBadRequest, getAdmin(t, "/admin/v1/instances/?per_page=1000", nil))
+}
+
+func TestAdminInstance(t *testing.T) {
+	defer useMemoryStore()()
+	seedStore(t)
+
+	instance := store.Instance{}
+	assert.Equal(t, http.StatusOK, getAdmin(t, "/admin/v1/instances/i2/", &instance))
+	assert.Equal(t, "cf-eu10-001", instance.Foundation)
+
+	assert.Equal(t, http.StatusNotFound, getAdmin(t, "/admin/v1/instances/unknown/", nil))
+}
+
+func TestAdminInstanceOperations(t *testing.T) {
+	defer useMemoryStore()()
+	seedStore(t)
+
+	page := struct {
+		Resources []*store.Operation `json:"resources"`
+	}{}
+	assert.Equal(t, http.StatusOK, getAdmin(t, "/admin/v1/instances/i2/operations/", &page))
+	assert.Len(t, page.Resources, 2)
+	assert.Equal(t, store.OperationProvision, page.Resources[0].Type)
+	assert.Equal(t, "b2", page.Resources[1].BindingID)
+
+	assert.Equal(t, http.StatusOK, getAdmin(t, "/admin/v1/instances/i1/operations/", &page))
+	assert.Empty(t, page.Resources)
+
+	assert.Equal(t, http.StatusOK, getAdmin(t, "/admin/v1/instances/gone/operations/", &page), "history outlives the instance")
+	assert.Len(t, page.Resources, 1)
+
+	assert.Equal(t, http.StatusNotFound, getAdmin(t, "/admin/v1/instances/unknown/operations/", nil))
+}
+
+func TestAdminBindings(t *testing.T) {
+	defer useMemoryStore()()
+	seedStore(t)
+
+	for query, expected := range map[string][]string{
+		"":                     {"b1", "b2", "b3"},
+		"?instance_id=i2":      {"b2", "b3"},
+		"?foundation=cf-eu10":  {"b1"},
+		"?space_guid=space-b":  {"b2", "b3"},
+		"?state=in%20progress": {"b3"},
+		"?plan_id=other":       {},
+	} {
+		page := struct {
+			Resources []adminBinding `json:"resources"`
+		}{}
+		assert.Equal(t, http.StatusOK, getAdmin(t, "/admin/v1/bindings/"+query, &page), query)
+
+		ids := []string{}
+		for _, binding := range page.Resources {
+			ids = append(ids, binding.ID)
+		}
+		assert.Equal(t, expected, ids, query)
+	}
+
+	page := struct {
+		Resources []adminBinding `json:"resources"`
+	}{}
+	getAdmin(t, "/admin/v1/bindings/?instance_id=i1", &page)
+	assert.Equal(t, "cf-eu10", page.Resources[0].Foundation)
+	assert.Equal(t, "cloudcontroller", page.Resources[0].PlanID)
+	assert.Equal(t, "cf-api-broker-b1", page.Resources[0].ClientID)
+}
+
+func TestAdminBindingsWithoutSecret(t *testing.T) {
+	defer useMemoryStore()()
+	seedStore(t)
+
+	page := struct {
+		Resources []map[string]interface{} `json:"resources"`
+	}{}
+	assert.Equal(t, http.StatusOK, getAdmin(t, "/admin/v1/bindings/?instance_id=i1", &page))
+	assert.Len(t, page.Resources, 1)
+	assert.NotContains(t, page.Resources[0], "client_secret")
+	assert.NotContains(t, page.Resources[0], "expires_at", "credentials without TTL do not expire")
+	assert.Equal(t, "cf-api-broker-b1", page.Resources[0]["client_id"])
+}
+
+func TestAdminFoundationSummary(t *testing.T) {
+	defer useMemoryStore()()
+	seedStore(t)
+
+	summary := foundationSummary{}
+	assert.Equal(t, http.StatusOK, getAdmin(t, "/admin/v1/foundations/cf-eu10-001/", &summary))
+	assert.Equal(t, 2, summary.Instances)
+	assert.Equal(t, 2, summary.Bindings)
+	assert.Equal(t, map[string]int{"cloudcontroller": 1, "other": 1}, summary.Plans)
+
+	assert.Equal(t, http.StatusNotFound, getAdmin(t, "/admin/v1/foundations/unknown/", nil))
+}
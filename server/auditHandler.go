@@ -0,0 +1,177 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sklevenz/cf-api-broker/audit"
+	"github.com/sklevenz/cf-api-broker/config"
+)
+
+const (
+	auditAppName       string = "cf-api-broker"
+	auditMemorySize    int    = 1000
+	auditNetworkStdout string = "stdout"
+)
+
+var (
+	// auditor records state changes, an in-memory trail is used until
+	// ConfigureAudit is called
+	auditor = audit.New(audit.NewMemorySink(auditMemorySize))
+
+	// auditOperations maps route name and method to the audited operation
+	auditOperations = map[string]map[string]string{
+		"v2.service_instances": {
+			http.MethodPut:    "provision",
+			http.MethodPatch:  "update",
+			http.MethodDelete: "deprovision",
+		},
+		"v2.service_bindings": {
+			http.MethodPut:    "bind",
+			http.MethodDelete: "unbind",
+		},
+		"admin.instance.migrations": {
+			http.MethodPost: "migrate",
+		},
+		"admin.foundation.cordon": {
+			http.MethodPut:    "cordon",
+			http.MethodDelete: "uncordon",
+		},
+	}
+)
+
+// ConfigureAudit creates the audit sinks from configuration. Without an
+// audit file the trail is kept in memory to stay queryable.
+func ConfigureAudit() error {
+	cfg := config.Get().Audit
+	sinks := []audit.Sink{}
+
+	if cfg.File != "" {
+		sink, err := audit.NewFileSink(cfg.File)
+		if err != nil {
+			return fmt.Errorf("could not open audit file: %v", err)
+		}
+		sinks = append(sinks, sink)
+	} else {
+		sinks = append(sinks, audit.NewMemorySink(auditMemorySize))
+	}
+
+	switch cfg.Syslog.Network {
+	case "":
+	case auditNetworkStdout:
+		sinks = append(sinks, audit.NewSyslogSink(os.Stdout, auditAppName, false))
+	case "tcp", "udp":
+		sinks = append(sinks, audit.DialSyslogSink(cfg.Syslog.Network, cfg.Syslog.Address, auditAppName))
+	default:
+		return fmt.Errorf("Config error: unsupported audit syslog network: \"%v\"", cfg.Syslog.Network)
+	}
+
+	auditor = audit.New(sinks...)
+	return nil
+}
+
+// CloseAudit closes the audit sinks, it is meant to run as shutdown hook
+func CloseAudit(ctx context.Context) error {
+	return auditor.Close()
+}
+
+// auditHandler records an audit event for each state changing request with
+// the originating identity, affected instance and binding and the outcome
+func auditHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		operation := ""
+		if route := mux.CurrentRoute(r); route != nil {
+			operation = auditOperations[route.GetName()][r.Method]
+		}
+		if operation == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+
+		status := recorder.code()
+		outcome := audit.OutcomeSuccess
+		if status == http.StatusAccepted {
+			outcome = audit.OutcomeAccepted
+		} else if status >= http.StatusBadRequest {
+			outcome = audit.OutcomeFailure
+		}
+
+		event := audit.Event{
+			RequestID:  requestLogField(r, "request_id"),
+			Principal:  principal(r),
+			Operation:  operation,
+			InstanceID: mux.Vars(r)["instance_id"],
+			BindingID:  mux.Vars(r)["binding_id"],
+			Foundation: requestLogField(r, "foundation"),
+			Outcome:    outcome,
+			Status:     status,
+		}
+
+		if identity := originatingIdentityFrom(r); identity != nil {
+			event.Platform = identity.Platform
+			event.UserID = identity.UserID()
+			event.UserName = identity.UserName()
+		}
+
+		auditor.Record(event)
+	})
+}
+
+// auditQueryHandler returns audit events filtered by query parameters
+// operation, instance_id, foundation, platform, user_id, since, until
+// (RFC 3339) and limit
+func auditQueryHandler(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	query := audit.Query{
+		Operation:  values.Get("operation"),
+		InstanceID: values.Get("instance_id"),
+		Foundation: values.Get("foundation"),
+		Platform:   values.Get("platform"),
+		UserID:     values.Get("user_id"),
+	}
+
+	var err error
+	if query.Since, err = parseTimeParam(values.Get("since")); err != nil {
+		handleHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+	if query.Until, err = parseTimeParam(values.Get("until")); err != nil {
+		handleHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+	if limit := values.Get("limit"); limit != "" {
+		if query.Limit, err = strconv.Atoi(limit); err != nil {
+			handleHTTPError(w, http.StatusBadRequest, fmt.Errorf("invalid limit: %v", limit))
+			return
+		}
+	}
+
+	events, err := auditor.Query(query)
+	if err != nil {
+		handleHTTPError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set(headerContentType, contentTypeJSON)
+	json.NewEncoder(w).Encode(map[string][]audit.Event{"events": events})
+}
+
+func parseTimeParam(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return t, fmt.Errorf("invalid time %v, expected RFC 3339", value)
+	}
+	return t, nil
+}
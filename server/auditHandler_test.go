@@ -0,0 +1,131 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sklevenz/cf-api-broker/audit"
+	"github.com/stretchr/testify/assert"
+)
+
+const provisionBody = `{"service_id": "cf", "plan_id": "cloudcontroller", "organization_guid": "org", "space_guid": "space"}`
+
+func provision(router http.Handler, instanceID string) *httptest.ResponseRecorder {
+	return provisionWith(router, instanceID, provisionBody)
+}
+
+func provisionWith(router http.Handler, instanceID string, body string) *httptest.ResponseRecorder {
+	request, _ := http.NewRequest(http.MethodPut, "/v2/service_instances/"+instanceID+"/", bytes.NewBufferString(body))
+	request.SetBasicAuth("username", "password")
+	request.Header.Set(headerAPIVersion, "2.14")
+	request.Header.Set(headerAPIRequestIdentity, "request-"+instanceID)
+	request.Header.Set(headerAPIOrginatingIdentity, "cloudfoundry eyANCiAgInVzZXJfaWQiOiAiNjgzZWE3NDgtMzA5Mi00ZmY0LWI2NTYtMzljYWNjNGQ1MzYwIg0KfQ==")
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	return response
+}
+
+func queryAudit(t *testing.T, router http.Handler, query string) []audit.Event {
+	request, _ := http.NewRequest(http.MethodGet, "/admin/v1/audit/?"+query, nil)
+	request.SetBasicAuth("admin", "admin")
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	result := map[string][]audit.Event{}
+	assert.Nil(t, json.Unmarshal(response.Body.Bytes(), &result))
+	return result["events"]
+}
+
+func TestAuditProvision(t *testing.T) {
+	_, cleanup := useFakeFoundation(t)
+	defer cleanup()
+	router := NewRouter(staticDir)
+	provision(router, "audited")
+
+	events := queryAudit(t, router, "instance_id=audited")
+	assert.Len(t, events, 1)
+
+	event := events[0]
+	assert.Equal(t, "provision", event.Operation)
+	assert.Equal(t, "request-audited", event.RequestID)
+	assert.Equal(t, "username", event.Principal)
+	assert.Equal(t, "cloudfoundry", event.Platform)
+	assert.Equal(t, "683ea748-3092-4ff4-b656-39cacc4d5360", event.UserID)
+	assert.Equal(t, audit.OutcomeSuccess, event.Outcome)
+	assert.False(t, event.Time.IsZero())
+}
+
+func TestAuditIgnoresReads(t *testing.T) {
+	router := NewRouter(staticDir)
+
+	request, _ := http.NewRequest(http.MethodGet, "/v2/catalog/", nil)
+	request.SetBasicAuth("username", "password")
+	request.Header.Set(headerAPIVersion, "2.14")
+	request.Header.Set(headerAPIRequestIdentity, "read-only-request")
+	router.ServeHTTP(httptest.NewRecorder(), request)
+
+	events := queryAudit(t, router, "")
+	for _, event := range events {
+		assert.NotEqual(t, "read-only-request", event.RequestID)
+	}
+}
+
+func TestAuditQueryRequiresAdmin(t *testing.T) {
+	request, _ := http.NewRequest(http.MethodGet, "/admin/v1/audit/", nil)
+	request.SetBasicAuth("username", "password")
+	response := httptest.NewRecorder()
+
+	NewRouter(staticDir).ServeHTTP(response, request)
+
+	assert.Equal(t, http.StatusUnauthorized, response.Code)
+}
+
+func TestAuditQueryInvalidParameter(t *testing.T) {
+	request, _ := http.NewRequest(http.MethodGet, "/admin/v1/audit/?since=yesterday", nil)
+	request.SetBasicAuth("admin", "admin")
+	response := httptest.NewRecorder()
+
+	NewRouter(staticDir).ServeHTTP(response, request)
+
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+}
+
+func TestConfigureAuditFile(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "audit")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+
+	previous := auditor
+	defer func() { auditor = previous }()
+
+	defer useConfig(t, fmt.Sprintf(`
+server:
+  authtype: basic
+  basicauth:
+    username: username
+    password: password
+  admin:
+    authtype: basic
+    basicauth:
+      username: admin
+      password: admin
+audit:
+  file: %v
+`, path))()
+	assert.Nil(t, ConfigureAudit())
+
+	router := NewRouter(staticDir)
+	provision(router, "file-audited")
+
+	data, _ := ioutil.ReadFile(path)
+	assert.Contains(t, string(data), `"instance_id":"file-audited"`)
+	assert.Len(t, queryAudit(t, router, "instance_id=file-audited"), 1)
+}
@@ -0,0 +1,353 @@
+package server
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"github.com/sklevenz/cf-api-broker/config"
+	"github.com/sklevenz/cf-api-broker/oauth2"
+	"github.com/sklevenz/cf-api-broker/tracing"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	headerAuthorization   string = "Authorization"
+	headerWWWAuthenticate string = "WWW-Authenticate"
+)
+
+type contextKey string
+
+const (
+	principalKey contextKey = "principal"
+
+	policyPublic   string = "public"
+	policyPlatform string = "platform"
+	policyAdmin    string = "admin"
+)
+
+var (
+	bcryptPrefixes = []string{"$2a$", "$2b$", "$2y$"}
+
+	defaultPublicRoutes = []string{"health", "health.*", "dashboard"}
+	defaultAdminRoutes  = []string{"version", "metrics", "admin.*"}
+)
+
+// routePolicy returns the policy of a route by its name. Routes not listed
+// as public or admin route are platform routes.
+func routePolicy(name string) string {
+	cfg := config.Get().Server
+
+	publicRoutes := cfg.PublicRoutes
+	if publicRoutes == nil {
+		publicRoutes = defaultPublicRoutes
+	}
+	adminRoutes := cfg.AdminRoutes
+	if adminRoutes == nil {
+		adminRoutes = defaultAdminRoutes
+	}
+
+	for _, route := range publicRoutes {
+		if routeMatches(route, name) {
+			return policyPublic
+		}
+	}
+	for _, route := range adminRoutes {
+		if routeMatches(route, name) {
+			return policyAdmin
+		}
+	}
+	return policyPlatform
+}
+
+// routeMatches compares a route name with a configured route, a trailing
+// asterisk matches all routes with the given prefix, e.g. admin.*
+func routeMatches(pattern string, name string) bool {
+	if strings.HasSuffix(pattern, "*") {
+		return strings.HasPrefix(name, strings.TrimSuffix(pattern, "*"))
+	}
+	return pattern == name
+}
+
+// routePolicyHandler authenticates and rate limits requests depending on the
+// policy of the matched route: public routes need no authentication, /v2 and
+// other routes use the platform authentication and operational routes the
+// admin authentication. Each policy has its own rate limits.
+func routePolicyHandler() mux.MiddlewareFunc {
+	cfg := config.Get().Server
+	platformAuth := newAuthHandler(cfg.Auth)
+	adminAuth := newAuthHandler(cfg.Admin)
+
+	publicLimiter := newRouteGroupLimiter(cfg.RateLimits.Public)
+	platformLimiter := newRouteGroupLimiter(cfg.RateLimits.Platform)
+	adminLimiter := newRouteGroupLimiter(cfg.RateLimits.Admin)
+	lockout := newAuthLockout()
+
+	return func(next http.Handler) http.Handler {
+		publicNext := publicLimiter.protect(next, nil, lockout)
+		platformNext := platformLimiter.protect(next, platformAuth, lockout)
+		adminNext := adminLimiter.protect(next, adminAuth, lockout)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			name := ""
+			if route := mux.CurrentRoute(r); route != nil {
+				name = route.GetName()
+			}
+
+			switch routePolicy(name) {
+			case policyPublic:
+				publicNext.ServeHTTP(w, r)
+			case policyAdmin:
+				adminNext.ServeHTTP(w, r)
+			default:
+				platformNext.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+// principal returns the authenticated identity of a request or an empty
+// string for requests to public routes
+func principal(r *http.Request) string {
+	value, _ := r.Context().Value(principalKey).(string)
+	return value
+}
+
+func withPrincipal(r *http.Request, name string) *http.Request {
+	addLogField(r, "principal", name)
+	return r.WithContext(context.WithValue(r.Context(), principalKey, name))
+}
+
+// newTokenValidator creates a bearer token validator from the oauth2 configuration
+func newTokenValidator(auth config.Auth) (*oauth2.Validator, error) {
+	cfg := auth.OAuth2
+
+	keys := []crypto.PublicKey{}
+	for _, pem := range cfg.Keys {
+		key, err := oauth2.ParsePublicKey([]byte(pem))
+		if err != nil {
+			return nil, fmt.Errorf("Config error: invalid oauth2 key: %v", err)
+		}
+		keys = append(keys, key)
+	}
+
+	return oauth2.NewValidator(oauth2.Options{
+		JWKSURL:         cfg.JWKSURL,
+		StaticKeys:      keys,
+		Issuer:          cfg.Issuer,
+		Audience:        cfg.Audience,
+		Scopes:          cfg.Scopes,
+		RefreshInterval: cfg.KeyRefreshInterval,
+		HTTPClient: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: tracing.Transport(http.DefaultTransport),
+		},
+	})
+}
+
+// newAuthHandler creates a middleware authenticating requests as configured by auth
+func newAuthHandler(auth config.Auth) mux.MiddlewareFunc {
+	var tokenValidator *oauth2.Validator
+	if auth.AuthType == config.AuthTypeOAuth2 {
+		validator, err := newTokenValidator(auth)
+		if err != nil {
+			log.Errorf("Error: %v", err)
+		}
+		tokenValidator = validator
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			switch auth.AuthType {
+			case config.AuthTypeBasic:
+
+				// handle basic auth
+				u, p, ok := r.BasicAuth()
+				if !ok || len(strings.TrimSpace(u)) < 1 || len(strings.TrimSpace(p)) < 1 {
+					unauthorised(w)
+					return
+				}
+
+				if !checkCredentials(auth.Credentials(), u, p, time.Now()) {
+					unauthorised(w)
+					return
+				}
+				r = withPrincipal(r, u)
+			case config.AuthTypeOAuth2:
+
+				// handle bearer token
+				if tokenValidator == nil {
+					err := fmt.Errorf("Config error: oauth2 token validator not initialized")
+					handleHTTPError(w, http.StatusInternalServerError, err)
+					return
+				}
+
+				token, ok := bearerToken(r)
+				if !ok {
+					unauthorisedBearer(w, "")
+					return
+				}
+
+				claims, err := tokenValidator.Validate(r.Context(), token)
+				if err != nil {
+					requestLogger(r).Warnf("Bearer token rejected: %v", err)
+					if err == oauth2.ErrInsufficientScope {
+						forbiddenBearer(w)
+					} else {
+						unauthorisedBearer(w, "invalid_token")
+					}
+					return
+				}
+				if claims.ClientID != "" {
+					r = withPrincipal(r, claims.ClientID)
+				} else {
+					r = withPrincipal(r, claims.Subject)
+				}
+			case config.AuthTypeMTLS:
+
+				// handle client certificate, verified by the TLS handshake
+				if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+					unauthorisedCertificate(w)
+					return
+				}
+
+				cert := r.TLS.VerifiedChains[0][0]
+				if !certificateAllowed(cert, auth.MTLS.Subjects, auth.MTLS.SANs) {
+					requestLogger(r).Warnf("Client certificate rejected: %v", cert.Subject)
+					unauthorisedCertificate(w)
+					return
+				}
+				r = withPrincipal(r, cert.Subject.String())
+			default:
+				err := fmt.Errorf("Config error: unsupported AuthType: \"%v\"", auth.AuthType)
+				handleHTTPError(w, http.StatusInternalServerError, err)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	value := r.Header.Get(headerAuthorization)
+	const prefix = "bearer "
+
+	if len(value) <= len(prefix) || !strings.EqualFold(value[:len(prefix)], prefix) {
+		return "", false
+	}
+
+	token := strings.TrimSpace(value[len(prefix):])
+	return token, token != ""
+}
+
+// certificateAllowed checks whether the subject distinguished name or one of
+// the subject alternative names of the certificate is configured
+func certificateAllowed(cert *x509.Certificate, subjects []string, sans []string) bool {
+	for _, subject := range subjects {
+		if subject == cert.Subject.String() {
+			return true
+		}
+	}
+
+	names := append([]string{}, cert.DNSNames...)
+	names = append(names, cert.EmailAddresses...)
+	for _, ip := range cert.IPAddresses {
+		names = append(names, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		names = append(names, uri.String())
+	}
+
+	for _, san := range sans {
+		for _, name := range names {
+			if strings.EqualFold(san, name) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// checkCredentials compares user and password with every credential valid at
+// the given time. All credentials are checked to not leak through timing
+// which of them matched.
+func checkCredentials(credentials []config.Credential, user string, password string, now time.Time) bool {
+	match := 0
+
+	for _, credential := range credentials {
+		userMatch := constantTimeEqual(credential.UserName, user)
+		passwordMatch := comparePassword(credential.Password, password)
+		validMatch := 0
+		if credential.ValidAt(now) {
+			validMatch = 1
+		}
+		match |= userMatch & passwordMatch & validMatch
+	}
+
+	return match == 1
+}
+
+// comparePassword returns 1 if password matches the configured value which is
+// either a bcrypt hash or plain text, otherwise 0
+func comparePassword(configured string, password string) int {
+	if isBcryptHash(configured) {
+		if bcrypt.CompareHashAndPassword([]byte(configured), []byte(password)) == nil {
+			return 1
+		}
+		return 0
+	}
+
+	return constantTimeEqual(configured, password)
+}
+
+// constantTimeEqual returns 1 if a and b are equal, otherwise 0. The SHA-256
+// digests are compared so the time taken does not leak the length of either
+// value.
+func constantTimeEqual(a string, b string) int {
+	digestA := sha256.Sum256([]byte(a))
+	digestB := sha256.Sum256([]byte(b))
+	return subtle.ConstantTimeCompare(digestA[:], digestB[:])
+}
+
+func isBcryptHash(value string) bool {
+	for _, prefix := range bcryptPrefixes {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func unauthorised(rw http.ResponseWriter) {
+	rw.Header().Set(headerWWWAuthenticate, "Basic realm=Restricted")
+	rw.WriteHeader(http.StatusUnauthorized)
+}
+
+func unauthorisedBearer(rw http.ResponseWriter, reason string) {
+	value := "Bearer realm=Restricted"
+	if reason != "" {
+		value += fmt.Sprintf(", error=\"%v\"", reason)
+	}
+	rw.Header().Set(headerWWWAuthenticate, value)
+	rw.WriteHeader(http.StatusUnauthorized)
+}
+
+func unauthorisedCertificate(rw http.ResponseWriter) {
+	handleHTTPError(rw, http.StatusUnauthorized, fmt.Errorf("valid client certificate required"))
+}
+
+func forbiddenBearer(rw http.ResponseWriter) {
+	rw.Header().Set(headerWWWAuthenticate, "Bearer realm=Restricted, error=\"insufficient_scope\"")
+	rw.WriteHeader(http.StatusForbidden)
+}
@@ -0,0 +1,215 @@
+package server
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sklevenz/cf-api-broker/config"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestBasicAuthRotatedCredential(t *testing.T) {
+	request, _ := http.NewRequest(http.MethodGet, "/", nil)
+	request.SetBasicAuth("rotated", "rotated")
+	response := httptest.NewRecorder()
+
+	NewRouter(staticDir).ServeHTTP(response, request)
+
+	assert.Equal(t, http.StatusOK, response.Result().StatusCode)
+}
+
+func TestBasicAuthRetiredCredential(t *testing.T) {
+	request, _ := http.NewRequest(http.MethodGet, "/", nil)
+	request.SetBasicAuth("retired", "retired")
+	response := httptest.NewRecorder()
+
+	NewRouter(staticDir).ServeHTTP(response, request)
+
+	assert.Equal(t, http.StatusUnauthorized, response.Result().StatusCode)
+}
+
+func TestBasicAuthWrongPassword(t *testing.T) {
+	request, _ := http.NewRequest(http.MethodGet, "/", nil)
+	request.SetBasicAuth("rotated", "password")
+	response := httptest.NewRecorder()
+
+	NewRouter(staticDir).ServeHTTP(response, request)
+
+	assert.Equal(t, http.StatusUnauthorized, response.Result().StatusCode)
+}
+
+func TestCheckCredentialsValidityWindow(t *testing.T) {
+	now := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	credentials := []config.Credential{
+		{UserName: "old", Password: "old", NotAfter: now.Add(-time.Hour)},
+		{UserName: "current", Password: "current", NotBefore: now.Add(-time.Hour), NotAfter: now.Add(time.Hour)},
+		{UserName: "next", Password: "next", NotBefore: now.Add(time.Hour)},
+	}
+
+	assert.False(t, checkCredentials(credentials, "old", "old", now))
+	assert.True(t, checkCredentials(credentials, "current", "current", now))
+	assert.False(t, checkCredentials(credentials, "next", "next", now))
+	assert.True(t, checkCredentials(credentials, "next", "next", now.Add(2*time.Hour)))
+	assert.False(t, checkCredentials(credentials, "current", "next", now))
+}
+
+func TestComparePassword(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+
+	assert.Equal(t, 1, comparePassword("secret", "secret"))
+	assert.Equal(t, 0, comparePassword("secret", "secre"), "prefix")
+	assert.Equal(t, 0, comparePassword("secret", "secret-and-more"))
+	assert.Equal(t, 0, comparePassword("secret", ""))
+	assert.Equal(t, 1, comparePassword(string(hash), "secret"))
+	assert.Equal(t, 0, comparePassword(string(hash), "other"))
+}
+
+// useConfig reads a temporary configuration and returns a function to
+// restore the default test configuration
+func useConfig(t *testing.T, yaml string) func() {
+	file, err := ioutil.TempFile("", "config-*.yaml")
+	assert.Nil(t, err)
+	file.WriteString(yaml)
+	file.Close()
+
+	assert.Nil(t, config.Read(file.Name()))
+
+	return func() {
+		os.Remove(file.Name())
+		config.Read("./../config/config.yaml")
+	}
+}
+
+func signToken(t *testing.T, key *rsa.PrivateKey, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	assert.Nil(t, err)
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func oauth2Config(t *testing.T, key *rsa.PrivateKey) string {
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	data := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	indented := strings.ReplaceAll(strings.TrimSpace(string(data)), "\n", "\n          ")
+
+	return fmt.Sprintf(`
+server:
+  authtype: oauth2
+  oauth2:
+    issuer: uaa
+    audience: cf-api-broker
+    scopes:
+    - cf-api-broker.platform
+    keys:
+    - |
+          %v
+`, indented)
+}
+
+func TestBearerAuth(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	defer useConfig(t, oauth2Config(t, key))()
+
+	router := NewRouter(staticDir)
+	claims := map[string]interface{}{
+		"iss":   "uaa",
+		"aud":   "cf-api-broker",
+		"scope": []string{"cf-api-broker.platform"},
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}
+
+	request, _ := http.NewRequest(http.MethodGet, "/", nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	assert.Equal(t, http.StatusUnauthorized, response.Result().StatusCode)
+	assert.Contains(t, response.Header().Get(headerWWWAuthenticate), "Bearer")
+
+	request, _ = http.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set(headerAuthorization, "Bearer "+signToken(t, key, claims))
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	assert.Equal(t, http.StatusOK, response.Result().StatusCode)
+
+	claims["scope"] = []string{"openid"}
+	request, _ = http.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set(headerAuthorization, "Bearer "+signToken(t, key, claims))
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	assert.Equal(t, http.StatusForbidden, response.Result().StatusCode)
+
+	request, _ = http.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set(headerAuthorization, "Bearer abc")
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	assert.Equal(t, http.StatusUnauthorized, response.Result().StatusCode)
+	assert.Contains(t, response.Header().Get(headerWWWAuthenticate), "invalid_token")
+}
+
+func TestRoutePolicies(t *testing.T) {
+	tests := []struct {
+		path     string
+		user     string
+		password string
+		status   int
+	}{
+		{"/health/", "", "", http.StatusOK},
+		{"/version/", "", "", http.StatusUnauthorized},
+		{"/version/", "username", "password", http.StatusUnauthorized},
+		{"/version/", "admin", "admin", http.StatusOK},
+		{"/v2/catalog/", "admin", "admin", http.StatusUnauthorized},
+		{"/v2/catalog/", "username", "password", http.StatusOK},
+		{"/", "", "", http.StatusUnauthorized},
+	}
+
+	router := NewRouter(staticDir)
+	for _, test := range tests {
+		request, _ := http.NewRequest(http.MethodGet, test.path, nil)
+		request.Header.Set(headerAPIVersion, "2.2")
+		if test.user != "" {
+			request.SetBasicAuth(test.user, test.password)
+		}
+		response := httptest.NewRecorder()
+
+		router.ServeHTTP(response, request)
+
+		assert.Equal(t, test.status, response.Result().StatusCode, "%v as %q", test.path, test.user)
+	}
+}
+
+func TestAdminAuthNotConfigured(t *testing.T) {
+	defer useConfig(t, `
+server:
+  authtype: basic
+  basicauth:
+    username: username
+    password: password
+`)()
+
+	request, _ := http.NewRequest(http.MethodGet, "/version/", nil)
+	request.SetBasicAuth("username", "password")
+	response := httptest.NewRecorder()
+
+	NewRouter(staticDir).ServeHTTP(response, request)
+
+	assert.Equal(t, http.StatusInternalServerError, response.Result().StatusCode)
+}
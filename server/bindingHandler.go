@@ -0,0 +1,324 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sklevenz/cf-api-broker/config"
+	"github.com/sklevenz/cf-api-broker/foundation"
+	"github.com/sklevenz/cf-api-broker/openapi"
+	"github.com/sklevenz/cf-api-broker/store"
+)
+
+const (
+	// bindingClientPrefix prefixes the UAA client ids of bindings
+	bindingClientPrefix string = "cf-api-broker-"
+
+	secretLength int = 32
+)
+
+// defaultBindingScopes are the authorities of binding credentials of plans
+// without default role or scopes
+var defaultBindingScopes = []string{"cloud_controller.read", "cloud_controller.write"}
+
+// bindHandler creates a UAA client on the foundation of the instance and
+// returns its credentials. The role and scopes of the client are requested
+// with the binding parameters. A binding with a predecessor gets fresh
+// credentials with the role and scopes of the predecessor, which stays valid
+// until it is unbound. Without parameters it keeps those of the predecessor.
+// Repeated requests return the binding unless they ask for other attributes.
+// Bindings whose credentials expired are not returned again.
+func bindHandler(w http.ResponseWriter, r *http.Request) {
+	bindData := &openapi.ServiceBindingRequest{}
+	if err := json.NewDecoder(r.Body).Decode(bindData); err != nil {
+		handleHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	instanceID := mux.Vars(r)["instance_id"]
+	bindingID := mux.Vars(r)["binding_id"]
+
+	instance, err := instanceStore.GetInstance(r.Context(), instanceID)
+	if errors.Is(err, store.ErrNotFound) {
+		handleHTTPError(w, http.StatusNotFound, fmt.Errorf("instance %v not found", instanceID))
+		return
+	}
+	if err != nil {
+		handleHTTPError(w, http.StatusInternalServerError, err)
+		return
+	}
+	addLogField(r, "foundation", instance.Foundation)
+
+	client, err := foundationClient(instance.Foundation)
+	if err != nil {
+		handleHTTPError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	existing, err := instanceStore.GetBinding(r.Context(), bindingID)
+	if err == nil {
+		inherited := existing.PredecessorID != "" && len(bindData.Parameters) == 0
+		if existing.InstanceID != instanceID || existing.PredecessorID != bindData.PredecessorBindingId ||
+			!inherited && !sameParameters(existing.Parameters, bindData.Parameters) {
+			handleHTTPError(w, http.StatusConflict, fmt.Errorf("binding %v exists with different attributes", bindingID))
+			return
+		}
+		if existing.State == store.StateExpired {
+			handleHTTPError(w, http.StatusConflict, fmt.Errorf("credentials of binding %v expired at %v, rotate or unbind it", bindingID, existing.ExpiresAt.Format(time.RFC3339)))
+			return
+		}
+		writeBinding(w, http.StatusOK, client, instance, existing)
+		return
+	}
+	if !errors.Is(err, store.ErrNotFound) {
+		handleHTTPError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if instance.State == store.StateInProgress {
+		handleOSBError(w, http.StatusUnprocessableEntity, openapi.Error{
+			Error:       "ConcurrencyError",
+			Description: fmt.Sprintf("instance %v has an operation in progress", instanceID),
+		})
+		return
+	}
+
+	var granted grant
+	if bindData.PredecessorBindingId == "" {
+		granted, err = grantBinding(instance, bindData.Parameters)
+		if err != nil {
+			handleHTTPError(w, http.StatusBadRequest, err)
+			return
+		}
+	} else {
+		predecessor, err := instanceStore.GetBinding(r.Context(), bindData.PredecessorBindingId)
+		if errors.Is(err, store.ErrNotFound) || (err == nil && predecessor.InstanceID != instanceID) {
+			handleHTTPError(w, http.StatusBadRequest, fmt.Errorf("predecessor binding %v not found for instance %v", bindData.PredecessorBindingId, instanceID))
+			return
+		}
+		if err != nil {
+			handleHTTPError(w, http.StatusInternalServerError, err)
+			return
+		}
+		granted = grant{Role: predecessor.Role, Scopes: predecessor.Scopes}
+		if len(bindData.Parameters) == 0 {
+			bindData.Parameters = predecessor.Parameters
+		}
+	}
+
+	binding, err := createBinding(r.Context(), client, instance, bindingID, bindData, granted)
+	if err == foundation.ErrClientExists {
+		handleHTTPError(w, http.StatusConflict, fmt.Errorf("credentials of binding %v exist on %v", bindingID, instance.Foundation))
+		return
+	}
+	if err != nil {
+		requestLogger(r).Errorf("Error creating binding: %v", err)
+		handleHTTPError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeBinding(w, http.StatusCreated, client, instance, binding)
+}
+
+// createBinding registers the UAA client of a binding, grants its role and
+// stores it. The client is removed again if any step fails.
+func createBinding(ctx context.Context, client *foundation.Client, instance *store.Instance, bindingID string, bindData *openapi.ServiceBindingRequest, granted grant) (*store.Binding, error) {
+	secret, err := newSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	instanceID := instance.ID
+	now := time.Now().UTC()
+	expiresAt, renewBefore := bindingExpiry(instance.PlanID, now)
+	binding := &store.Binding{
+		ID:            bindingID,
+		InstanceID:    instanceID,
+		PredecessorID: bindData.PredecessorBindingId,
+		Parameters:    bindData.Parameters,
+		ClientID:      bindingClientPrefix + bindingID,
+		ClientSecret:  secret,
+		Role:          granted.Role,
+		Scopes:        granted.Scopes,
+		ExpiresAt:     expiresAt,
+		RenewBefore:   renewBefore,
+		State:         store.StateSucceeded,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+
+	err = client.CreateUAAClient(ctx, foundation.UAAClient{
+		ID:          binding.ClientID,
+		Secret:      binding.ClientSecret,
+		Authorities: binding.Scopes,
+		Name:        fmt.Sprintf("binding %v of instance %v", bindingID, instanceID),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = grantCredentials(ctx, client, instance, binding)
+	if err == nil {
+		err = instanceStore.PutBinding(ctx, binding)
+	}
+	if err != nil {
+		revokeCredentials(ctx, client, binding)
+		return nil, err
+	}
+
+	description := ""
+	if binding.PredecessorID != "" {
+		description = fmt.Sprintf("rotated binding %v", binding.PredecessorID)
+	}
+	return binding, instanceStore.PutOperation(ctx, &store.Operation{
+		ID:          newUUID(),
+		InstanceID:  instanceID,
+		BindingID:   bindingID,
+		Type:        store.OperationBind,
+		State:       store.StateSucceeded,
+		Description: description,
+		Progress:    100,
+		StartedAt:   now,
+		UpdatedAt:   now,
+	})
+}
+
+// bindingExpiry returns when credentials issued at t for a plan expire and
+// should be renewed, or zero times if the plan has no credential TTL. Without
+// renewBefore credentials are renewed after 80% of their TTL.
+func bindingExpiry(planID string, t time.Time) (time.Time, time.Time) {
+	plan := config.Get().Plans[planID]
+	if plan.CredentialTTL <= 0 {
+		return time.Time{}, time.Time{}
+	}
+
+	renewBefore := plan.RenewBefore
+	if renewBefore <= 0 || renewBefore >= plan.CredentialTTL {
+		renewBefore = plan.CredentialTTL / 5
+	}
+	expiresAt := t.Add(plan.CredentialTTL)
+	return expiresAt, expiresAt.Add(-renewBefore)
+}
+
+// unbindHandler removes the UAA client and roles of a binding from the
+// foundation of its instance and deletes the binding
+func unbindHandler(w http.ResponseWriter, r *http.Request) {
+	instanceID := mux.Vars(r)["instance_id"]
+	bindingID := mux.Vars(r)["binding_id"]
+
+	binding, err := instanceStore.GetBinding(r.Context(), bindingID)
+	if errors.Is(err, store.ErrNotFound) || (err == nil && binding.InstanceID != instanceID) {
+		writeJSONStatus(w, http.StatusGone, map[string]interface{}{})
+		return
+	}
+	if err != nil {
+		handleHTTPError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	instance, err := instanceStore.GetInstance(r.Context(), instanceID)
+	if err != nil {
+		handleHTTPError(w, http.StatusInternalServerError, err)
+		return
+	}
+	addLogField(r, "foundation", instance.Foundation)
+
+	if instance.State == store.StateInProgress {
+		handleOSBError(w, http.StatusUnprocessableEntity, openapi.Error{
+			Error:       "ConcurrencyError",
+			Description: fmt.Sprintf("instance %v has an operation in progress", instanceID),
+		})
+		return
+	}
+
+	if binding.ClientID != "" {
+		client, err := foundationClient(instance.Foundation)
+		if err == nil {
+			err = revokeCredentials(r.Context(), client, binding)
+		}
+		if err == nil {
+			err = revokeSourceCredentials(r.Context(), binding)
+		}
+		if err == nil {
+			err = revokeRetiredCredentials(r.Context(), binding)
+		}
+		if err != nil {
+			requestLogger(r).Errorf("Error removing credentials of binding: %v", err)
+			handleHTTPError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	if err := instanceStore.DeleteBinding(r.Context(), bindingID); err != nil {
+		handleHTTPError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	now := time.Now().UTC()
+	err = instanceStore.PutOperation(r.Context(), &store.Operation{
+		ID:         newUUID(),
+		InstanceID: instanceID,
+		BindingID:  bindingID,
+		Type:       store.OperationUnbind,
+		State:      store.StateSucceeded,
+		Progress:   100,
+		StartedAt:  now,
+		UpdatedAt:  now,
+	})
+	if err != nil {
+		requestLogger(r).Errorf("Error recording unbind operation: %v", err)
+	}
+
+	writeJSONStatus(w, http.StatusOK, map[string]interface{}{})
+}
+
+// bindingCredentials are the credentials an application receives. Clients
+// with a role act in the org and space of the instance.
+func bindingCredentials(client *foundation.Client, instance *store.Instance, binding *store.Binding) map[string]interface{} {
+	credentials := map[string]interface{}{
+		"api_url":       client.APIURL(),
+		"uaa_url":       client.UAAURL(),
+		"client_id":     binding.ClientID,
+		"client_secret": binding.ClientSecret,
+		"scopes":        binding.Scopes,
+	}
+	if binding.Role != "" {
+		credentials["role"] = binding.Role
+	}
+	if instance.OrganizationGUID != "" {
+		credentials["organization_guid"] = instance.OrganizationGUID
+	}
+	if instance.SpaceGUID != "" {
+		credentials["space_guid"] = instance.SpaceGUID
+	}
+	return credentials
+}
+
+func writeBinding(w http.ResponseWriter, status int, client *foundation.Client, instance *store.Instance, binding *store.Binding) {
+	response := openapi.ServiceBindingResponse{
+		Credentials: bindingCredentials(client, instance, binding),
+	}
+	if !binding.ExpiresAt.IsZero() {
+		response.Metadata = openapi.ServiceBindingMetadata{
+			ExpiresAt:   binding.ExpiresAt.Format(time.RFC3339),
+			RenewBefore: binding.RenewBefore.Format(time.RFC3339),
+		}
+	}
+	writeJSONStatus(w, status, response)
+}
+
+// newSecret returns a random client secret
+func newSecret() (string, error) {
+	b := make([]byte, secretLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,216 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sklevenz/cf-api-broker/foundation"
+	"github.com/sklevenz/cf-api-broker/foundation/foundationtest"
+	"github.com/sklevenz/cf-api-broker/openapi"
+	"github.com/sklevenz/cf-api-broker/store"
+	"github.com/stretchr/testify/assert"
+)
+
+// useFakeFoundation configures the single foundation cf-a served by a fake
+// foundation with org "org" and space "space" and a credential TTL of one
+// hour
+func useFakeFoundation(t *testing.T) (*foundationtest.Server, func()) {
+	fake := foundationtest.NewServer()
+	fake.AddOrganization("org", "org-name")
+	fake.AddSpace("space", "space-name", "org")
+	restoreStore := useMemoryStore()
+	restoreMonitor := useMonitor(foundation.NewMonitor(2, 0.9, 0.5))
+	restoreConfig := useConfig(t, `
+server:
+  authtype: basic
+  basicauth:
+    username: username
+    password: password
+  admin:
+    authtype: basic
+    basicauth:
+      username: admin
+      password: admin
+plans:
+  cloudcontroller:
+    credentialTTL: 1h
+    renewBefore: 10m
+cloudfoundries:
+  cf-a:
+    apiURL: `+fake.URL+`
+    uaaURL: `+fake.URL+`
+    username: admin
+    password: secret
+`)
+
+	return fake, func() {
+		restoreConfig()
+		restoreMonitor()
+		restoreStore()
+		fake.Close()
+	}
+}
+
+// useFakeFoundationConfig configures platform basic auth, the config section
+// and foundation cf-a served by fake. The foundation lines are added to the
+// configuration of cf-a.
+func useFakeFoundationConfig(t *testing.T, fake *foundationtest.Server, section string, foundation ...string) func() {
+	cfa := ""
+	for _, line := range foundation {
+		cfa += "    " + line + "\n"
+	}
+	return useConfig(t, `
+server:
+  authtype: basic
+  basicauth:
+    username: username
+    password: password
+`+strings.TrimLeft(section, "\n")+`
+cloudfoundries:
+  cf-a:
+    apiURL: `+fake.URL+`
+    uaaURL: `+fake.URL+`
+    username: admin
+    password: secret
+`+cfa)
+}
+
+// useBindingFoundation uses a fake foundation and provisions instance i1
+// in org "org" and space "space" on it
+func useBindingFoundation(t *testing.T) (*foundationtest.Server, func()) {
+	fake, cleanup := useFakeFoundation(t)
+	assert.Equal(t, http.StatusOK, provision(NewRouter(staticDir), "i1").Code)
+	return fake, cleanup
+}
+
+func sendBinding(method string, instanceID string, bindingID string, body string) *httptest.ResponseRecorder {
+	request, _ := http.NewRequest(method, "/v2/service_instances/"+instanceID+"/service_bindings/"+bindingID+"/", bytes.NewBufferString(body))
+	request.SetBasicAuth("username", "password")
+	request.Header.Set(headerAPIVersion, "2.14")
+	response := httptest.NewRecorder()
+	NewRouter(staticDir).ServeHTTP(response, request)
+	return response
+}
+
+func bindingCredentialsOf(t *testing.T, response *httptest.ResponseRecorder) map[string]interface{} {
+	result := openapi.ServiceBindingResponse{}
+	assert.Nil(t, json.Unmarshal(response.Body.Bytes(), &result))
+	return result.Credentials
+}
+
+func TestBind(t *testing.T) {
+	fake, cleanup := useBindingFoundation(t)
+	defer cleanup()
+
+	response := sendBinding(http.MethodPut, "i1", "b1", `{"service_id": "cf", "plan_id": "cloudcontroller"}`)
+	assert.Equal(t, http.StatusCreated, response.Code)
+
+	credentials := bindingCredentialsOf(t, response)
+	assert.Equal(t, "cf-api-broker-b1", credentials["client_id"])
+	assert.NotEmpty(t, credentials["client_secret"])
+	assert.Equal(t, fake.URL, credentials["uaa_url"])
+	assert.Equal(t, credentials["client_secret"], fake.Client("cf-api-broker-b1")["client_secret"])
+
+	binding, err := instanceStore.GetBinding(context.Background(), "b1")
+	assert.NoError(t, err)
+	assert.Equal(t, defaultBindingScopes, binding.Scopes)
+	assert.Equal(t, time.Hour, binding.ExpiresAt.Sub(binding.CreatedAt))
+	assert.Equal(t, 10*time.Minute, binding.ExpiresAt.Sub(binding.RenewBefore))
+
+	result := openapi.ServiceBindingResponse{}
+	json.Unmarshal(response.Body.Bytes(), &result)
+	assert.Equal(t, binding.ExpiresAt.Format(time.RFC3339), result.Metadata.ExpiresAt)
+	assert.Equal(t, binding.RenewBefore.Format(time.RFC3339), result.Metadata.RenewBefore)
+
+	response = sendBinding(http.MethodPut, "i1", "b1", `{"service_id": "cf", "plan_id": "cloudcontroller"}`)
+	assert.Equal(t, http.StatusOK, response.Code, "binding exists with identical attributes")
+	assert.Equal(t, credentials, bindingCredentialsOf(t, response))
+	response = sendBinding(http.MethodPut, "i1", "b1", `{"service_id": "cf", "plan_id": "cloudcontroller", "parameters": {"role": "space_developer"}}`)
+	assert.Equal(t, http.StatusConflict, response.Code, "binding exists with other parameters")
+
+	assert.Equal(t, http.StatusNotFound, sendBinding(http.MethodPut, "unknown", "b2", `{}`).Code)
+	assert.Equal(t, http.StatusBadRequest, sendBinding(http.MethodPut, "i1", "b2", `{`).Code)
+}
+
+func TestBindRotation(t *testing.T) {
+	fake, cleanup := useBindingFoundation(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	sendBinding(http.MethodPut, "i1", "b1", `{"service_id": "cf", "plan_id": "cloudcontroller"}`)
+	predecessor, _ := instanceStore.GetBinding(ctx, "b1")
+	predecessor.Scopes = []string{"cloud_controller.read"}
+	instanceStore.PutBinding(ctx, predecessor)
+
+	response := sendBinding(http.MethodPut, "i1", "b2", `{"service_id": "cf", "plan_id": "cloudcontroller", "predecessor_binding_id": "b1"}`)
+	assert.Equal(t, http.StatusCreated, response.Code)
+	credentials := bindingCredentialsOf(t, response)
+	assert.Equal(t, "cf-api-broker-b2", credentials["client_id"])
+	assert.NotEqual(t, predecessor.ClientSecret, credentials["client_secret"], "fresh credentials")
+	assert.Equal(t, []interface{}{"cloud_controller.read"}, credentials["scopes"], "scopes of the predecessor")
+
+	rotated, _ := instanceStore.GetBinding(ctx, "b2")
+	assert.Equal(t, "b1", rotated.PredecessorID)
+	assert.NotNil(t, fake.Client("cf-api-broker-b1"), "predecessor stays valid")
+
+	assert.Equal(t, http.StatusConflict, sendBinding(http.MethodPut, "i1", "b2", `{"predecessor_binding_id": "other"}`).Code)
+	assert.Equal(t, http.StatusOK, sendBinding(http.MethodPut, "i1", "b2", `{"predecessor_binding_id": "b1"}`).Code, "parameters of the predecessor")
+	assert.Equal(t, http.StatusBadRequest, sendBinding(http.MethodPut, "i1", "b3", `{"predecessor_binding_id": "unknown"}`).Code)
+
+	assert.Equal(t, http.StatusOK, sendBinding(http.MethodDelete, "i1", "b1", "").Code)
+	assert.Nil(t, fake.Client("cf-api-broker-b1"))
+	assert.NotNil(t, fake.Client("cf-api-broker-b2"))
+
+	operations, _ := instanceStore.ListOperations(ctx, "i1")
+	types := []string{}
+	for _, operation := range operations {
+		types = append(types, operation.Type)
+	}
+	assert.Equal(t, []string{store.OperationProvision, store.OperationBind, store.OperationBind, store.OperationUnbind}, types)
+}
+
+func TestBindConcurrentOperation(t *testing.T) {
+	_, cleanup := useBindingFoundation(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	instance, _ := instanceStore.GetInstance(ctx, "i1")
+	instance.State = store.StateInProgress
+	instanceStore.PutInstance(ctx, instance)
+
+	response := sendBinding(http.MethodPut, "i1", "b1", `{}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, response.Code)
+	assert.Contains(t, response.Body.String(), "ConcurrencyError")
+}
+
+func TestBindFoundationFailure(t *testing.T) {
+	fake, cleanup := useBindingFoundation(t)
+	defer cleanup()
+
+	fake.Fail("POST /oauth/clients")
+	assert.Equal(t, http.StatusInternalServerError, sendBinding(http.MethodPut, "i1", "b1", `{}`).Code)
+
+	_, err := instanceStore.GetBinding(context.Background(), "b1")
+	assert.Equal(t, store.ErrNotFound, err)
+}
+
+func TestUnbind(t *testing.T) {
+	fake, cleanup := useBindingFoundation(t)
+	defer cleanup()
+
+	sendBinding(http.MethodPut, "i1", "b1", `{}`)
+
+	fake.Fail("DELETE /oauth/clients")
+	assert.Equal(t, http.StatusInternalServerError, sendBinding(http.MethodDelete, "i1", "b1", "").Code, "binding kept for retry")
+	_, err := instanceStore.GetBinding(context.Background(), "b1")
+	assert.NoError(t, err)
+
+	assert.Equal(t, http.StatusGone, sendBinding(http.MethodDelete, "i1", "unknown", "").Code)
+	assert.Equal(t, http.StatusGone, sendBinding(http.MethodDelete, "other", "b1", "").Code)
+}
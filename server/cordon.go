@@ -0,0 +1,185 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"github.com/sklevenz/cf-api-broker/config"
+	"github.com/sklevenz/cf-api-broker/store"
+)
+
+// drainReport lists what still references a foundation. PendingRotations
+// counts migrated or upgraded bindings whose former credentials still live on
+// the foundation. A cordoned foundation without instances and pending rotations
+// is drained and can be removed from configuration.
+type drainReport struct {
+	Foundation       string   `json:"foundation"`
+	Cordoned         bool     `json:"cordoned"`
+	Drained          bool     `json:"drained"`
+	Instances        int      `json:"instances"`
+	Bindings         int      `json:"bindings"`
+	PendingRotations int      `json:"pending_rotations"`
+	References       []string `json:"references"`
+}
+
+// isCordoned reports whether a foundation is closed for new placements. The
+// cordon state set through the admin API is kept in the store and takes
+// precedence over the configuration. Foundations are treated as cordoned if
+// the store cannot be read.
+func isCordoned(name string) bool {
+	cordons, err := instanceStore.ListCordons(context.Background())
+	if err != nil {
+		log.WithField("foundation", name).Errorf("Error reading cordons: %v", err)
+		return true
+	}
+	if cordoned, ok := cordons[name]; ok {
+		return cordoned
+	}
+	return config.Get().CloudFoundries[name].Cordoned
+}
+
+func setCordoned(ctx context.Context, name string, cordoned bool) error {
+	return instanceStore.PutCordon(ctx, name, cordoned)
+}
+
+// CheckFoundationReferences fails if stored instances are placed on a
+// foundation that is no longer configured, or bindings still hold
+// credentials there. Foundations have to be cordoned and drained before they
+// are removed from configuration.
+func CheckFoundationReferences(ctx context.Context) error {
+	instances, err := instanceStore.ListInstances(ctx)
+	if err != nil {
+		return err
+	}
+	bindings, err := instanceStore.ListBindings(ctx)
+	if err != nil {
+		return err
+	}
+
+	configured := config.Get().CloudFoundries
+	instanceCounts := map[string]int{}
+	bindingCounts := map[string]int{}
+	for _, instance := range instances {
+		if _, ok := configured[instance.Foundation]; !ok {
+			instanceCounts[instance.Foundation]++
+		}
+	}
+	for _, binding := range bindings {
+		for _, name := range credentialFoundations(binding) {
+			if _, ok := configured[name]; !ok {
+				bindingCounts[name]++
+			}
+		}
+	}
+	if len(instanceCounts) == 0 && len(bindingCounts) == 0 {
+		return nil
+	}
+
+	names := map[string]bool{}
+	for name := range instanceCounts {
+		names[name] = true
+	}
+	for name := range bindingCounts {
+		names[name] = true
+	}
+	missing := []string{}
+	for name := range names {
+		counts := []string{}
+		if instanceCounts[name] > 0 {
+			counts = append(counts, fmt.Sprintf("%v instances", instanceCounts[name]))
+		}
+		if bindingCounts[name] > 0 {
+			counts = append(counts, fmt.Sprintf("%v bindings pending rotation", bindingCounts[name]))
+		}
+		missing = append(missing, fmt.Sprintf("\"%v\" (%v)", name, strings.Join(counts, ", ")))
+	}
+	sort.Strings(missing)
+	return fmt.Errorf("Config error: removed foundations still referenced: %v, drain them before removal", strings.Join(missing, ", "))
+}
+
+// credentialFoundations returns the foundations other than the one of its
+// instance where a binding still holds credentials, because it was migrated
+// or upgraded and not yet rotated
+func credentialFoundations(binding *store.Binding) []string {
+	names := []string{}
+	if binding.SourceFoundation != "" {
+		names = append(names, binding.SourceFoundation)
+	}
+	for _, retired := range binding.RetiredClients {
+		if !contains(names, retired.Foundation) {
+			names = append(names, retired.Foundation)
+		}
+	}
+	return names
+}
+
+// foundationDrainReport counts the instances and bindings on a foundation
+func foundationDrainReport(ctx context.Context, name string) (*drainReport, error) {
+	instances, err := instanceStore.ListInstances(ctx)
+	if err != nil {
+		return nil, err
+	}
+	bindings, err := instanceStore.ListBindings(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &drainReport{Foundation: name, Cordoned: isCordoned(name), References: []string{}}
+	placed := map[string]bool{}
+	for _, instance := range instances {
+		if instance.Foundation == name {
+			placed[instance.ID] = true
+			report.References = append(report.References, instance.ID)
+		}
+	}
+	for _, binding := range bindings {
+		if placed[binding.InstanceID] {
+			report.Bindings++
+		}
+		if contains(credentialFoundations(binding), name) {
+			report.PendingRotations++
+		}
+	}
+	sort.Strings(report.References)
+	report.Instances = len(report.References)
+	report.Drained = report.Cordoned && report.Instances == 0 && report.PendingRotations == 0
+	return report, nil
+}
+
+// cordonHandler cordons a foundation on PUT and uncordons it on DELETE and
+// returns its drain report
+func cordonHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["foundation"]
+	if _, ok := config.Get().CloudFoundries[name]; !ok {
+		handleHTTPError(w, http.StatusNotFound, fmt.Errorf("foundation %v not found", name))
+		return
+	}
+	addLogField(r, "foundation", name)
+
+	if err := setCordoned(r.Context(), name, r.Method == http.MethodPut); err != nil {
+		handleHTTPError(w, http.StatusInternalServerError, err)
+		return
+	}
+	drainHandler(w, r)
+}
+
+// drainHandler reports how many instances still reference a foundation
+func drainHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["foundation"]
+	if _, ok := config.Get().CloudFoundries[name]; !ok {
+		handleHTTPError(w, http.StatusNotFound, fmt.Errorf("foundation %v not found", name))
+		return
+	}
+
+	report, err := foundationDrainReport(r.Context(), name)
+	if err != nil {
+		handleHTTPError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, report)
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/sklevenz/cf-api-broker/audit"
+	"github.com/sklevenz/cf-api-broker/foundation"
+	"github.com/sklevenz/cf-api-broker/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlaceInstanceSkipsCordoned(t *testing.T) {
+	defer useMemoryStore()()
+	defer useMonitor(foundation.NewMonitor(2, 0.9, 0.5))()
+	defer useConfig(t, `
+cloudfoundries:
+  cf-a:
+    cordoned: true
+  cf-b: {}
+`)()
+
+	ctx := context.Background()
+	instanceStore.PutInstance(ctx, &store.Instance{ID: "1", Foundation: "cf-b"})
+
+	name, err := placeInstance(ctx, nil, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "cf-b", name, "cordoned in config")
+
+	assert.NoError(t, setCordoned(ctx, "cf-a", false))
+	assert.NoError(t, setCordoned(ctx, "cf-b", true))
+	name, err = placeInstance(ctx, nil, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "cf-a", name, "overrides take precedence over config")
+}
+
+func TestCordonFoundation(t *testing.T) {
+	defer useMemoryStore()()
+	seedStore(t)
+
+	response := sendAdmin(http.MethodPut, "/admin/v1/foundations/cf-eu10-001/cordon/", "")
+	assert.Equal(t, http.StatusOK, response.Code)
+	report := drainReport{}
+	assert.Nil(t, json.Unmarshal(response.Body.Bytes(), &report))
+	assert.Equal(t, drainReport{Foundation: "cf-eu10-001", Cordoned: true, Instances: 2, Bindings: 2, References: []string{"i2", "i3"}}, report)
+
+	summary := foundationSummary{}
+	getAdmin(t, "/admin/v1/foundations/cf-eu10-001/", &summary)
+	assert.True(t, summary.Cordoned)
+	assert.False(t, summary.Placeable)
+
+	events, _ := auditor.Query(audit.Query{Operation: "cordon", Foundation: "cf-eu10-001"})
+	assert.NotEmpty(t, events)
+
+	response = sendAdmin(http.MethodDelete, "/admin/v1/foundations/cf-eu10-001/cordon/", "")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.False(t, isCordoned("cf-eu10-001"))
+	cordons, err := instanceStore.ListCordons(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"cf-eu10-001": false}, cordons, "kept in the store")
+
+	assert.Equal(t, http.StatusNotFound, sendAdmin(http.MethodPut, "/admin/v1/foundations/unknown/cordon/", "").Code)
+}
+
+func TestDrainReport(t *testing.T) {
+	defer useMemoryStore()()
+	seedStore(t)
+
+	report := drainReport{}
+	assert.Equal(t, http.StatusOK, getAdmin(t, "/admin/v1/foundations/cf-eu10/drain/", &report))
+	assert.Equal(t, 1, report.Instances)
+	assert.False(t, report.Drained, "not cordoned")
+
+	assert.NoError(t, setCordoned(context.Background(), "cf-eu10-002", true))
+	assert.Equal(t, http.StatusOK, getAdmin(t, "/admin/v1/foundations/cf-eu10-002/drain/", &report))
+	assert.Equal(t, 0, report.Instances)
+	assert.Empty(t, report.References)
+	assert.True(t, report.Drained)
+
+	assert.Equal(t, http.StatusNotFound, getAdmin(t, "/admin/v1/foundations/unknown/drain/", nil))
+}
+
+func TestMigrateToCordonedFoundation(t *testing.T) {
+	defer useMemoryStore()()
+	defer useMonitor(foundation.NewMonitor(2, 0.9, 0.5))()
+	source, _, cleanup := useMigrationFoundations(t)
+	defer cleanup()
+	seedMigration(t, source)
+
+	assert.NoError(t, setCordoned(context.Background(), "cf-b", true))
+	assert.Equal(t, http.StatusConflict, postAdmin("/admin/v1/instances/i1/migrations/", `{"target": "cf-b"}`).Code)
+	assert.Equal(t, http.StatusConflict, postAdmin("/admin/v1/instances/i1/migrations/", "").Code)
+}
+
+func TestCheckFoundationReferences(t *testing.T) {
+	defer useMemoryStore()()
+	defer useConfig(t, `
+cloudfoundries:
+  cf-a: {}
+`)()
+
+	ctx := context.Background()
+	instanceStore.PutInstance(ctx, &store.Instance{ID: "1", Foundation: "cf-a"})
+	assert.NoError(t, CheckFoundationReferences(ctx))
+
+	instanceStore.PutInstance(ctx, &store.Instance{ID: "2", Foundation: "cf-b"})
+	instanceStore.PutInstance(ctx, &store.Instance{ID: "3", Foundation: "cf-b"})
+	err := CheckFoundationReferences(ctx)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "\"cf-b\" (2 instances)")
+}
+
+func TestCheckFoundationReferencesOfBindings(t *testing.T) {
+	defer useMemoryStore()()
+	defer useConfig(t, `
+cloudfoundries:
+  cf-a: {}
+`)()
+
+	ctx := context.Background()
+	instanceStore.PutInstance(ctx, &store.Instance{ID: "1", Foundation: "cf-a"})
+	instanceStore.PutBinding(ctx, &store.Binding{ID: "b1", InstanceID: "1", SourceFoundation: "cf-b"})
+	err := CheckFoundationReferences(ctx)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "\"cf-b\" (1 bindings pending rotation)")
+
+	instanceStore.PutBinding(ctx, &store.Binding{ID: "b1", InstanceID: "1"})
+	instanceStore.PutBinding(ctx, &store.Binding{ID: "b2", InstanceID: "1", RetiredClients: []store.RetiredClient{{ClientID: "c1", Foundation: "cf-c"}}})
+	err = CheckFoundationReferences(ctx)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "\"cf-c\" (1 bindings pending rotation)")
+
+	instanceStore.PutBinding(ctx, &store.Binding{ID: "b2", InstanceID: "1", RetiredClients: []store.RetiredClient{{ClientID: "c1", Foundation: "cf-a"}}})
+	assert.NoError(t, CheckFoundationReferences(ctx))
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sklevenz/cf-api-broker/config"
+	"github.com/sklevenz/cf-api-broker/store"
+)
+
+const defaultDashboardTokenTTL time.Duration = 24 * time.Hour
+
+var (
+	errInvalidDashboardToken = errors.New("invalid dashboard token")
+	errExpiredDashboardToken = errors.New("dashboard token expired")
+)
+
+// dashboardURL returns a link to the dashboard of an instance signed at now,
+// or an empty string if dashboards are not configured
+func dashboardURL(instanceID string, now time.Time) string {
+	cfg := config.Get().Dashboard
+	if cfg.URL == "" || cfg.SigningKey == "" {
+		return ""
+	}
+
+	expiresAt := now.Add(durationOrDefault(cfg.TokenTTL, defaultDashboardTokenTTL))
+	token := dashboardToken(cfg.SigningKey, instanceID, expiresAt)
+	return fmt.Sprintf("%v/dashboard/%v/?token=%v", strings.TrimSuffix(cfg.URL, "/"), url.PathEscape(instanceID), url.QueryEscape(token))
+}
+
+// dashboardToken signs the dashboard of an instance until expiresAt. The
+// token is the expiry in unix seconds and the HMAC of instance and expiry.
+func dashboardToken(key string, instanceID string, expiresAt time.Time) string {
+	expiry := strconv.FormatInt(expiresAt.Unix(), 10)
+	return expiry + "." + base64.RawURLEncoding.EncodeToString(dashboardSignature(key, instanceID, expiry))
+}
+
+// verifyDashboardToken checks that token signs the dashboard of an instance
+// and is not expired at now
+func verifyDashboardToken(key string, instanceID string, token string, now time.Time) error {
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return errInvalidDashboardToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(signature, dashboardSignature(key, instanceID, parts[0])) {
+		return errInvalidDashboardToken
+	}
+	expiry, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return errInvalidDashboardToken
+	}
+	if !now.Before(time.Unix(expiry, 0)) {
+		return errExpiredDashboardToken
+	}
+	return nil
+}
+
+func dashboardSignature(key string, instanceID string, expiry string) []byte {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(instanceID + "\n" + expiry))
+	return mac.Sum(nil)
+}
+
+// dashboardPage holds the values shown on the dashboard of an instance
+type dashboardPage struct {
+	Instance   *store.Instance
+	APIURL     string
+	Bindings   []*store.Binding
+	Operations []*store.Operation
+}
+
+// dashboardHandler shows the foundation, bindings and operation history of an
+// instance. The route is public, access is granted by the signed token of the
+// dashboard URL. Binding secrets are never shown.
+func dashboardHandler(w http.ResponseWriter, r *http.Request) {
+	key := config.Get().Dashboard.SigningKey
+	if key == "" {
+		handleHTTPError(w, http.StatusNotFound, errors.New("dashboards are not configured"))
+		return
+	}
+
+	instanceID := mux.Vars(r)["instance_id"]
+	if err := verifyDashboardToken(key, instanceID, r.URL.Query().Get("token"), time.Now()); err != nil {
+		requestLogger(r).Warnf("Dashboard access denied: %v", err)
+		handleHTTPError(w, http.StatusForbidden, err)
+		return
+	}
+
+	instance, ok := requestInstance(w, r)
+	if !ok {
+		return
+	}
+	bindings, err := instanceBindings(r.Context(), instance.ID)
+	if err != nil {
+		handleHTTPError(w, http.StatusInternalServerError, err)
+		return
+	}
+	operations, err := instanceStore.ListOperations(r.Context(), instance.ID)
+	if err != nil {
+		handleHTTPError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set(headerContentType, contentTypeHTML)
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	err = dashboardTemplate.Execute(w, &dashboardPage{
+		Instance:   instance,
+		APIURL:     config.Get().CloudFoundries[instance.Foundation].APIURL,
+		Bindings:   bindings,
+		Operations: operations,
+	})
+	if err != nil {
+		requestLogger(r).Errorf("Error rendering dashboard: %v", err)
+	}
+}
+
+var dashboardTemplate = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"join": strings.Join,
+	"time": func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339)
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+
+  <head>
+    <title>Instance {{.Instance.ID}}</title>
+    <link rel="stylesheet" type="text/css" href="/static/css/broker.css">
+  </head>
+
+  <body>
+
+    <h1>Cloud Foundry API - Instance {{.Instance.ID}}</h1>
+
+    <table>
+      <tr><th>Plan</th><td>{{.Instance.PlanID}}</td></tr>
+      <tr><th>Foundation</th><td>{{.Instance.Foundation}}</td></tr>
+      <tr><th>API endpoint</th><td>{{.APIURL}}</td></tr>
+      {{- with .Instance.OrganizationName}}
+      <tr><th>Organization</th><td>{{.}}</td></tr>
+      {{- end}}
+      {{- with .Instance.SpaceName}}
+      <tr><th>Space</th><td>{{.}}</td></tr>
+      {{- end}}
+      <tr><th>State</th><td>{{.Instance.State}}</td></tr>
+      <tr><th>Created</th><td>{{time .Instance.CreatedAt}}</td></tr>
+    </table>
+
+    <h2>Bindings</h2>
+    <table>
+      <tr><th>Binding</th><th>Client</th><th>Role</th><th>Scopes</th><th>State</th><th>Expires</th></tr>
+      {{- range .Bindings}}
+      <tr><td>{{.ID}}</td><td>{{.ClientID}}</td><td>{{.Role}}</td><td>{{join .Scopes ", "}}</td><td>{{.State}}</td><td>{{time .ExpiresAt}}</td></tr>
+      {{- else}}
+      <tr><td colspan="6">No bindings</td></tr>
+      {{- end}}
+    </table>
+
+    <h2>Operations</h2>
+    <table>
+      <tr><th>Operation</th><th>State</th><th>Description</th><th>Started</th><th>Updated</th></tr>
+      {{- range .Operations}}
+      <tr><td>{{.Type}}{{with .BindingID}} {{.}}{{end}}</td><td>{{.State}}</td><td>{{.Description}}</td><td>{{time .StartedAt}}</td><td>{{time .UpdatedAt}}</td></tr>
+      {{- end}}
+    </table>
+
+  </body>
+
+</html>
+`))
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/sklevenz/cf-api-broker/foundation/foundationtest"
+	"github.com/sklevenz/cf-api-broker/openapi"
+	"github.com/stretchr/testify/assert"
+)
+
+// useDashboard configures dashboards of instances on the fake foundation
+func useDashboard(t *testing.T, fake *foundationtest.Server) func() {
+	return useFakeFoundationConfig(t, fake, `
+dashboard:
+  url: https://broker.example.com/
+  signingKey: secret
+  tokenTTL: 1h
+`)
+}
+
+// getDashboard requests the path and query of a dashboard URL without
+// authentication
+func getDashboard(t *testing.T, dashboardURL string) *httptest.ResponseRecorder {
+	parsed, err := url.Parse(dashboardURL)
+	assert.NoError(t, err)
+	request, _ := http.NewRequest(http.MethodGet, parsed.RequestURI(), nil)
+	response := httptest.NewRecorder()
+	NewRouter(staticDir).ServeHTTP(response, request)
+	return response
+}
+
+func TestDashboardToken(t *testing.T) {
+	now := time.Now()
+	token := dashboardToken("key", "i1", now.Add(time.Hour))
+
+	assert.NoError(t, verifyDashboardToken("key", "i1", token, now))
+	assert.Equal(t, errInvalidDashboardToken, verifyDashboardToken("key", "i2", token, now), "other instance")
+	assert.Equal(t, errInvalidDashboardToken, verifyDashboardToken("other", "i1", token, now), "other key")
+	assert.Equal(t, errExpiredDashboardToken, verifyDashboardToken("key", "i1", token, now.Add(time.Hour)))
+	assert.Equal(t, errInvalidDashboardToken, verifyDashboardToken("key", "i1", "", now))
+	assert.Equal(t, errInvalidDashboardToken, verifyDashboardToken("key", "i1", "9999999999"+token[len("9999999999"):], now.Add(2*time.Hour)), "extended expiry")
+}
+
+func TestDashboardURL(t *testing.T) {
+	defer useConfig(t, `
+dashboard:
+  url: https://broker.example.com/
+  signingKey: secret
+`)()
+
+	now := time.Now()
+	dashboardLink := dashboardURL("i 1", now)
+	parsed, err := url.Parse(dashboardLink)
+	assert.NoError(t, err)
+	assert.Equal(t, "broker.example.com", parsed.Host)
+	assert.Equal(t, "/dashboard/i 1/", parsed.Path)
+	assert.NoError(t, verifyDashboardToken("secret", "i 1", parsed.Query().Get("token"), now.Add(defaultDashboardTokenTTL-time.Minute)))
+
+	defer useConfig(t, `
+dashboard:
+  url: https://broker.example.com/
+`)()
+	assert.Empty(t, dashboardURL("i1", now), "no signing key")
+}
+
+func TestDashboard(t *testing.T) {
+	fake, cleanup := useFakeFoundation(t)
+	defer cleanup()
+	defer useDashboard(t, fake)()
+
+	response := provisionWith(NewRouter(staticDir), "i1", `{"service_id": "cf", "plan_id": "cloudcontroller"}`)
+	assert.Equal(t, http.StatusOK, response.Code)
+	provisioned := openapi.ServiceInstanceProvisionResponse{}
+	assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &provisioned))
+	assert.Contains(t, provisioned.DashboardUrl, "https://broker.example.com/dashboard/i1/?token=")
+	assert.Equal(t, http.StatusCreated, sendBinding(http.MethodPut, "i1", "b1", `{}`).Code)
+
+	response = getDashboard(t, provisioned.DashboardUrl)
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, contentTypeHTML, response.Header().Get(headerContentType))
+	assert.Equal(t, "no-store", response.Header().Get("Cache-Control"))
+	page := response.Body.String()
+	assert.Contains(t, page, "cf-a")
+	assert.Contains(t, page, fake.URL)
+	assert.Contains(t, page, "cf-api-broker-b1")
+	assert.Contains(t, page, "provision")
+	assert.Contains(t, page, "bind b1")
+
+	binding, _ := instanceStore.GetBinding(context.Background(), "b1")
+	assert.NotContains(t, page, binding.ClientSecret)
+
+	instance := openapi.ServiceInstanceResource{}
+	response = getV2("/v2/service_instances/i1/")
+	assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &instance))
+	assert.Equal(t, http.StatusOK, getDashboard(t, instance.DashboardUrl).Code, "GET instance returns a fresh link")
+}
+
+func TestDashboardForbidden(t *testing.T) {
+	fake, cleanup := useFakeFoundation(t)
+	defer cleanup()
+	defer useDashboard(t, fake)()
+	provisionWith(NewRouter(staticDir), "i1", `{"service_id": "cf", "plan_id": "cloudcontroller"}`)
+	provisionWith(NewRouter(staticDir), "i2", `{"service_id": "cf", "plan_id": "cloudcontroller"}`)
+
+	assert.Equal(t, http.StatusForbidden, getDashboard(t, "/dashboard/i1/").Code)
+	assert.Equal(t, http.StatusForbidden, getDashboard(t, "/dashboard/i1/?token=1.abc").Code)
+
+	token := dashboardToken("secret", "i2", time.Now().Add(time.Hour))
+	assert.Equal(t, http.StatusForbidden, getDashboard(t, "/dashboard/i1/?token="+url.QueryEscape(token)).Code, "token of other instance")
+
+	token = dashboardToken("secret", "i1", time.Now().Add(-time.Minute))
+	response := getDashboard(t, "/dashboard/i1/?token="+url.QueryEscape(token))
+	assert.Equal(t, http.StatusForbidden, response.Code)
+	assert.Contains(t, response.Body.String(), "expired")
+
+	token = dashboardToken("secret", "missing", time.Now().Add(time.Hour))
+	assert.Equal(t, http.StatusNotFound, getDashboard(t, "/dashboard/missing/?token="+url.QueryEscape(token)).Code)
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/sklevenz/cf-api-broker/config"
+	"github.com/sklevenz/cf-api-broker/foundation"
+)
+
+type cachedClient struct {
+	cf     config.CloudFoundry
+	client *foundation.Client
+}
+
+var (
+	foundationClients      = map[string]cachedClient{}
+	foundationClientsMutex sync.Mutex
+)
+
+// foundationClient returns the client of a configured foundation. Clients
+// and their UAA tokens are reused until the foundation configuration changes.
+func foundationClient(name string) (*foundation.Client, error) {
+	cf, ok := config.Get().CloudFoundries[name]
+	if !ok {
+		return nil, fmt.Errorf("foundation %v is not configured", name)
+	}
+
+	foundationClientsMutex.Lock()
+	defer foundationClientsMutex.Unlock()
+
+	cached, ok := foundationClients[name]
+	if !ok || cached.cf.APIURL != cf.APIURL || cached.cf.UAAURL != cf.UAAURL ||
+		cached.cf.UserName != cf.UserName || cached.cf.Password != cf.Password {
+		cached = cachedClient{cf: cf, client: foundation.NewClient(name, cf)}
+		foundationClients[name] = cached
+	}
+	return cached.client, nil
+}
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/sklevenz/cf-api-broker/config"
+	"github.com/sklevenz/cf-api-broker/foundation"
+	"github.com/sklevenz/cf-api-broker/health"
+)
+
+const (
+	defaultHealthInterval         time.Duration = 30 * time.Second
+	defaultHealthTimeout          time.Duration = 5 * time.Second
+	defaultHealthWindow           int           = 10
+	defaultHealthDegradedBelow    float64       = 0.9
+	defaultHealthUnavailableBelow float64       = 0.5
+)
+
+var (
+	// healthChecker probes the store and foundations in the background, it
+	// is nil until StartHealthChecks is called
+	healthChecker *health.Checker
+
+	// foundationMonitor tracks foundation availability from the probes of
+	// healthChecker, foundations are placeable until they are probed
+	foundationMonitor = foundation.NewMonitor(defaultHealthWindow, defaultHealthDegradedBelow, defaultHealthUnavailableBelow)
+
+	// draining is set once shutdown started so that load balancers stop
+	// sending new requests
+	draining int32
+)
+
+type readiness struct {
+	Status     string          `json:"status"`
+	Draining   bool            `json:"draining,omitempty"`
+	Components []health.Result `json:"components"`
+}
+
+// StartHealthChecks starts probing the store and the UAA and Cloud Controller
+// of each foundation. The returned function stops probing.
+func StartHealthChecks() func(ctx context.Context) error {
+	healthChecker = newHealthChecker()
+	healthChecker.Start()
+	return healthChecker.Stop
+}
+
+func newHealthChecker() *health.Checker {
+	cfg := config.Get()
+
+	checks := []health.Check{
+		{Name: "store", Critical: true, Probe: func(ctx context.Context) error {
+			return instanceStore.Ping(ctx)
+		}},
+	}
+
+	names := make([]string, 0, len(cfg.CloudFoundries))
+	for name := range cfg.CloudFoundries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		client, _ := foundationClient(name)
+		checks = append(checks,
+			health.Check{Name: name + ".uaa", Group: name, Probe: client.PingUAA},
+			health.Check{Name: name + ".cc", Group: name, Probe: client.PingCC},
+		)
+	}
+
+	checker := health.NewChecker(
+		durationOrDefault(cfg.Health.Interval, defaultHealthInterval),
+		durationOrDefault(cfg.Health.Timeout, defaultHealthTimeout),
+		checks...)
+
+	window := cfg.Health.Window
+	if window <= 0 {
+		window = defaultHealthWindow
+	}
+	degradedBelow := cfg.Health.DegradedBelow
+	if degradedBelow <= 0 {
+		degradedBelow = defaultHealthDegradedBelow
+	}
+	unavailableBelow := cfg.Health.UnavailableBelow
+	if unavailableBelow <= 0 {
+		unavailableBelow = defaultHealthUnavailableBelow
+	}
+	monitor := foundation.NewMonitor(window, degradedBelow, unavailableBelow)
+	checker.OnRun(func(results []health.Result) {
+		observeFoundations(monitor, results)
+	})
+	foundationMonitor = monitor
+
+	return checker
+}
+
+// observeFoundations records a probe per foundation, a foundation is up if
+// all its components are up
+func observeFoundations(monitor *foundation.Monitor, results []health.Result) {
+	up := map[string]bool{}
+	for _, result := range results {
+		if result.Group == "" || result.Status == health.StatusUnknown {
+			continue
+		}
+		groupUp, seen := up[result.Group]
+		up[result.Group] = result.Up() && (groupUp || !seen)
+	}
+
+	for name, groupUp := range up {
+		monitor.Observe(name, groupUp)
+	}
+}
+
+// isReady requires all critical components to be up and, if foundations
+// are configured, at least one foundation with all components up
+func isReady(results []health.Result) bool {
+	groups := map[string]bool{}
+	for _, result := range results {
+		if result.Critical && !result.Up() {
+			return false
+		}
+		if result.Group != "" {
+			up, seen := groups[result.Group]
+			groups[result.Group] = result.Up() && (up || !seen)
+		}
+	}
+
+	if len(groups) == 0 {
+		return true
+	}
+	for _, up := range groups {
+		if up {
+			return true
+		}
+	}
+	return false
+}
+
+// healthHandler reports liveness, the process is able to serve requests
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set(headerContentType, contentTypeJSON)
+	json.NewEncoder(w).Encode(map[string]bool{"ok": true})
+}
+
+// readyHandler reports readiness from the cached probe results and answers
+// 503 if the broker cannot serve requests
+func readyHandler(w http.ResponseWriter, r *http.Request) {
+	response := readiness{Status: health.StatusUp, Components: []health.Result{}}
+
+	if healthChecker != nil {
+		response.Components = healthChecker.Results()
+	}
+	response.Draining = atomic.LoadInt32(&draining) == 1
+
+	status := http.StatusOK
+	if healthChecker == nil || response.Draining || !isReady(response.Components) {
+		response.Status = health.StatusDown
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set(headerContentType, contentTypeJSON)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/sklevenz/cf-api-broker/foundation"
+	"github.com/sklevenz/cf-api-broker/health"
+	"github.com/stretchr/testify/assert"
+)
+
+func newFoundationServer(status int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+}
+
+func getReadiness(t *testing.T) (int, readiness) {
+	request, _ := http.NewRequest(http.MethodGet, "/health/ready", nil)
+	response := httptest.NewRecorder()
+	NewRouter(staticDir).ServeHTTP(response, request)
+
+	result := readiness{}
+	assert.Nil(t, json.Unmarshal(response.Body.Bytes(), &result))
+	return response.Code, result
+}
+
+func TestLive(t *testing.T) {
+	request, _ := http.NewRequest(http.MethodGet, "/health/live", nil)
+	response := httptest.NewRecorder()
+
+	NewRouter(staticDir).ServeHTTP(response, request)
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `{"ok":true}`, response.Body.String())
+}
+
+func TestReady(t *testing.T) {
+	up := newFoundationServer(http.StatusOK)
+	defer up.Close()
+	down := newFoundationServer(http.StatusServiceUnavailable)
+	defer down.Close()
+
+	defer useConfig(t, `
+cloudfoundries:
+  cf-up:
+    apiURL: `+up.URL+`
+    uaaURL: `+up.URL+`
+  cf-down:
+    apiURL: `+up.URL+`
+    uaaURL: `+down.URL+`
+`)()
+	defer useMonitor(foundationMonitor)()
+	defer func() { healthChecker = nil }()
+
+	healthChecker = newHealthChecker()
+	code, result := getReadiness(t)
+	assert.Equal(t, http.StatusServiceUnavailable, code, "not probed yet")
+	assert.Equal(t, health.StatusUnknown, result.Components[0].Status)
+
+	healthChecker.Run(context.Background())
+	code, result = getReadiness(t)
+
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, health.StatusUp, result.Status)
+	assert.Len(t, result.Components, 5)
+	assert.Equal(t, "store", result.Components[0].Name)
+	assert.True(t, result.Components[0].Critical)
+	assert.Equal(t, "cf-down.uaa", result.Components[1].Name)
+	assert.Equal(t, health.StatusDown, result.Components[1].Status)
+	assert.Contains(t, result.Components[1].Error, "503")
+	assert.Equal(t, "cf-down.cc", result.Components[2].Name)
+	assert.Equal(t, health.StatusUp, result.Components[2].Status)
+}
+
+func TestReadyNoFoundationReachable(t *testing.T) {
+	down := newFoundationServer(http.StatusBadGateway)
+	defer down.Close()
+
+	defer useConfig(t, `
+cloudfoundries:
+  cf-down:
+    apiURL: `+down.URL+`
+    uaaURL: `+down.URL+`
+`)()
+	defer useMonitor(foundationMonitor)()
+	defer func() { healthChecker = nil }()
+
+	healthChecker = newHealthChecker()
+	healthChecker.Run(context.Background())
+	code, result := getReadiness(t)
+
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, health.StatusDown, result.Status)
+}
+
+func TestReadyDraining(t *testing.T) {
+	defer useConfig(t, ``)()
+	defer useMonitor(foundationMonitor)()
+	defer func() {
+		healthChecker = nil
+		atomic.StoreInt32(&draining, 0)
+	}()
+
+	healthChecker = newHealthChecker()
+	healthChecker.Run(context.Background())
+	code, _ := getReadiness(t)
+	assert.Equal(t, http.StatusOK, code)
+
+	atomic.StoreInt32(&draining, 1)
+	code, result := getReadiness(t)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.True(t, result.Draining)
+}
+
+func TestIsReady(t *testing.T) {
+	up := health.Result{Status: health.StatusUp}
+	down := health.Result{Status: health.StatusDown}
+	critical := func(r health.Result) health.Result { r.Critical = true; return r }
+	group := func(r health.Result, g string) health.Result { r.Group = g; return r }
+
+	assert.True(t, isReady(nil))
+	assert.True(t, isReady([]health.Result{critical(up), down}))
+	assert.False(t, isReady([]health.Result{critical(down)}))
+	assert.True(t, isReady([]health.Result{group(up, "a"), group(up, "a"), group(down, "b"), group(up, "b")}))
+	assert.False(t, isReady([]health.Result{group(up, "a"), group(down, "a"), group(down, "b")}))
+	assert.False(t, isReady([]health.Result{group(down, "a"), group(up, "a")}))
+}
+
+func TestReadyObservesFoundations(t *testing.T) {
+	up := newFoundationServer(http.StatusOK)
+	defer up.Close()
+	down := newFoundationServer(http.StatusServiceUnavailable)
+	defer down.Close()
+
+	defer useConfig(t, `
+health:
+  window: 2
+cloudfoundries:
+  cf-up:
+    apiURL: `+up.URL+`
+    uaaURL: `+up.URL+`
+  cf-down:
+    apiURL: `+up.URL+`
+    uaaURL: `+down.URL+`
+`)()
+	defer useMonitor(foundationMonitor)()
+	defer func() { healthChecker = nil }()
+
+	healthChecker = newHealthChecker()
+	healthChecker.Run(context.Background())
+
+	assert.Equal(t, foundation.StateAvailable, foundationMonitor.Status("cf-up").State)
+	assert.Equal(t, foundation.StateUnavailable, foundationMonitor.Status("cf-down").State)
+	assert.Equal(t, 1, foundationMonitor.Status("cf-down").Samples)
+}
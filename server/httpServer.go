@@ -0,0 +1,129 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/sklevenz/cf-api-broker/config"
+)
+
+const (
+	defaultReadHeaderTimeout   time.Duration = 5 * time.Second
+	defaultReadTimeout         time.Duration = 30 * time.Second
+	defaultWriteTimeout        time.Duration = 60 * time.Second
+	defaultIdleTimeout         time.Duration = 120 * time.Second
+	defaultShutdownGracePeriod time.Duration = 30 * time.Second
+	defaultShutdownHooks       time.Duration = 10 * time.Second
+)
+
+type shutdownHook struct {
+	name string
+	hook func(ctx context.Context) error
+}
+
+var (
+	shutdownHooks []shutdownHook
+	shutdownMutex sync.Mutex
+)
+
+// OnShutdown registers a hook that runs after the server stopped serving
+// requests, e.g. to checkpoint async operations or flush telemetry. Like
+// deferred calls hooks run in reverse registration order, so that hooks
+// registered early like telemetry see the work of later ones. They share
+// their own budget, so that requests exceeding the grace period do not leave
+// them without time.
+func OnShutdown(name string, hook func(ctx context.Context) error) {
+	shutdownMutex.Lock()
+	defer shutdownMutex.Unlock()
+	shutdownHooks = append(shutdownHooks, shutdownHook{name: name, hook: hook})
+}
+
+// NewHTTPServer creates an http.Server with the timeouts from configuration
+func NewHTTPServer(addr string, handler http.Handler, tlsConfig *tls.Config) *http.Server {
+	timeouts := config.Get().Server.Timeouts
+
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: durationOrDefault(timeouts.ReadHeader, defaultReadHeaderTimeout),
+		ReadTimeout:       durationOrDefault(timeouts.Read, defaultReadTimeout),
+		WriteTimeout:      durationOrDefault(timeouts.Write, defaultWriteTimeout),
+		IdleTimeout:       durationOrDefault(timeouts.Idle, defaultIdleTimeout),
+	}
+}
+
+// Serve serves requests on listener until a signal is received on stop. It
+// then stops accepting connections, waits for in-flight requests within the
+// configured grace period and runs the shutdown hooks within their budget.
+func Serve(server *http.Server, listener net.Listener, stop <-chan os.Signal) error {
+	serveErr := make(chan error, 1)
+	go func() {
+		if server.TLSConfig != nil {
+			serveErr <- server.ServeTLS(listener, "", "")
+		} else {
+			serveErr <- server.Serve(listener)
+		}
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case sig := <-stop:
+		log.Infof("Received %v, shutting down", sig)
+	}
+	atomic.StoreInt32(&draining, 1)
+
+	gracePeriod := durationOrDefault(config.Get().Server.Timeouts.ShutdownGracePeriod, defaultShutdownGracePeriod)
+	ctx, cancel := context.WithTimeout(context.Background(), gracePeriod)
+	defer cancel()
+
+	err := server.Shutdown(ctx)
+	if err != nil {
+		log.Errorf("Error draining requests within %v: %v", gracePeriod, err)
+	} else {
+		log.Info("All requests drained")
+	}
+
+	hooksBudget := durationOrDefault(config.Get().Server.Timeouts.ShutdownHooks, defaultShutdownHooks)
+	hooksCtx, cancelHooks := context.WithTimeout(context.Background(), hooksBudget)
+	defer cancelHooks()
+	runShutdownHooks(hooksCtx)
+
+	if err == nil {
+		err = <-serveErr
+		if err == http.ErrServerClosed {
+			err = nil
+		}
+	}
+	return err
+}
+
+func runShutdownHooks(ctx context.Context) {
+	shutdownMutex.Lock()
+	hooks := append([]shutdownHook{}, shutdownHooks...)
+	shutdownMutex.Unlock()
+
+	for i := len(hooks) - 1; i >= 0; i-- {
+		h := hooks[i]
+		if err := h.hook(ctx); err != nil {
+			log.WithField("hook", h.name).Errorf("Error during shutdown: %v", err)
+		} else {
+			log.WithField("hook", h.name).Debug("Shutdown hook completed")
+		}
+	}
+}
+
+func durationOrDefault(d time.Duration, defaultDuration time.Duration) time.Duration {
+	if d <= 0 {
+		return defaultDuration
+	}
+	return d
+}
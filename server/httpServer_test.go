@@ -0,0 +1,146 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func resetShutdownHooks() func() {
+	saved := shutdownHooks
+	shutdownHooks = nil
+	return func() {
+		shutdownHooks = saved
+		atomic.StoreInt32(&draining, 0)
+	}
+}
+
+func TestNewHTTPServerTimeouts(t *testing.T) {
+	defer useConfig(t, `
+server:
+  timeouts:
+    read: 10s
+    idle: 1m
+`)()
+
+	server := NewHTTPServer(":0", http.NotFoundHandler(), nil)
+
+	assert.Equal(t, 10*time.Second, server.ReadTimeout)
+	assert.Equal(t, time.Minute, server.IdleTimeout)
+	assert.Equal(t, defaultReadHeaderTimeout, server.ReadHeaderTimeout)
+	assert.Equal(t, defaultWriteTimeout, server.WriteTimeout)
+}
+
+func TestServeDrainsInFlightRequests(t *testing.T) {
+	defer resetShutdownHooks()()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	hooks := []string{}
+	OnShutdown("first", func(ctx context.Context) error {
+		hooks = append(hooks, "first")
+		return nil
+	})
+	OnShutdown("second", func(ctx context.Context) error {
+		hooks = append(hooks, "second")
+		return nil
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	url := "http://" + listener.Addr().String() + "/"
+
+	stop := make(chan os.Signal, 1)
+	served := make(chan error, 1)
+	go func() {
+		served <- Serve(NewHTTPServer("", handler, nil), listener, stop)
+	}()
+
+	status := make(chan int, 1)
+	go func() {
+		response, err := http.Get(url)
+		if err != nil {
+			status <- 0
+			return
+		}
+		response.Body.Close()
+		status <- response.StatusCode
+	}()
+
+	<-started
+	stop <- syscall.SIGTERM
+
+	// new connections are refused once shutdown started
+	assert.Eventually(t, func() bool {
+		_, err := net.Dial("tcp", listener.Addr().String())
+		return err != nil
+	}, time.Second, 10*time.Millisecond)
+
+	close(release)
+	assert.Equal(t, http.StatusCreated, <-status)
+	assert.NoError(t, <-served)
+	assert.Equal(t, []string{"second", "first"}, hooks)
+}
+
+func TestServeGracePeriodExceeded(t *testing.T) {
+	defer resetShutdownHooks()()
+	defer useConfig(t, `
+server:
+  timeouts:
+    shutdownGracePeriod: 50ms
+    shutdownHooks: 50ms
+`)()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+
+	var budgetErr, hookErr error
+	OnShutdown("test", func(ctx context.Context) error {
+		budgetErr = ctx.Err()
+		<-ctx.Done()
+		hookErr = ctx.Err()
+		return errors.New("checkpoint incomplete")
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	stop := make(chan os.Signal, 1)
+	served := make(chan error, 1)
+	go func() {
+		served <- Serve(NewHTTPServer("", handler, nil), listener, stop)
+	}()
+
+	go http.Get("http://" + listener.Addr().String() + "/")
+
+	<-started
+	stop <- syscall.SIGINT
+
+	select {
+	case err := <-served:
+		assert.Equal(t, context.DeadlineExceeded, err)
+		assert.NoError(t, budgetErr, "hooks get their own budget")
+		assert.Equal(t, context.DeadlineExceeded, hookErr)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not stop within grace period")
+	}
+}
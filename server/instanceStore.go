@@ -0,0 +1,49 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sklevenz/cf-api-broker/config"
+	"github.com/sklevenz/cf-api-broker/metrics"
+	"github.com/sklevenz/cf-api-broker/store"
+)
+
+// instanceStore keeps the service instances, an in-memory store is used
+// until ConfigureStore is called
+var instanceStore = store.Traced(store.NewMemoryStore())
+
+// ConfigureStore creates the instance store from configuration and counts
+// its instances
+func ConfigureStore() error {
+	cfg := config.Get().Store
+
+	switch cfg.Type {
+	case "", config.StoreTypeMemory:
+		instanceStore = store.Traced(store.NewMemoryStore())
+	case config.StoreTypeFile:
+		fileStore, err := store.NewFileStore(cfg.Path)
+		if err != nil {
+			return fmt.Errorf("could not open store file: %v", err)
+		}
+		instanceStore = store.Traced(fileStore)
+	default:
+		return fmt.Errorf("Config error: unsupported store type: \"%v\"", cfg.Type)
+	}
+	return countInstances(context.Background())
+}
+
+// countInstances sets the instance gauges to the instances of the store,
+// which are only moved by provision, update and migration afterwards
+func countInstances(ctx context.Context) error {
+	instances, err := instanceStore.ListInstances(ctx)
+	if err != nil {
+		return fmt.Errorf("could not count instances: %v", err)
+	}
+
+	metrics.Instances.Reset()
+	for _, instance := range instances {
+		metrics.Instances.WithLabelValues(instance.Foundation, instance.PlanID).Inc()
+	}
+	return nil
+}
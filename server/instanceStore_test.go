@@ -0,0 +1,61 @@
+package server
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sklevenz/cf-api-broker/metrics"
+	"github.com/sklevenz/cf-api-broker/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigureStore(t *testing.T) {
+	defer func(saved store.Store) { instanceStore = saved }(instanceStore)
+	path := filepath.Join(t.TempDir(), "store.json")
+	defer useConfig(t, `
+store:
+  type: file
+  path: `+path+`
+`)()
+
+	assert.NoError(t, ConfigureStore())
+	assert.NoError(t, instanceStore.Ping(context.Background()))
+	assert.FileExists(t, path)
+}
+
+func TestConfigureStoreCountsInstances(t *testing.T) {
+	defer func(saved store.Store) { instanceStore = saved }(instanceStore)
+	path := filepath.Join(t.TempDir(), "store.json")
+	fileStore, err := store.NewFileStore(path)
+	assert.NoError(t, err)
+	fileStore.PutInstance(context.Background(), &store.Instance{ID: "i1", Foundation: "cf-count", PlanID: "small"})
+	fileStore.PutInstance(context.Background(), &store.Instance{ID: "i2", Foundation: "cf-count", PlanID: "small"})
+	defer useConfig(t, `
+store:
+  type: file
+  path: `+path+`
+`)()
+	metrics.Instances.WithLabelValues("cf-count", "small").Set(0)
+
+	assert.NoError(t, ConfigureStore())
+	assert.Equal(t, 2.0, testutil.ToFloat64(metrics.Instances.WithLabelValues("cf-count", "small")), "restarts keep the instance count")
+}
+
+func TestConfigureStoreUnsupported(t *testing.T) {
+	defer useConfig(t, `
+store:
+  type: etcd
+`)()
+
+	assert.Error(t, ConfigureStore())
+}
+
+func useMemoryStore() func() {
+	saved := instanceStore
+	instanceStore = store.NewMemoryStore()
+	return func() {
+		instanceStore = saved
+	}
+}
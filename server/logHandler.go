@@ -0,0 +1,198 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"github.com/sklevenz/cf-api-broker/config"
+	"github.com/sklevenz/cf-api-broker/tracing"
+)
+
+const (
+	requestLogKey contextKey = "requestLog"
+
+	logFormatText string = "text"
+	redacted      string = "[REDACTED]"
+)
+
+// redactedHeaders are never written to the log
+var redactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// ConfigureLogging sets level and format of the log from configuration.
+// The log is written as JSON unless format text is configured.
+func ConfigureLogging() error {
+	cfg := config.Get().Log
+
+	level := log.InfoLevel
+	if cfg.Level != "" {
+		parsed, err := log.ParseLevel(cfg.Level)
+		if err != nil {
+			return fmt.Errorf("Config error: invalid log level: %v", err)
+		}
+		level = parsed
+	}
+	log.SetLevel(level)
+
+	if cfg.Format == logFormatText {
+		log.SetFormatter(&log.TextFormatter{FullTimestamp: true})
+	} else {
+		log.SetFormatter(&log.JSONFormatter{})
+	}
+
+	return nil
+}
+
+// requestLog collects the fields of a request written with each log line.
+// Middlewares add fields once they know them, e.g. the authenticated
+// principal or the originating identity.
+type requestLog struct {
+	mutex  sync.Mutex
+	fields log.Fields
+}
+
+func (l *requestLog) set(key string, value interface{}) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.fields[key] = value
+}
+
+func (l *requestLog) entry() *log.Entry {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return log.WithFields(l.fields)
+}
+
+// requestLogger returns a log entry carrying the fields of the request
+func requestLogger(r *http.Request) *log.Entry {
+	if l, ok := r.Context().Value(requestLogKey).(*requestLog); ok {
+		return l.entry()
+	}
+	return log.NewEntry(log.StandardLogger())
+}
+
+// requestLogField returns a string field of the request log or an empty string
+func requestLogField(r *http.Request, key string) string {
+	if l, ok := r.Context().Value(requestLogKey).(*requestLog); ok {
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+		value, _ := l.fields[key].(string)
+		return value
+	}
+	return ""
+}
+
+// addLogField adds a field to all further log lines of the request
+func addLogField(r *http.Request, key string, value interface{}) {
+	if l, ok := r.Context().Value(requestLogKey).(*requestLog); ok {
+		l.set(key, value)
+	}
+}
+
+// statusRecorder remembers the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// code returns the written status code, handlers not writing a status
+// respond with 200
+func (s *statusRecorder) code() int {
+	if s.status == 0 {
+		return http.StatusOK
+	}
+	return s.status
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(data []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(data)
+}
+
+// logHandler correlates all log lines of a request by a request id and logs
+// method, route, status and latency when the request completes. The request
+// id is taken from X-Broker-API-Request-Identity or generated and returned
+// in the same response header.
+func logHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(headerAPIRequestIdentity)
+		if id == "" {
+			id = newUUID()
+		}
+		w.Header().Set(headerAPIRequestIdentity, id)
+
+		l := &requestLog{fields: log.Fields{
+			"request_id": id,
+			"method":     r.Method,
+			"path":       r.URL.Path,
+			"remote_ip":  clientIP(r),
+		}}
+		if route := mux.CurrentRoute(r); route != nil {
+			l.fields["route"] = route.GetName()
+		}
+		if traceID := tracing.TraceID(r.Context()); traceID != "" {
+			l.fields["trace_id"] = traceID
+		}
+		r = r.WithContext(context.WithValue(r.Context(), requestLogKey, l))
+
+		if log.IsLevelEnabled(log.DebugLevel) {
+			requestLogger(r).WithField("headers", redactHeaders(r.Header)).Debug("request received")
+		}
+
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+
+		status := recorder.code()
+
+		level := log.InfoLevel
+		if status >= http.StatusInternalServerError {
+			level = log.ErrorLevel
+		} else if status >= http.StatusBadRequest {
+			level = log.WarnLevel
+		}
+
+		l.entry().WithFields(log.Fields{
+			"status":     status,
+			"latency_ms": float64(time.Since(start).Microseconds()) / 1000,
+		}).Log(level, "request completed")
+	})
+}
+
+// redactHeaders flattens headers for logging and hides credentials
+func redactHeaders(header http.Header) map[string]string {
+	result := map[string]string{}
+	for name, values := range header {
+		result[name] = strings.Join(values, ", ")
+		for _, secret := range redactedHeaders {
+			if strings.EqualFold(name, secret) {
+				result[name] = redacted
+			}
+		}
+	}
+	return result
+}
+
+// newUUID generates a random UUID for request and operation ids
+func newUUID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
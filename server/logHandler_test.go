@@ -0,0 +1,113 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func captureLog(level log.Level) (*bytes.Buffer, func()) {
+	var buf bytes.Buffer
+	previous := log.GetLevel()
+	log.SetOutput(&buf)
+	log.SetLevel(level)
+	log.SetFormatter(&log.JSONFormatter{})
+
+	return &buf, func() {
+		log.SetOutput(os.Stderr)
+		log.SetLevel(previous)
+	}
+}
+
+func logLines(buf *bytes.Buffer) []map[string]interface{} {
+	lines := []map[string]interface{}{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		fields := map[string]interface{}{}
+		json.Unmarshal([]byte(line), &fields)
+		lines = append(lines, fields)
+	}
+	return lines
+}
+
+func TestLogRequestCompleted(t *testing.T) {
+	buf, restore := captureLog(log.InfoLevel)
+	defer restore()
+
+	request, _ := http.NewRequest(http.MethodGet, "/v2/catalog/", nil)
+	request.SetBasicAuth("username", "password")
+	request.Header.Set(headerAPIVersion, "2.14")
+	request.Header.Set(headerAPIRequestIdentity, "e26cee84-6b38-4456-b34e-d1a9f002c956")
+	request.Header.Set(headerAPIOrginatingIdentity, "cloudfoundry eyANCiAgInVzZXJfaWQiOiAiNjgzZWE3NDgtMzA5Mi00ZmY0LWI2NTYtMzljYWNjNGQ1MzYwIg0KfQ==")
+	response := httptest.NewRecorder()
+
+	NewRouter(staticDir).ServeHTTP(response, request)
+
+	lines := logLines(buf)
+	last := lines[len(lines)-1]
+	assert.Equal(t, "request completed", last["msg"])
+	assert.Equal(t, "info", last["level"])
+	assert.Equal(t, "e26cee84-6b38-4456-b34e-d1a9f002c956", last["request_id"])
+	assert.Equal(t, "GET", last["method"])
+	assert.Equal(t, "v2.catalog", last["route"])
+	assert.Equal(t, float64(http.StatusOK), last["status"])
+	assert.Equal(t, "username", last["principal"])
+	assert.Equal(t, "cloudfoundry", last["platform"])
+	assert.Equal(t, "683ea748-3092-4ff4-b656-39cacc4d5360", last["user_id"])
+	assert.Contains(t, last, "latency_ms")
+}
+
+func TestLogGeneratesRequestID(t *testing.T) {
+	buf, restore := captureLog(log.InfoLevel)
+	defer restore()
+
+	request, _ := http.NewRequest(http.MethodGet, "/health/", nil)
+	response := httptest.NewRecorder()
+
+	NewRouter(staticDir).ServeHTTP(response, request)
+
+	id := response.Header().Get(headerAPIRequestIdentity)
+	assert.Len(t, id, 36)
+
+	lines := logLines(buf)
+	assert.Equal(t, id, lines[len(lines)-1]["request_id"])
+}
+
+func TestLogRedactsSecrets(t *testing.T) {
+	buf, restore := captureLog(log.DebugLevel)
+	defer restore()
+
+	request, _ := http.NewRequest(http.MethodGet, "/", nil)
+	request.SetBasicAuth("username", "password")
+	request.Header.Set("Cookie", "session=secret")
+	response := httptest.NewRecorder()
+
+	NewRouter(staticDir).ServeHTTP(response, request)
+
+	assert.Contains(t, buf.String(), redacted)
+	assert.NotContains(t, buf.String(), request.Header.Get(headerAuthorization))
+	assert.NotContains(t, buf.String(), "session=secret")
+}
+
+func TestLogFailedRequestAsWarning(t *testing.T) {
+	buf, restore := captureLog(log.InfoLevel)
+	defer restore()
+
+	request, _ := http.NewRequest(http.MethodGet, "/", nil)
+	request.SetBasicAuth("username", "wrong")
+	response := httptest.NewRecorder()
+
+	NewRouter(staticDir).ServeHTTP(response, request)
+
+	lines := logLines(buf)
+	last := lines[len(lines)-1]
+	assert.Equal(t, "warning", last["level"])
+	assert.Equal(t, float64(http.StatusUnauthorized), last["status"])
+	assert.Equal(t, "home", last["route"])
+}
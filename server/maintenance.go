@@ -0,0 +1,121 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sklevenz/cf-api-broker/config"
+	"github.com/sklevenz/cf-api-broker/foundation"
+	"github.com/sklevenz/cf-api-broker/openapi"
+	"github.com/sklevenz/cf-api-broker/store"
+)
+
+// planMaintenanceInfo returns the maintenance info of a plan announced in the
+// catalog
+func planMaintenanceInfo(planID string) openapi.MaintenanceInfo {
+	info := config.Get().Plans[planID].MaintenanceInfo
+	return openapi.MaintenanceInfo{Version: info.Version, Description: info.Description}
+}
+
+// checkMaintenanceInfo fails if the platform requests a maintenance version
+// other than the one of the plan in the catalog. Platforms that send no
+// maintenance info get the version of the catalog.
+func checkMaintenanceInfo(planID string, requested openapi.MaintenanceInfo) error {
+	version := planMaintenanceInfo(planID).Version
+	if requested.Version != "" && requested.Version != version {
+		if version == "" {
+			return fmt.Errorf("plan %v has no maintenance info, requested version %v", planID, requested.Version)
+		}
+		return fmt.Errorf("maintenance version %v of plan %v does not match requested version %v", version, planID, requested.Version)
+	}
+	return nil
+}
+
+func handleMaintenanceInfoConflict(w http.ResponseWriter, err error) {
+	handleOSBError(w, http.StatusUnprocessableEntity, openapi.Error{
+		Error:       "MaintenanceInfoConflict",
+		Description: err.Error(),
+	})
+}
+
+// upgradeInstance re-issues the credentials of the bindings of an instance
+// with the role and scopes of the current plan configuration and marks the
+// bindings for rotation. The replaced clients stay valid until the bindings
+// are unbound, bound apps keep working until they rotate and get the new
+// credentials. It returns the number of re-issued bindings.
+func upgradeInstance(ctx context.Context, instance *store.Instance) (int, error) {
+	bindings, err := liveBindings(ctx, instance.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	upgradable := []*store.Binding{}
+	grants := []grant{}
+	for _, binding := range bindings {
+		if binding.ClientID == "" {
+			continue
+		}
+		granted, err := regrantBinding(instance, binding)
+		if err != nil {
+			return 0, fmt.Errorf("could not upgrade binding %v: %v", binding.ID, err)
+		}
+		upgradable = append(upgradable, binding)
+		grants = append(grants, granted)
+	}
+	if len(upgradable) == 0 {
+		return 0, nil
+	}
+
+	client, err := foundationClient(instance.Foundation)
+	if err != nil {
+		return 0, err
+	}
+	for i, binding := range upgradable {
+		if err := reissueCredentials(ctx, client, instance, binding, grants[i]); err != nil {
+			return i, fmt.Errorf("could not upgrade binding %v: %v", binding.ID, err)
+		}
+	}
+	return len(upgradable), nil
+}
+
+// reissueCredentials registers a new UAA client for a binding with granted
+// role and scopes and retires the clients it replaces
+func reissueCredentials(ctx context.Context, client *foundation.Client, instance *store.Instance, binding *store.Binding, granted grant) error {
+	secret, err := newSecret()
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	reissued := *binding
+	reissued.ClientID = fmt.Sprintf("%v%v-%v", bindingClientPrefix, binding.ID, len(binding.RetiredClients)+1)
+	reissued.ClientSecret = secret
+	reissued.Role = granted.Role
+	reissued.Scopes = granted.Scopes
+	reissued.ExpiresAt, reissued.RenewBefore = bindingExpiry(instance.PlanID, now)
+
+	reissued.RetiredClients = append(append([]store.RetiredClient{}, binding.RetiredClients...),
+		store.RetiredClient{ClientID: binding.ClientID, Role: binding.Role, Foundation: instance.Foundation})
+	if binding.SourceFoundation != "" {
+		reissued.RetiredClients = append(reissued.RetiredClients,
+			store.RetiredClient{ClientID: binding.ClientID, Role: binding.Role, Foundation: binding.SourceFoundation})
+		reissued.SourceFoundation = ""
+	}
+	reissued.RotationRequired = true
+	reissued.UpdatedAt = now
+
+	if err := takeOverClient(ctx, client, &reissued); err != nil {
+		return err
+	}
+	err = grantCredentials(ctx, client, instance, &reissued)
+	if err == nil {
+		err = instanceStore.PutBinding(ctx, &reissued)
+	}
+	if err != nil {
+		revokeCredentials(ctx, client, &reissued)
+		return err
+	}
+	*binding = reissued
+	return nil
+}
@@ -0,0 +1,194 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sklevenz/cf-api-broker/foundation/foundationtest"
+	"github.com/sklevenz/cf-api-broker/metrics"
+	"github.com/sklevenz/cf-api-broker/openapi"
+	"github.com/sklevenz/cf-api-broker/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func sendUpdate(instanceID string, body string) *httptest.ResponseRecorder {
+	request, _ := http.NewRequest(http.MethodPatch, "/v2/service_instances/"+instanceID+"/", bytes.NewBufferString(body))
+	request.SetBasicAuth("username", "password")
+	request.Header.Set(headerAPIVersion, "2.14")
+	response := httptest.NewRecorder()
+	NewRouter(staticDir).ServeHTTP(response, request)
+	return response
+}
+
+// useMaintenanceVersion configures the fake foundation with a maintenance
+// version and default scopes of plan cloudcontroller
+func useMaintenanceVersion(t *testing.T, fake *foundationtest.Server, version string, scopes string) func() {
+	return useFakeFoundationConfig(t, fake, `
+plans:
+  cloudcontroller:
+    defaultScopes: `+scopes+`
+    maintenanceInfo:
+      version: `+version+`
+      description: version `+version+`
+`)
+}
+
+func TestCheckMaintenanceInfo(t *testing.T) {
+	defer useConfig(t, `
+plans:
+  versioned:
+    maintenanceInfo:
+      version: 1.1.0
+`)()
+
+	assert.Equal(t, openapi.MaintenanceInfo{Version: "1.1.0"}, planMaintenanceInfo("versioned"))
+	assert.NoError(t, checkMaintenanceInfo("versioned", openapi.MaintenanceInfo{Version: "1.1.0"}))
+	assert.NoError(t, checkMaintenanceInfo("versioned", openapi.MaintenanceInfo{}), "platform without maintenance info")
+	assert.EqualError(t, checkMaintenanceInfo("versioned", openapi.MaintenanceInfo{Version: "1.0.0"}),
+		"maintenance version 1.1.0 of plan versioned does not match requested version 1.0.0")
+	assert.EqualError(t, checkMaintenanceInfo("unversioned", openapi.MaintenanceInfo{Version: "1.0.0"}),
+		"plan unversioned has no maintenance info, requested version 1.0.0")
+}
+
+func TestCatalogMaintenanceInfo(t *testing.T) {
+	defer useConfig(t, `
+plans:
+  cloudcontroller:
+    maintenanceInfo:
+      version: 2.0.0
+      description: new scopes
+`)()
+
+	plan := buildCatalog().Services[0].Plans[0]
+	assert.Equal(t, openapi.MaintenanceInfo{Version: "2.0.0", Description: "new scopes"}, plan.MaintenanceInfo)
+}
+
+func TestProvisionMaintenanceInfoConflict(t *testing.T) {
+	fake, cleanup := useFakeFoundation(t)
+	defer cleanup()
+	defer useMaintenanceVersion(t, fake, "1.0.0", "[cloud_controller.read]")()
+
+	response := provisionWith(NewRouter(staticDir), "i1", `{"service_id": "cf", "plan_id": "cloudcontroller", "maintenance_info": {"version": "0.9.0"}}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, response.Code)
+	assert.Contains(t, response.Body.String(), "MaintenanceInfoConflict")
+
+	response = provisionWith(NewRouter(staticDir), "i1", `{"service_id": "cf", "plan_id": "cloudcontroller", "maintenance_info": {"version": "1.0.0"}}`)
+	assert.Equal(t, http.StatusOK, response.Code)
+	instance, err := instanceStore.GetInstance(context.Background(), "i1")
+	assert.NoError(t, err)
+	assert.Equal(t, "1.0.0", instance.MaintenanceVersion)
+}
+
+func TestUpgradeInstance(t *testing.T) {
+	fake, cleanup := useFakeFoundation(t)
+	defer cleanup()
+	restore := useMaintenanceVersion(t, fake, "1.0.0", "[cloud_controller.read]")
+	provisionWith(NewRouter(staticDir), "i1", `{"service_id": "cf", "plan_id": "cloudcontroller"}`)
+	response := sendBinding(http.MethodPut, "i1", "b1", `{}`)
+	assert.Equal(t, http.StatusCreated, response.Code)
+	held := bindingCredentialsOf(t, response)
+	restore()
+	defer useMaintenanceVersion(t, fake, "2.0.0", "[cloud_controller.read, cloud_controller.write]")()
+
+	response = sendUpdate("i1", `{"service_id": "cf", "maintenance_info": {"version": "1.5.0"}}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, response.Code)
+	assert.Contains(t, response.Body.String(), "MaintenanceInfoConflict")
+
+	assert.Equal(t, http.StatusOK, sendUpdate("i1", `{"service_id": "cf", "maintenance_info": {"version": "2.0.0"}}`).Code)
+
+	instance, _ := instanceStore.GetInstance(context.Background(), "i1")
+	assert.Equal(t, "2.0.0", instance.MaintenanceVersion)
+	binding, _ := instanceStore.GetBinding(context.Background(), "b1")
+	assert.True(t, binding.RotationRequired)
+	assert.Equal(t, "cf-api-broker-b1-1", binding.ClientID)
+	assert.Equal(t, []string{"cloud_controller.read", "cloud_controller.write"}, binding.Scopes)
+	assert.Equal(t, []interface{}{"cloud_controller.read", "cloud_controller.write"}, fake.Client("cf-api-broker-b1-1")["authorities"])
+	assert.Equal(t, held["client_secret"], fake.Client("cf-api-broker-b1")["client_secret"], "running apps keep their credentials")
+	assert.Equal(t, []store.RetiredClient{{ClientID: "cf-api-broker-b1", Foundation: "cf-a"}}, binding.RetiredClients)
+
+	operations, _ := instanceStore.ListOperations(context.Background(), "i1")
+	last := operations[len(operations)-1]
+	assert.Equal(t, store.OperationUpdate, last.Type)
+	assert.Equal(t, "upgraded from maintenance version 1.0.0 to 2.0.0, re-issued credentials of 1 bindings", last.Description)
+
+	response = sendBinding(http.MethodPut, "i1", "b1", `{}`)
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "cf-api-broker-b1-1", bindingCredentialsOf(t, response)["client_id"], "the platform gets the re-issued credentials")
+
+	response = sendBinding(http.MethodPut, "i1", "b2", `{"predecessor_binding_id": "b1"}`)
+	assert.Equal(t, http.StatusCreated, response.Code)
+	assert.Equal(t, []interface{}{"cloud_controller.read", "cloud_controller.write"}, bindingCredentialsOf(t, response)["scopes"], "rotation keeps the upgraded scopes")
+
+	assert.Equal(t, http.StatusOK, sendUpdate("i1", `{"service_id": "cf", "parameters": {"size": 1}, "maintenance_info": {"version": "2.0.0"}}`).Code)
+	unchanged, _ := instanceStore.GetBinding(context.Background(), "b2")
+	assert.False(t, unchanged.RotationRequired, "no upgrade without a new version")
+	instance, _ = instanceStore.GetInstance(context.Background(), "i1")
+	assert.Equal(t, map[string]interface{}{"size": float64(1)}, instance.Parameters)
+
+	assert.Equal(t, http.StatusOK, sendBinding(http.MethodDelete, "i1", "b1", "").Code)
+	assert.Nil(t, fake.Client("cf-api-broker-b1"), "unbind revokes the retired credentials")
+	assert.Nil(t, fake.Client("cf-api-broker-b1-1"))
+}
+
+func TestChangePlanRegrantsBindings(t *testing.T) {
+	fake, cleanup := useFakeFoundation(t)
+	defer cleanup()
+	defer useFakeFoundationConfig(t, fake, `
+plans:
+  cloudcontroller:
+    defaultScopes: [cloud_controller.read]
+  bigger:
+    defaultScopes: [cloud_controller.read, cloud_controller.write]
+`)()
+	provisionWith(NewRouter(staticDir), "i1", `{"service_id": "cf", "plan_id": "cloudcontroller"}`)
+	assert.Equal(t, http.StatusCreated, sendBinding(http.MethodPut, "i1", "b1", `{}`).Code)
+
+	assert.Equal(t, http.StatusOK, sendUpdate("i1", `{"service_id": "cf", "plan_id": "bigger"}`).Code)
+
+	binding, _ := instanceStore.GetBinding(context.Background(), "b1")
+	assert.Equal(t, []string{"cloud_controller.read", "cloud_controller.write"}, binding.Scopes)
+	assert.True(t, binding.RotationRequired)
+	assert.NotNil(t, fake.Client("cf-api-broker-b1"), "the old client stays valid until rotation")
+
+	operations, _ := instanceStore.ListOperations(context.Background(), "i1")
+	assert.Equal(t, "changed plan from cloudcontroller to bigger, re-issued credentials of 1 bindings", operations[len(operations)-1].Description)
+}
+
+func TestFailedUpgradeKeepsMetrics(t *testing.T) {
+	defer useMemoryStore()()
+	defer useConfig(t, `
+plans:
+  bigger:
+    maintenanceInfo:
+      version: 2.0.0
+`)()
+	ctx := context.Background()
+	instanceStore.PutInstance(ctx, &store.Instance{ID: "i1", PlanID: "small", Foundation: "cf-metrics", OrganizationGUID: "org", SpaceGUID: "space", MaintenanceVersion: "1.0.0", State: store.StateSucceeded})
+	instanceStore.PutBinding(ctx, &store.Binding{ID: "b1", InstanceID: "i1", ClientID: "client", Role: "unknown_role", State: store.StateSucceeded})
+	small := metrics.Instances.WithLabelValues("cf-metrics", "small")
+	bigger := metrics.Instances.WithLabelValues("cf-metrics", "bigger")
+	small.Set(1)
+
+	instance, _ := instanceStore.GetInstance(ctx, "i1")
+	_, err := updateServiceInstance(ctx, instance, &openapi.ServiceInstanceUpdateRequest{PlanId: "bigger", MaintenanceInfo: openapi.MaintenanceInfo{Version: "2.0.0"}})
+	assert.Error(t, err)
+	assert.Equal(t, 1.0, testutil.ToFloat64(small), "failed updates do not move the instance")
+	assert.Equal(t, 0.0, testutil.ToFloat64(bigger))
+
+	instanceStore.DeleteBinding(ctx, "b1")
+	instance, _ = instanceStore.GetInstance(ctx, "i1")
+	_, err = updateServiceInstance(ctx, instance, &openapi.ServiceInstanceUpdateRequest{PlanId: "bigger", MaintenanceInfo: openapi.MaintenanceInfo{Version: "2.0.0"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, testutil.ToFloat64(small))
+	assert.Equal(t, 1.0, testutil.ToFloat64(bigger))
+}
+
+func TestUpdateUnknownInstance(t *testing.T) {
+	defer useMemoryStore()()
+
+	assert.Equal(t, http.StatusNotFound, sendUpdate("missing", `{"service_id": "cf"}`).Code)
+}
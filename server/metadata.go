@@ -0,0 +1,92 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/sklevenz/cf-api-broker/config"
+	"github.com/sklevenz/cf-api-broker/openapi"
+	"github.com/sklevenz/cf-api-broker/store"
+)
+
+// metadataValues are the values available in instance metadata templates
+type metadataValues struct {
+	Foundation string
+	APIURL     string
+	UAAURL     string
+	Region     string
+	Labels     []string
+	InstanceID string
+	PlanID     string
+	Platform   string
+}
+
+// instanceMetadata renders the configured metadata templates for an instance
+// placed on foundationName
+func instanceMetadata(foundationName string, instance *store.Instance) (store.Metadata, error) {
+	cf := config.Get().CloudFoundries[foundationName]
+	values := metadataValues{
+		Foundation: foundationName,
+		APIURL:     cf.APIURL,
+		UAAURL:     cf.UAAURL,
+		Region:     cf.Region,
+		Labels:     cf.Labels,
+		InstanceID: instance.ID,
+		PlanID:     instance.PlanID,
+		Platform:   instance.Platform,
+	}
+
+	templates := config.Get().InstanceMetadata
+	labels, err := renderMetadata(templates.Labels, values)
+	if err != nil {
+		return store.Metadata{}, err
+	}
+	attributes, err := renderMetadata(templates.Attributes, values)
+	if err != nil {
+		return store.Metadata{}, err
+	}
+	return store.Metadata{Labels: labels, Attributes: attributes}, nil
+}
+
+// renderMetadata renders named templates with values and leaves out empty
+// results
+func renderMetadata(templates map[string]string, values metadataValues) (map[string]string, error) {
+	if len(templates) == 0 {
+		return nil, nil
+	}
+
+	result := map[string]string{}
+	for name, text := range templates {
+		tmpl, err := template.New(name).Funcs(config.MetadataFuncs).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid metadata template %v: %v", name, err)
+		}
+		rendered := &strings.Builder{}
+		if err := tmpl.Execute(rendered, values); err != nil {
+			return nil, fmt.Errorf("could not render metadata %v: %v", name, err)
+		}
+		if rendered.Len() > 0 {
+			result[name] = rendered.String()
+		}
+	}
+	return result, nil
+}
+
+// osbMetadata converts the metadata of an instance for OSB responses
+func osbMetadata(metadata store.Metadata) openapi.ServiceInstanceMetadata {
+	result := openapi.ServiceInstanceMetadata{}
+	if len(metadata.Labels) > 0 {
+		result.Labels = map[string]interface{}{}
+		for name, value := range metadata.Labels {
+			result.Labels[name] = value
+		}
+	}
+	if len(metadata.Attributes) > 0 {
+		result.Attributes = map[string]interface{}{}
+		for name, value := range metadata.Attributes {
+			result.Attributes[name] = value
+		}
+	}
+	return result
+}
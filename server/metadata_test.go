@@ -0,0 +1,107 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sklevenz/cf-api-broker/foundation/foundationtest"
+	"github.com/sklevenz/cf-api-broker/openapi"
+	"github.com/sklevenz/cf-api-broker/store"
+	"github.com/stretchr/testify/assert"
+)
+
+// useMetadataTemplates configures metadata templates for the fake foundation
+func useMetadataTemplates(t *testing.T, fake *foundationtest.Server) func() {
+	return useFakeFoundationConfig(t, fake, `
+instanceMetadata:
+  labels:
+    foundation: "{{.Foundation}}"
+    region: "{{.Region}}"
+  attributes:
+    api_url: "{{.APIURL}}"
+    labels: '{{join .Labels ","}}'
+`, "region: eu10", "labels: [aws, scaleout]")
+}
+
+func getV2(path string) *httptest.ResponseRecorder {
+	request, _ := http.NewRequest(http.MethodGet, path, nil)
+	request.SetBasicAuth("username", "password")
+	request.Header.Set(headerAPIVersion, "2.14")
+	response := httptest.NewRecorder()
+	NewRouter(staticDir).ServeHTTP(response, request)
+	return response
+}
+
+func TestInstanceMetadata(t *testing.T) {
+	defer useConfig(t, `
+instanceMetadata:
+  labels:
+    foundation: "{{.Foundation}}"
+    region: "{{.Region}}"
+  attributes:
+    plan: "{{.PlanID}}"
+cloudfoundries:
+  cf-a:
+    apiURL: https://api.example.com
+`)()
+
+	metadata, err := instanceMetadata("cf-a", &store.Instance{ID: "i1", PlanID: "cloudcontroller"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"foundation": "cf-a"}, metadata.Labels, "empty region is left out")
+	assert.Equal(t, map[string]string{"plan": "cloudcontroller"}, metadata.Attributes)
+	assert.Equal(t, map[string]interface{}{"foundation": "cf-a"}, osbMetadata(metadata).Labels)
+
+	defer useConfig(t, `
+cloudfoundries:
+  cf-a:
+    apiURL: https://api.example.com
+`)()
+	metadata, err = instanceMetadata("cf-a", &store.Instance{ID: "i1"})
+	assert.NoError(t, err)
+	assert.Equal(t, store.Metadata{}, metadata, "no templates, no metadata")
+	assert.Equal(t, openapi.ServiceInstanceMetadata{}, osbMetadata(metadata))
+}
+
+func TestProvisionMetadata(t *testing.T) {
+	fake, cleanup := useFakeFoundation(t)
+	defer cleanup()
+	defer useMetadataTemplates(t, fake)()
+
+	expected := openapi.ServiceInstanceMetadata{
+		Labels:     map[string]interface{}{"foundation": "cf-a", "region": "eu10"},
+		Attributes: map[string]interface{}{"api_url": fake.URL, "labels": "aws,scaleout"},
+	}
+
+	response := provisionWith(NewRouter(staticDir), "i1", `{"service_id": "cf", "plan_id": "cloudcontroller"}`)
+	assert.Equal(t, http.StatusOK, response.Code)
+	provisioned := openapi.ServiceInstanceProvisionResponse{}
+	assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &provisioned))
+	assert.Equal(t, expected, provisioned.Metadata)
+
+	response = getV2("/v2/service_instances/i1/")
+	assert.Equal(t, http.StatusOK, response.Code)
+	instance := openapi.ServiceInstanceResource{}
+	assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &instance))
+	assert.Equal(t, "cloudcontroller", instance.PlanId)
+	assert.Equal(t, expected, instance.Metadata)
+
+	response = getV2("/v2/service_instances/i1/last_operation/")
+	assert.Equal(t, http.StatusOK, response.Code)
+	operation := lastOperationResponse{}
+	assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &operation))
+	assert.Equal(t, store.StateSucceeded, operation.State)
+	assert.Equal(t, expected, operation.Metadata)
+}
+
+func TestGetServiceNotFound(t *testing.T) {
+	fake, cleanup := useFakeFoundation(t)
+	defer cleanup()
+	defer useMetadataTemplates(t, fake)()
+	provisionWith(NewRouter(staticDir), "i1", `{"service_id": "cf", "plan_id": "cloudcontroller"}`)
+
+	assert.Equal(t, http.StatusNotFound, getV2("/v2/service_instances/missing/").Code)
+	assert.Equal(t, http.StatusNotFound, getV2("/v2/service_instances/missing/last_operation/").Code)
+	assert.Equal(t, http.StatusNotFound, getV2("/v2/service_instances/i1/last_operation/?operation=unknown").Code)
+}
@@ -0,0 +1,31 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sklevenz/cf-api-broker/metrics"
+)
+
+const unknownRoute string = "unknown"
+
+// metricsHandler counts requests and observes their latency by mux route
+// name, e.g. v2.catalog, and status code
+func metricsHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := unknownRoute
+		if current := mux.CurrentRoute(r); current != nil && current.GetName() != "" {
+			route = current.GetName()
+		}
+
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+
+		status := strconv.Itoa(recorder.code())
+		metrics.Requests.WithLabelValues(route, r.Method, status).Inc()
+		metrics.RequestDuration.WithLabelValues(route, status).Observe(time.Since(start).Seconds())
+	})
+}
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sklevenz/cf-api-broker/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsCountsRequestsByRoute(t *testing.T) {
+	counter := metrics.Requests.WithLabelValues("v2.catalog", http.MethodGet, "200")
+	before := testutil.ToFloat64(counter)
+
+	request, _ := http.NewRequest(http.MethodGet, "/v2/catalog/", nil)
+	request.SetBasicAuth("username", "password")
+	request.Header.Set(headerAPIVersion, "2.14")
+	response := httptest.NewRecorder()
+
+	NewRouter(staticDir).ServeHTTP(response, request)
+
+	assert.Equal(t, before+1, testutil.ToFloat64(counter))
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	router := NewRouter(staticDir)
+
+	request, _ := http.NewRequest(http.MethodGet, "/health/", nil)
+	router.ServeHTTP(httptest.NewRecorder(), request)
+
+	request, _ = http.NewRequest(http.MethodGet, "/metrics", nil)
+	request.SetBasicAuth("admin", "admin")
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Contains(t, response.Body.String(), `cf_api_broker_http_requests_total{method="GET",route="health",status="200"}`)
+	assert.Contains(t, response.Body.String(), `cf_api_broker_http_request_duration_seconds_bucket{route="health",status="200"`)
+
+	request, _ = http.NewRequest(http.MethodGet, "/metrics", nil)
+	request.SetBasicAuth("username", "password")
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+
+	assert.Equal(t, http.StatusUnauthorized, response.Code)
+}
@@ -0,0 +1,453 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"github.com/sklevenz/cf-api-broker/config"
+	"github.com/sklevenz/cf-api-broker/foundation"
+	"github.com/sklevenz/cf-api-broker/metrics"
+	"github.com/sklevenz/cf-api-broker/placement"
+	"github.com/sklevenz/cf-api-broker/store"
+	"github.com/sklevenz/cf-api-broker/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const rollbackTimeout time.Duration = 30 * time.Second
+
+// migrationRequest selects the target foundation of a migration. Without a
+// target a placeable foundation with the labels of the source is chosen.
+type migrationRequest struct {
+	Target string `json:"target"`
+}
+
+var (
+	// migrationMutex serialises starting migrations so that an instance is
+	// only migrated once at a time
+	migrationMutex sync.Mutex
+
+	// migrations tracks running migrations, migrationsCtx is cancelled on
+	// shutdown
+	migrations                      sync.WaitGroup
+	migrationsCtx, cancelMigrations = context.WithCancel(context.Background())
+)
+
+// StopMigrations interrupts running migrations, which checkpoint their
+// operation so that they are resumed when the broker starts again, and waits
+// for them within the budget of ctx. It is meant to run as shutdown hook.
+func StopMigrations(ctx context.Context) error {
+	cancelMigrations()
+
+	done := make(chan struct{})
+	go func() {
+		migrations.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// RecoverMigrations resumes migrations that were in progress when the broker
+// stopped. Clients already created on the target are taken over. Migrations
+// without a configured target are failed, so that their instances can be
+// migrated again.
+func RecoverMigrations(ctx context.Context) error {
+	instances, err := instanceStore.ListInstances(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, instance := range instances {
+		if instance.State != store.StateInProgress {
+			continue
+		}
+		operations, err := instanceStore.ListOperations(ctx, instance.ID)
+		if err != nil {
+			return err
+		}
+		for _, operation := range operations {
+			if operation.Type != store.OperationMigrate || operation.State != store.StateInProgress {
+				continue
+			}
+			logger := log.WithFields(log.Fields{"instance_id": instance.ID, "operation_id": operation.ID})
+
+			if _, ok := config.Get().CloudFoundries[operation.Target]; ok && operation.Target != instance.Foundation {
+				operation.Description = fmt.Sprintf("resuming migration from %v to %v after broker restart", instance.Foundation, operation.Target)
+				updateOperation(ctx, operation)
+
+				migrations.Add(1)
+				go func(instance store.Instance, operation store.Operation) {
+					defer migrations.Done()
+					migrateInstance(migrationsCtx, instance.ID, instance.Foundation, operation.Target, &operation)
+				}(*instance, *operation)
+				logger.Info("Resuming interrupted migration")
+				continue
+			}
+
+			operation.State = store.StateFailed
+			operation.Description = "migration interrupted by broker restart, credentials left on the target are replaced when the instance is migrated again"
+			operation.UpdatedAt = time.Now().UTC()
+			if err := instanceStore.PutOperation(ctx, operation); err != nil {
+				return err
+			}
+
+			instance.State = store.StateSucceeded
+			instance.UpdatedAt = operation.UpdatedAt
+			if err := instanceStore.PutInstance(ctx, instance); err != nil {
+				return err
+			}
+			logger.Warn("Recovered interrupted migration")
+		}
+	}
+	return nil
+}
+
+// migrateInstanceHandler starts an asynchronous migration of an instance to
+// another foundation and returns the migrate operation
+func migrateInstanceHandler(w http.ResponseWriter, r *http.Request) {
+	instanceID := mux.Vars(r)["instance_id"]
+
+	migration := migrationRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&migration); err != nil && err != io.EOF {
+		handleHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	migrationMutex.Lock()
+	defer migrationMutex.Unlock()
+
+	instance, err := instanceStore.GetInstance(r.Context(), instanceID)
+	if errors.Is(err, store.ErrNotFound) {
+		handleHTTPError(w, http.StatusNotFound, fmt.Errorf("instance %v not found", instanceID))
+		return
+	}
+	if err != nil {
+		handleHTTPError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if instance.State == store.StateInProgress {
+		handleHTTPError(w, http.StatusConflict, fmt.Errorf("instance %v has an operation in progress", instanceID))
+		return
+	}
+
+	source := instance.Foundation
+	target := migration.Target
+	switch {
+	case target == "":
+		target, err = placeInstance(r.Context(), config.Get().CloudFoundries[source].Labels, source)
+		if err == placement.ErrNoFoundation {
+			handleHTTPError(w, http.StatusConflict, fmt.Errorf("no placeable foundation with the labels of %v", source))
+			return
+		}
+		if err != nil {
+			handleHTTPError(w, http.StatusInternalServerError, err)
+			return
+		}
+	case target == source:
+		handleHTTPError(w, http.StatusBadRequest, fmt.Errorf("instance %v already is on %v", instanceID, target))
+		return
+	default:
+		if _, ok := config.Get().CloudFoundries[target]; !ok {
+			handleHTTPError(w, http.StatusBadRequest, fmt.Errorf("foundation %v is not configured", target))
+			return
+		}
+		if isCordoned(target) {
+			handleHTTPError(w, http.StatusConflict, fmt.Errorf("foundation %v is cordoned", target))
+			return
+		}
+		if !foundationMonitor.Status(target).Placeable() {
+			handleHTTPError(w, http.StatusConflict, fmt.Errorf("foundation %v is %v", target, foundationMonitor.Status(target).State))
+			return
+		}
+	}
+	addLogField(r, "foundation", target)
+
+	now := time.Now().UTC()
+	operation := &store.Operation{
+		ID:          newUUID(),
+		InstanceID:  instanceID,
+		Type:        store.OperationMigrate,
+		Target:      target,
+		State:       store.StateInProgress,
+		Description: fmt.Sprintf("migrating from %v to %v", source, target),
+		StartedAt:   now,
+		UpdatedAt:   now,
+	}
+	instance.State = store.StateInProgress
+	instance.UpdatedAt = now
+	if err := instanceStore.PutOperation(r.Context(), operation); err != nil {
+		handleHTTPError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err := instanceStore.PutInstance(r.Context(), instance); err != nil {
+		handleHTTPError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	migrations.Add(1)
+	go func(operation store.Operation) {
+		defer migrations.Done()
+		migrateInstance(migrationsCtx, instanceID, source, target, &operation)
+	}(*operation)
+
+	w.Header().Set(headerContentType, contentTypeJSON)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(operation)
+}
+
+// migrateInstance creates the UAA clients of all bindings with their roles on
+// the target, moves the instance and marks its bindings for rotation.
+// Expired bindings are left behind, their credentials stay revoked. The
+// clients on the source stay valid until the bindings are unbound, bound
+// apps keep working with the credentials they hold until they rotate. The org
+// and space of the instance have to exist on the target, its metadata is
+// rendered for the target. Clients left on the target by an interrupted
+// migration are taken over. On failure the clients created on the target are
+// removed again. A migration interrupted by shutdown keeps its operation in
+// progress to be resumed by RecoverMigrations.
+func migrateInstance(ctx context.Context, instanceID string, source string, target string, operation *store.Operation) {
+	metrics.AsyncOperationsInFlight.WithLabelValues(store.OperationMigrate).Inc()
+	defer metrics.AsyncOperationsInFlight.WithLabelValues(store.OperationMigrate).Dec()
+
+	ctx, span := tracing.Start(ctx, "migrate",
+		attribute.String("instance_id", instanceID),
+		attribute.String("source", source),
+		attribute.String("target", target))
+	logger := log.WithFields(log.Fields{"instance_id": instanceID, "operation_id": operation.ID, "foundation": target})
+
+	created := []*store.Binding{}
+	err := func() error {
+		targetClient, err := foundationClient(target)
+		if err != nil {
+			return err
+		}
+
+		instance, err := instanceStore.GetInstance(ctx, instanceID)
+		if err != nil {
+			return err
+		}
+		if instance.OrganizationGUID != "" {
+			if err := resolveSpace(ctx, target, instance); err != nil {
+				return err
+			}
+		}
+		if instance.Metadata, err = instanceMetadata(target, instance); err != nil {
+			return err
+		}
+
+		bindings, err := liveBindings(ctx, instanceID)
+		if err != nil {
+			return err
+		}
+
+		for i, binding := range bindings {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if binding.ClientID != "" && binding.SourceFoundation != target {
+				if err := takeOverClient(ctx, targetClient, binding); err != nil {
+					return fmt.Errorf("could not create credentials of binding %v: %v", binding.ID, err)
+				}
+				created = append(created, binding)
+				if err := grantCredentials(ctx, targetClient, instance, binding); err != nil {
+					return fmt.Errorf("could not grant role of binding %v: %v", binding.ID, err)
+				}
+			}
+
+			operation.Progress = (i + 1) * 100 / (len(bindings) + 1)
+			operation.Description = fmt.Sprintf("created credentials of %v of %v bindings on %v", i+1, len(bindings), target)
+			updateOperation(ctx, operation)
+		}
+
+		instance.Foundation = target
+		instance.State = store.StateSucceeded
+		instance.UpdatedAt = time.Now().UTC()
+		if err := instanceStore.PutInstance(ctx, instance); err != nil {
+			return err
+		}
+		metrics.Instances.WithLabelValues(source, instance.PlanID).Dec()
+		metrics.Instances.WithLabelValues(target, instance.PlanID).Inc()
+
+		unused := []*store.Binding{}
+		for _, binding := range bindings {
+			if binding.ClientID != "" {
+				switch binding.SourceFoundation {
+				case "":
+					binding.SourceFoundation = source
+				case target:
+					binding.SourceFoundation = ""
+					unused = append(unused, binding)
+				default:
+					unused = append(unused, binding)
+				}
+			}
+			binding.RotationRequired = true
+			binding.UpdatedAt = instance.UpdatedAt
+			if err := instanceStore.PutBinding(ctx, binding); err != nil {
+				logger.Errorf("Error marking binding %v for rotation: %v", binding.ID, err)
+			}
+		}
+
+		removeSourceClients(ctx, source, unused, logger)
+
+		operation.Progress = 100
+		operation.State = store.StateSucceeded
+		operation.Description = fmt.Sprintf("migrated from %v to %v, %v bindings marked for rotation", source, target, len(bindings))
+		return nil
+	}()
+
+	switch {
+	case err != nil && ctx.Err() != nil:
+		logger.Warnf("Migration interrupted, checkpointing: %v", err)
+		operation.Description = fmt.Sprintf("migration from %v to %v interrupted by shutdown, resumed when the broker starts", source, target)
+	case err != nil:
+		logger.Errorf("Migration failed, rolling back: %v", err)
+		rollbackMigration(instanceID, target, created, operation, err, logger)
+	default:
+		logger.Info("Migration succeeded")
+	}
+
+	updateOperation(context.Background(), operation)
+	tracing.End(span, err)
+}
+
+// takeOverClient registers the UAA client of a binding on a foundation. A
+// client with the same id, left behind by an interrupted migration, is
+// replaced so that migrations can be retried.
+func takeOverClient(ctx context.Context, client *foundation.Client, binding *store.Binding) error {
+	uaaClient := foundation.UAAClient{
+		ID:          binding.ClientID,
+		Secret:      binding.ClientSecret,
+		Authorities: binding.Scopes,
+	}
+	err := client.CreateUAAClient(ctx, uaaClient)
+	if err == foundation.ErrClientExists {
+		if err := revokeCredentials(ctx, client, binding); err != nil {
+			return err
+		}
+		err = client.CreateUAAClient(ctx, uaaClient)
+	}
+	return err
+}
+
+// rollbackMigration removes the clients created on the target and returns
+// the instance to its source foundation
+func rollbackMigration(instanceID string, target string, created []*store.Binding, operation *store.Operation, cause error, logger *log.Entry) {
+	ctx, cancel := context.WithTimeout(context.Background(), rollbackTimeout)
+	defer cancel()
+
+	if targetClient, err := foundationClient(target); err == nil {
+		for _, binding := range created {
+			if err := revokeCredentials(ctx, targetClient, binding); err != nil {
+				logger.Errorf("Error removing client %v during rollback: %v", binding.ClientID, err)
+			}
+		}
+	}
+
+	if instance, err := instanceStore.GetInstance(ctx, instanceID); err == nil {
+		instance.State = store.StateSucceeded
+		instance.UpdatedAt = time.Now().UTC()
+		if err := instanceStore.PutInstance(ctx, instance); err != nil {
+			logger.Errorf("Error restoring instance during rollback: %v", err)
+		}
+	}
+
+	operation.State = store.StateFailed
+	operation.Description = fmt.Sprintf("migration to %v failed and was rolled back: %v", target, cause)
+}
+
+// removeSourceClients revokes credentials on the source foundation that the
+// platform does not use, because the bindings were migrated before they were
+// rotated. Failures are logged, the migration itself succeeded.
+func removeSourceClients(ctx context.Context, source string, bindings []*store.Binding, logger *log.Entry) {
+	sourceClient, err := foundationClient(source)
+	if err != nil {
+		logger.Warnf("Credentials on source not removed: %v", err)
+		return
+	}
+	for _, binding := range bindings {
+		if err := revokeCredentials(ctx, sourceClient, binding); err != nil {
+			logger.Warnf("Error removing client %v from %v: %v", binding.ClientID, source, err)
+		}
+	}
+}
+
+func updateOperation(ctx context.Context, operation *store.Operation) {
+	operation.UpdatedAt = time.Now().UTC()
+	if err := instanceStore.PutOperation(ctx, operation); err != nil {
+		log.WithField("operation_id", operation.ID).Errorf("Error updating operation: %v", err)
+	}
+}
+
+// revokeSourceCredentials removes the credentials a migrated binding still
+// holds on the foundation it was migrated from
+func revokeSourceCredentials(ctx context.Context, binding *store.Binding) error {
+	if binding.SourceFoundation == "" {
+		return nil
+	}
+	client, err := foundationClient(binding.SourceFoundation)
+	if err != nil {
+		return err
+	}
+	return revokeCredentials(ctx, client, binding)
+}
+
+// revokeRetiredCredentials removes the credentials an upgrade replaced
+func revokeRetiredCredentials(ctx context.Context, binding *store.Binding) error {
+	for _, retired := range binding.RetiredClients {
+		client, err := foundationClient(retired.Foundation)
+		if err != nil {
+			return err
+		}
+		if err := revokeCredentials(ctx, client, &store.Binding{ClientID: retired.ClientID, Role: retired.Role}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// liveBindings returns the bindings of an instance whose credentials did not
+// expire
+func liveBindings(ctx context.Context, instanceID string) ([]*store.Binding, error) {
+	bindings, err := instanceBindings(ctx, instanceID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []*store.Binding{}
+	for _, binding := range bindings {
+		if binding.State != store.StateExpired {
+			result = append(result, binding)
+		}
+	}
+	return result, nil
+}
+
+// instanceBindings returns the bindings of an instance
+func instanceBindings(ctx context.Context, instanceID string) ([]*store.Binding, error) {
+	bindings, err := instanceStore.ListBindings(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []*store.Binding{}
+	for _, binding := range bindings {
+		if binding.InstanceID == instanceID {
+			result = append(result, binding)
+		}
+	}
+	return result, nil
+}
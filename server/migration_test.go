@@ -0,0 +1,325 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sklevenz/cf-api-broker/audit"
+	"github.com/sklevenz/cf-api-broker/foundation"
+	"github.com/sklevenz/cf-api-broker/foundation/foundationtest"
+	"github.com/sklevenz/cf-api-broker/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func postAdmin(path string, body string) *httptest.ResponseRecorder {
+	return sendAdmin(http.MethodPost, path, body)
+}
+
+func sendAdmin(method string, path string, body string) *httptest.ResponseRecorder {
+	request, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+	request.SetBasicAuth("admin", "admin")
+	response := httptest.NewRecorder()
+	NewRouter(staticDir).ServeHTTP(response, request)
+	return response
+}
+
+// useMigrationFoundations configures foundations cf-a and cf-b with label
+// scaleout and cf-c with label master, each served by a fake foundation
+func useMigrationFoundations(t *testing.T) (*foundationtest.Server, *foundationtest.Server, func()) {
+	source := foundationtest.NewServer()
+	target := foundationtest.NewServer()
+	other := foundationtest.NewServer()
+
+	restoreConfig := useConfig(t, `
+server:
+  authtype: basic
+  basicauth:
+    username: username
+    password: password
+  admin:
+    authtype: basic
+    basicauth:
+      username: admin
+      password: admin
+cloudfoundries:
+  cf-a:
+    apiURL: `+source.URL+`
+    uaaURL: `+source.URL+`
+    username: admin
+    password: secret
+    labels: [scaleout]
+  cf-b:
+    apiURL: `+target.URL+`
+    uaaURL: `+target.URL+`
+    username: admin
+    password: secret
+    labels: [scaleout]
+  cf-c:
+    apiURL: `+other.URL+`
+    uaaURL: `+other.URL+`
+    username: admin
+    password: secret
+    labels: [master]
+`)
+
+	return source, target, func() {
+		restoreConfig()
+		source.Close()
+		target.Close()
+		other.Close()
+	}
+}
+
+func seedMigration(t *testing.T, source *foundationtest.Server, clientIDs ...string) {
+	ctx := context.Background()
+	assert.NoError(t, instanceStore.PutInstance(ctx, &store.Instance{ID: "i1", PlanID: "cloudcontroller", Foundation: "cf-a", State: store.StateSucceeded}))
+
+	client, _ := foundationClient("cf-a")
+	for _, clientID := range clientIDs {
+		assert.NoError(t, instanceStore.PutBinding(ctx, &store.Binding{ID: "b-" + clientID, InstanceID: "i1", ClientID: clientID, ClientSecret: "secret-" + clientID, Scopes: []string{"cloud_controller.read"}, State: store.StateSucceeded}))
+		assert.NoError(t, client.CreateUAAClient(ctx, foundation.UAAClient{ID: clientID, Secret: "secret-" + clientID}))
+	}
+}
+
+func TestMigrateInstance(t *testing.T) {
+	defer useMemoryStore()()
+	defer useMonitor(foundation.NewMonitor(2, 0.9, 0.5))()
+	source, target, cleanup := useMigrationFoundations(t)
+	defer cleanup()
+	seedMigration(t, source, "client-1", "client-2")
+
+	response := postAdmin("/admin/v1/instances/i1/migrations/", "")
+	assert.Equal(t, http.StatusAccepted, response.Code)
+	operation := store.Operation{}
+	assert.Nil(t, json.Unmarshal(response.Body.Bytes(), &operation))
+	assert.Equal(t, store.OperationMigrate, operation.Type)
+	assert.Equal(t, store.StateInProgress, operation.State)
+
+	migrations.Wait()
+
+	ctx := context.Background()
+	instance, _ := instanceStore.GetInstance(ctx, "i1")
+	assert.Equal(t, "cf-b", instance.Foundation, "target has the labels of the source")
+	assert.Equal(t, store.StateSucceeded, instance.State)
+
+	assert.Equal(t, "secret-client-1", target.Client("client-1")["client_secret"])
+	assert.Equal(t, []interface{}{"cloud_controller.read"}, target.Client("client-2")["authorities"])
+	assert.Equal(t, 2, source.Clients(), "bound apps keep their credentials until rotation")
+
+	binding, _ := instanceStore.GetBinding(ctx, "b-client-1")
+	assert.True(t, binding.RotationRequired)
+	assert.Equal(t, "cf-a", binding.SourceFoundation)
+
+	finished, _ := instanceStore.GetOperation(ctx, "i1", operation.ID)
+	assert.Equal(t, store.StateSucceeded, finished.State)
+	assert.Equal(t, 100, finished.Progress)
+	assert.Contains(t, finished.Description, "2 bindings marked for rotation")
+
+	events, _ := auditor.Query(audit.Query{Operation: "migrate", InstanceID: "i1"})
+	assert.NotEmpty(t, events)
+	assert.Equal(t, "cf-b", events[len(events)-1].Foundation)
+}
+
+func TestMigrateInstanceSkipsExpiredBindings(t *testing.T) {
+	defer useMemoryStore()()
+	defer useMonitor(foundation.NewMonitor(2, 0.9, 0.5))()
+	source, target, cleanup := useMigrationFoundations(t)
+	defer cleanup()
+	seedMigration(t, source, "client-1")
+
+	ctx := context.Background()
+	assert.NoError(t, instanceStore.PutBinding(ctx, &store.Binding{ID: "b-expired", InstanceID: "i1", ClientID: "expired", ClientSecret: "secret-expired", State: store.StateExpired}))
+
+	postAdmin("/admin/v1/instances/i1/migrations/", `{"target": "cf-b"}`)
+	migrations.Wait()
+
+	instance, _ := instanceStore.GetInstance(ctx, "i1")
+	assert.Equal(t, "cf-b", instance.Foundation)
+	assert.NotNil(t, target.Client("client-1"))
+	assert.Nil(t, target.Client("expired"), "expired credentials are not brought back")
+
+	binding, _ := instanceStore.GetBinding(ctx, "b-expired")
+	assert.Equal(t, store.StateExpired, binding.State)
+	assert.False(t, binding.RotationRequired)
+	assert.Empty(t, binding.SourceFoundation)
+}
+
+func TestMigrateInstanceKeepsSourceCredentials(t *testing.T) {
+	defer useMemoryStore()()
+	defer useMonitor(foundation.NewMonitor(2, 0.9, 0.5))()
+	source, target, cleanup := useMigrationFoundations(t)
+	defer cleanup()
+	seedMigration(t, source, "client-1", "client-2")
+
+	postAdmin("/admin/v1/instances/i1/migrations/", `{"target": "cf-b"}`)
+	migrations.Wait()
+
+	report := drainReport{}
+	json.Unmarshal(sendAdmin(http.MethodPut, "/admin/v1/foundations/cf-a/cordon/", "").Body.Bytes(), &report)
+	assert.Equal(t, 0, report.Instances)
+	assert.Equal(t, 2, report.PendingRotations)
+	assert.False(t, report.Drained, "credentials of bound apps still live on cf-a")
+	sendAdmin(http.MethodDelete, "/admin/v1/foundations/cf-a/cordon/", "")
+
+	assert.Equal(t, http.StatusOK, sendBinding(http.MethodDelete, "i1", "b-client-1", "").Code)
+	assert.Nil(t, source.Client("client-1"), "unbind revokes the source credentials")
+	assert.Nil(t, target.Client("client-1"))
+
+	postAdmin("/admin/v1/instances/i1/migrations/", `{"target": "cf-a"}`)
+	migrations.Wait()
+
+	ctx := context.Background()
+	instance, _ := instanceStore.GetInstance(ctx, "i1")
+	assert.Equal(t, "cf-a", instance.Foundation)
+	assert.Equal(t, "secret-client-2", source.Client("client-2")["client_secret"], "migrating back reuses the kept client")
+	assert.Nil(t, target.Client("client-2"), "credentials never handed out are removed")
+	binding, _ := instanceStore.GetBinding(ctx, "b-client-2")
+	assert.Empty(t, binding.SourceFoundation)
+}
+
+func TestMigrateInstanceRollback(t *testing.T) {
+	defer useMemoryStore()()
+	defer useMonitor(foundation.NewMonitor(2, 0.9, 0.5))()
+	source, target, cleanup := useMigrationFoundations(t)
+	defer cleanup()
+	seedMigration(t, source, "client-1", "client-2")
+
+	// the second client exists on the target already and cannot be replaced
+	client, _ := foundationClient("cf-b")
+	assert.NoError(t, client.CreateUAAClient(context.Background(), foundation.UAAClient{ID: "client-2"}))
+	target.Fail("DELETE /oauth/clients/client-2")
+
+	response := postAdmin("/admin/v1/instances/i1/migrations/", `{"target": "cf-b"}`)
+	assert.Equal(t, http.StatusAccepted, response.Code)
+	operation := store.Operation{}
+	json.Unmarshal(response.Body.Bytes(), &operation)
+	migrations.Wait()
+
+	ctx := context.Background()
+	instance, _ := instanceStore.GetInstance(ctx, "i1")
+	assert.Equal(t, "cf-a", instance.Foundation)
+	assert.Equal(t, store.StateSucceeded, instance.State)
+
+	assert.Nil(t, target.Client("client-1"), "created clients are removed")
+	assert.Equal(t, 2, source.Clients())
+
+	binding, _ := instanceStore.GetBinding(ctx, "b-client-1")
+	assert.False(t, binding.RotationRequired)
+
+	failed, _ := instanceStore.GetOperation(ctx, "i1", operation.ID)
+	assert.Equal(t, store.StateFailed, failed.State)
+	assert.Contains(t, failed.Description, "rolled back")
+}
+
+func TestMigrateInstanceTakesOverLeftClients(t *testing.T) {
+	defer useMemoryStore()()
+	defer useMonitor(foundation.NewMonitor(2, 0.9, 0.5))()
+	source, target, cleanup := useMigrationFoundations(t)
+	defer cleanup()
+	seedMigration(t, source, "client-1", "client-2")
+	ctx := context.Background()
+
+	// an interrupted migration left the second client on the target
+	client, _ := foundationClient("cf-b")
+	assert.NoError(t, client.CreateUAAClient(ctx, foundation.UAAClient{ID: "client-2", Secret: "stale", Authorities: []string{"uaa.none"}}))
+	instance, _ := instanceStore.GetInstance(ctx, "i1")
+	instance.State = store.StateInProgress
+	instanceStore.PutInstance(ctx, instance)
+	instanceStore.PutOperation(ctx, &store.Operation{ID: "interrupted", InstanceID: "i1", Type: store.OperationMigrate, State: store.StateInProgress})
+	assert.NoError(t, RecoverMigrations(ctx))
+
+	assert.Equal(t, http.StatusAccepted, postAdmin("/admin/v1/instances/i1/migrations/", `{"target": "cf-b"}`).Code)
+	migrations.Wait()
+
+	instance, _ = instanceStore.GetInstance(ctx, "i1")
+	assert.Equal(t, "cf-b", instance.Foundation, "the retry succeeds")
+	assert.Equal(t, "secret-client-2", target.Client("client-2")["client_secret"])
+	assert.Equal(t, []interface{}{"cloud_controller.read"}, target.Client("client-2")["authorities"])
+}
+
+func TestMigrateInstanceValidation(t *testing.T) {
+	defer useMemoryStore()()
+	defer useMonitor(foundation.NewMonitor(2, 0.9, 0.5))()
+	source, _, cleanup := useMigrationFoundations(t)
+	defer cleanup()
+	seedMigration(t, source)
+
+	assert.Equal(t, http.StatusNotFound, postAdmin("/admin/v1/instances/unknown/migrations/", "").Code)
+	assert.Equal(t, http.StatusBadRequest, postAdmin("/admin/v1/instances/i1/migrations/", `{"target": "cf-a"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, postAdmin("/admin/v1/instances/i1/migrations/", `{"target": "cf-x"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, postAdmin("/admin/v1/instances/i1/migrations/", `{`).Code)
+
+	foundationMonitor.Observe("cf-b", false)
+	assert.Equal(t, http.StatusConflict, postAdmin("/admin/v1/instances/i1/migrations/", `{"target": "cf-b"}`).Code)
+	assert.Equal(t, http.StatusConflict, postAdmin("/admin/v1/instances/i1/migrations/", "").Code, "no placeable foundation with matching labels")
+
+	instance, _ := instanceStore.GetInstance(context.Background(), "i1")
+	instance.State = store.StateInProgress
+	instanceStore.PutInstance(context.Background(), instance)
+	assert.Equal(t, http.StatusConflict, postAdmin("/admin/v1/instances/i1/migrations/", `{"target": "cf-c"}`).Code)
+}
+
+func TestRecoverMigrations(t *testing.T) {
+	defer useMemoryStore()()
+	ctx := context.Background()
+	instanceStore.PutInstance(ctx, &store.Instance{ID: "i1", Foundation: "cf-a", State: store.StateInProgress})
+	instanceStore.PutOperation(ctx, &store.Operation{ID: "o1", InstanceID: "i1", Type: store.OperationMigrate, State: store.StateInProgress})
+	instanceStore.PutInstance(ctx, &store.Instance{ID: "i2", Foundation: "cf-a", State: store.StateInProgress})
+	instanceStore.PutOperation(ctx, &store.Operation{ID: "o2", InstanceID: "i2", Type: store.OperationMigrate, Target: "cf-x", State: store.StateInProgress})
+
+	assert.NoError(t, RecoverMigrations(ctx))
+
+	for _, id := range []string{"i1", "i2"} {
+		instance, _ := instanceStore.GetInstance(ctx, id)
+		assert.Equal(t, store.StateSucceeded, instance.State)
+	}
+	operation, _ := instanceStore.GetOperation(ctx, "i1", "o1")
+	assert.Equal(t, store.StateFailed, operation.State)
+	assert.Contains(t, operation.Description, "interrupted")
+	operation, _ = instanceStore.GetOperation(ctx, "i2", "o2")
+	assert.Equal(t, store.StateFailed, operation.State, "target not configured")
+}
+
+func TestResumeCheckpointedMigration(t *testing.T) {
+	defer useMemoryStore()()
+	defer useMonitor(foundation.NewMonitor(2, 0.9, 0.5))()
+	source, target, cleanup := useMigrationFoundations(t)
+	defer cleanup()
+	seedMigration(t, source, "client-1", "client-2")
+	ctx := context.Background()
+
+	instance, _ := instanceStore.GetInstance(ctx, "i1")
+	instance.State = store.StateInProgress
+	instanceStore.PutInstance(ctx, instance)
+	operation := &store.Operation{ID: "o1", InstanceID: "i1", Type: store.OperationMigrate, Target: "cf-b", State: store.StateInProgress}
+	instanceStore.PutOperation(ctx, operation)
+
+	// shutdown interrupts the migration after the first client was created
+	client, _ := foundationClient("cf-b")
+	assert.NoError(t, client.CreateUAAClient(ctx, foundation.UAAClient{ID: "client-1", Secret: "secret-client-1"}))
+	stopped, cancel := context.WithCancel(ctx)
+	cancel()
+	migrateInstance(stopped, "i1", "cf-a", "cf-b", operation)
+
+	checkpoint, _ := instanceStore.GetOperation(ctx, "i1", "o1")
+	assert.Equal(t, store.StateInProgress, checkpoint.State)
+	assert.Contains(t, checkpoint.Description, "interrupted by shutdown")
+	instance, _ = instanceStore.GetInstance(ctx, "i1")
+	assert.Equal(t, "cf-a", instance.Foundation)
+	assert.Equal(t, store.StateInProgress, instance.State)
+	assert.NotNil(t, target.Client("client-1"), "not rolled back")
+
+	assert.NoError(t, RecoverMigrations(ctx))
+	migrations.Wait()
+
+	instance, _ = instanceStore.GetInstance(ctx, "i1")
+	assert.Equal(t, "cf-b", instance.Foundation)
+	assert.Equal(t, store.StateSucceeded, instance.State)
+	assert.Equal(t, 2, target.Clients())
+	resumed, _ := instanceStore.GetOperation(ctx, "i1", "o1")
+	assert.Equal(t, store.StateSucceeded, resumed.State)
+}
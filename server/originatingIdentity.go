@@ -0,0 +1,143 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	originatingIdentityKey contextKey = "originatingIdentity"
+
+	platformCloudFoundry string = "cloudfoundry"
+	platformKubernetes   string = "kubernetes"
+)
+
+// cloudFoundryIdentity is the originating identity sent by Cloud Foundry
+type cloudFoundryIdentity struct {
+	UserID string `json:"user_id"`
+}
+
+// kubernetesIdentity is the originating identity sent by Kubernetes, the
+// user info of the Kubernetes authentication API
+type kubernetesIdentity struct {
+	Username string              `json:"username"`
+	UID      string              `json:"uid"`
+	Groups   []string            `json:"groups"`
+	Extra    map[string][]string `json:"extra"`
+}
+
+// originatingIdentity is the parsed X-Broker-API-Originating-Identity
+// header. Depending on the platform CloudFoundry or Kubernetes is set,
+// Properties always holds the decoded values.
+type originatingIdentity struct {
+	Platform     string
+	CloudFoundry *cloudFoundryIdentity
+	Kubernetes   *kubernetesIdentity
+	Properties   map[string]interface{}
+}
+
+// UserID returns the platform specific id of the user
+func (o *originatingIdentity) UserID() string {
+	switch {
+	case o.CloudFoundry != nil:
+		return o.CloudFoundry.UserID
+	case o.Kubernetes != nil:
+		return o.Kubernetes.UID
+	}
+	return ""
+}
+
+// UserName returns the user name if the platform sends one
+func (o *originatingIdentity) UserName() string {
+	if o.Kubernetes != nil {
+		return o.Kubernetes.Username
+	}
+	return ""
+}
+
+// parseOriginatingIdentityHeader parses a header value of the form
+// "platform base64(json)" as defined by the OSB API
+func parseOriginatingIdentityHeader(value string) (*originatingIdentity, error) {
+	values := strings.Fields(value)
+	if len(values) != 2 {
+		return nil, errors.New("expected platform and base64 encoded properties separated by a space")
+	}
+
+	identity := &originatingIdentity{Platform: values[0]}
+
+	encoded, err := base64.StdEncoding.DecodeString(values[1])
+	if err != nil {
+		encoded, err = base64.RawStdEncoding.DecodeString(values[1])
+	}
+	if err != nil {
+		return nil, errors.New("properties not base64 encoded")
+	}
+
+	if err := json.Unmarshal(encoded, &identity.Properties); err != nil || identity.Properties == nil {
+		return nil, errors.New("properties are not a JSON object")
+	}
+
+	switch identity.Platform {
+	case platformCloudFoundry:
+		identity.CloudFoundry = &cloudFoundryIdentity{}
+		if err := json.Unmarshal(encoded, identity.CloudFoundry); err != nil {
+			return nil, fmt.Errorf("invalid cloudfoundry properties: %v", err)
+		}
+		if identity.CloudFoundry.UserID == "" {
+			return nil, errors.New("cloudfoundry properties require user_id")
+		}
+	case platformKubernetes:
+		identity.Kubernetes = &kubernetesIdentity{}
+		if err := json.Unmarshal(encoded, identity.Kubernetes); err != nil {
+			return nil, fmt.Errorf("invalid kubernetes properties: %v", err)
+		}
+		if identity.Kubernetes.Username == "" || identity.Kubernetes.UID == "" {
+			return nil, errors.New("kubernetes properties require username and uid")
+		}
+	}
+
+	return identity, nil
+}
+
+// originatingIdentityFrom returns the originating identity of a request or
+// nil if the platform did not send one
+func originatingIdentityFrom(r *http.Request) *originatingIdentity {
+	identity, _ := r.Context().Value(originatingIdentityKey).(*originatingIdentity)
+	return identity
+}
+
+// originatingIdentityHandler parses the originating identity header into
+// the request context and rejects malformed headers
+func originatingIdentityHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headerValue := r.Header.Get(headerAPIOrginatingIdentity)
+		if headerValue == "" {
+			requestLogger(r).Debugf("Header %v not set", headerAPIOrginatingIdentity)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		identity, err := parseOriginatingIdentityHeader(headerValue)
+		if err != nil {
+			err = fmt.Errorf("malformed header %v: %v", headerAPIOrginatingIdentity, err)
+			requestLogger(r).Warnf("Error: %v", err)
+			handleHTTPError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		addLogField(r, "platform", identity.Platform)
+		if userID := identity.UserID(); userID != "" {
+			addLogField(r, "user_id", userID)
+		}
+		if userName := identity.UserName(); userName != "" {
+			addLogField(r, "user_name", userName)
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), originatingIdentityKey, identity)))
+	})
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func encodeIdentity(platform, properties string) string {
+	return platform + " " + base64.StdEncoding.EncodeToString([]byte(properties))
+}
+
+func TestParseOriginatingIdentityCloudFoundry(t *testing.T) {
+	identity, err := parseOriginatingIdentityHeader(encodeIdentity("cloudfoundry", `{"user_id": "683ea748-3092-4ff4-b656-39cacc4d5360"}`))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "cloudfoundry", identity.Platform)
+	assert.Equal(t, "683ea748-3092-4ff4-b656-39cacc4d5360", identity.UserID())
+	assert.Empty(t, identity.UserName())
+	assert.Nil(t, identity.Kubernetes)
+}
+
+func TestParseOriginatingIdentityKubernetes(t *testing.T) {
+	identity, err := parseOriginatingIdentityHeader(encodeIdentity("kubernetes",
+		`{"username": "duke", "uid": "c2dde242-5ce4-11e7-988c-000c2946f14f", "groups": ["admin", "dev"], "extra": {"mydata": ["data1", "data3"]}}`))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "kubernetes", identity.Platform)
+	assert.Equal(t, "duke", identity.UserName())
+	assert.Equal(t, "c2dde242-5ce4-11e7-988c-000c2946f14f", identity.UserID())
+	assert.Equal(t, []string{"admin", "dev"}, identity.Kubernetes.Groups)
+	assert.Equal(t, []string{"data1", "data3"}, identity.Kubernetes.Extra["mydata"])
+}
+
+func TestParseOriginatingIdentityOtherPlatform(t *testing.T) {
+	identity, err := parseOriginatingIdentityHeader(encodeIdentity("myplatform", `{"user": "someone"}`))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "myplatform", identity.Platform)
+	assert.Equal(t, "someone", identity.Properties["user"])
+	assert.Empty(t, identity.UserID())
+}
+
+func TestParseOriginatingIdentityUnpadded(t *testing.T) {
+	value := "cloudfoundry " + base64.RawStdEncoding.EncodeToString([]byte(`{"user_id":"abc"}`))
+	identity, err := parseOriginatingIdentityHeader(value)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", identity.UserID())
+}
+
+func TestParseOriginatingIdentityMalformed(t *testing.T) {
+	for name, value := range map[string]string{
+		"no space":           "cloudfoundry",
+		"too many parts":     "cloudfoundry abc def",
+		"not base64":         "cloudfoundry !!!",
+		"not json":           encodeIdentity("cloudfoundry", "user_id"),
+		"json array":         encodeIdentity("cloudfoundry", `["user_id"]`),
+		"cf without user":    encodeIdentity("cloudfoundry", `{"user_name": "x"}`),
+		"cf user wrong type": encodeIdentity("cloudfoundry", `{"user_id": 42}`),
+		"k8s without uid":    encodeIdentity("kubernetes", `{"username": "duke"}`),
+		"k8s groups string":  encodeIdentity("kubernetes", `{"username": "duke", "uid": "1", "groups": "admin"}`),
+	} {
+		_, err := parseOriginatingIdentityHeader(value)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestOriginatingIdentityHandler(t *testing.T) {
+	var identity *originatingIdentity
+	handler := originatingIdentityHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity = originatingIdentityFrom(r)
+	}))
+
+	request, _ := http.NewRequest(http.MethodGet, "/v2/catalog", nil)
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Nil(t, identity)
+
+	request.Header.Set(headerAPIOrginatingIdentity, encodeIdentity("kubernetes", `{"username": "duke", "uid": "1"}`))
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "duke", identity.UserName())
+}
+
+func TestOriginatingIdentityHandlerMalformed(t *testing.T) {
+	request, _ := http.NewRequest(http.MethodGet, "/v2/catalog", nil)
+	request.SetBasicAuth("username", "password")
+	request.Header.Set(headerAPIVersion, "2.14")
+	request.Header.Set(headerAPIOrginatingIdentity, "cloudfoundry")
+	response := httptest.NewRecorder()
+
+	NewRouter(staticDir).ServeHTTP(response, request)
+
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Contains(t, response.Body.String(), headerAPIOrginatingIdentity)
+}
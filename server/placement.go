@@ -0,0 +1,37 @@
+package server
+
+import (
+	"context"
+
+	"github.com/sklevenz/cf-api-broker/config"
+	"github.com/sklevenz/cf-api-broker/placement"
+)
+
+// placeInstance selects the foundation for a new instance among the
+// foundations with all labels. Foundations that are cordoned, degraded or
+// unavailable and the excluded foundation are skipped.
+func placeInstance(ctx context.Context, labels []string, exclude string) (string, error) {
+	instances, err := instanceStore.ListInstances(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	counts := map[string]int{}
+	for _, instance := range instances {
+		counts[instance.Foundation]++
+	}
+
+	candidates := []placement.Candidate{}
+	for name, cf := range config.Get().CloudFoundries {
+		if name == exclude || isCordoned(name) || !foundationMonitor.Status(name).Placeable() {
+			continue
+		}
+		candidates = append(candidates, placement.Candidate{Name: name, Labels: cf.Labels, Instances: counts[name]})
+	}
+
+	selected, err := placement.Select(candidates, labels)
+	if err != nil {
+		return "", err
+	}
+	return selected.Name, nil
+}
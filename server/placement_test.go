@@ -0,0 +1,67 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/sklevenz/cf-api-broker/foundation"
+	"github.com/sklevenz/cf-api-broker/placement"
+	"github.com/sklevenz/cf-api-broker/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func useMonitor(monitor *foundation.Monitor) func() {
+	saved := foundationMonitor
+	foundationMonitor = monitor
+	return func() {
+		foundationMonitor = saved
+	}
+}
+
+func TestPlaceInstance(t *testing.T) {
+	defer useMemoryStore()()
+	defer useMonitor(foundation.NewMonitor(2, 0.9, 0.5))()
+	defer useConfig(t, `
+cloudfoundries:
+  cf-a: {}
+  cf-b: {}
+  cf-c: {}
+`)()
+
+	ctx := context.Background()
+	instanceStore.PutInstance(ctx, &store.Instance{ID: "1", Foundation: "cf-a"})
+
+	name, err := placeInstance(ctx, nil, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "cf-b", name)
+
+	foundationMonitor.Observe("cf-b", false)
+	foundationMonitor.Observe("cf-c", true)
+	foundationMonitor.Observe("cf-c", false)
+
+	name, err = placeInstance(ctx, nil, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "cf-a", name, "degraded and unavailable foundations are excluded")
+
+	foundationMonitor.Observe("cf-a", false)
+	_, err = placeInstance(ctx, nil, "")
+	assert.Equal(t, placement.ErrNoFoundation, err)
+}
+
+func TestProvisionWithoutFoundation(t *testing.T) {
+	defer useMemoryStore()()
+	defer useConfig(t, `
+server:
+  authtype: basic
+  basicauth:
+    username: username
+    password: password
+`)()
+
+	response := provision(NewRouter(staticDir), "no-foundation")
+
+	assert.Equal(t, http.StatusServiceUnavailable, response.Code)
+	_, err := instanceStore.GetInstance(context.Background(), "no-foundation")
+	assert.Equal(t, store.ErrNotFound, err)
+}
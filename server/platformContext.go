@@ -0,0 +1,100 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/sklevenz/cf-api-broker/openapi"
+)
+
+// cloudFoundryContext is the context of instances provisioned by Cloud
+// Foundry
+type cloudFoundryContext struct {
+	OrganizationGUID string `json:"organization_guid"`
+	OrganizationName string `json:"organization_name"`
+	SpaceGUID        string `json:"space_guid"`
+	SpaceName        string `json:"space_name"`
+	InstanceName     string `json:"instance_name"`
+}
+
+// kubernetesContext is the context of instances provisioned by Kubernetes
+type kubernetesContext struct {
+	Namespace    string `json:"namespace"`
+	ClusterID    string `json:"clusterid"`
+	InstanceName string `json:"instance_name"`
+}
+
+// platformContext is the parsed context of a provision request. Depending on
+// the platform CloudFoundry or Kubernetes is set.
+type platformContext struct {
+	Platform     string
+	CloudFoundry *cloudFoundryContext
+	Kubernetes   *kubernetesContext
+}
+
+// parseProvisionContext parses the context of a provision request. Requests
+// without platform are Cloud Foundry requests if they name an org, the
+// deprecated organization_guid and space_guid fields of the request are
+// used if the context has none. Other platforms are kept by name like
+// requests without platform, without typed context.
+func parseProvisionContext(provisionData *openapi.ServiceInstanceProvisionRequest) (*platformContext, error) {
+	platform, _ := provisionData.Context["platform"].(string)
+	if platform == "" && provisionData.OrganizationGuid != "" {
+		platform = platformCloudFoundry
+	}
+
+	result := &platformContext{Platform: platform}
+	encoded, err := json.Marshal(provisionData.Context)
+	if err != nil {
+		return nil, err
+	}
+
+	switch platform {
+	case "":
+	case platformCloudFoundry:
+		result.CloudFoundry = &cloudFoundryContext{}
+		if err := json.Unmarshal(encoded, result.CloudFoundry); err != nil {
+			return nil, fmt.Errorf("invalid cloudfoundry context: %v", err)
+		}
+		cf := result.CloudFoundry
+		if err := mergeGUID(&cf.OrganizationGUID, provisionData.OrganizationGuid, "organization_guid"); err != nil {
+			return nil, err
+		}
+		if err := mergeGUID(&cf.SpaceGUID, provisionData.SpaceGuid, "space_guid"); err != nil {
+			return nil, err
+		}
+	case platformKubernetes:
+		result.Kubernetes = &kubernetesContext{}
+		if err := json.Unmarshal(encoded, result.Kubernetes); err != nil {
+			return nil, fmt.Errorf("invalid kubernetes context: %v", err)
+		}
+		if result.Kubernetes.Namespace == "" {
+			return nil, errors.New("kubernetes context requires namespace")
+		}
+	}
+
+	return result, nil
+}
+
+// mergeGUID fills contextGUID with the GUID of the request and fails if both
+// are set and differ
+func mergeGUID(contextGUID *string, requestGUID string, name string) error {
+	if requestGUID == "" {
+		return nil
+	}
+	if *contextGUID != "" && *contextGUID != requestGUID {
+		return fmt.Errorf("%v of context and request differ", name)
+	}
+	*contextGUID = requestGUID
+	return nil
+}
+
+// requireCloudFoundry refuses features that need a Cloud Foundry org and
+// space for instances of other platforms
+func requireCloudFoundry(platform string, feature string) error {
+	if platform == platformKubernetes {
+		return fmt.Errorf("%v requires a Cloud Foundry platform, the instance was provisioned by %v", feature, platform)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/sklevenz/cf-api-broker/openapi"
+	"github.com/sklevenz/cf-api-broker/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCloudFoundryContext(t *testing.T) {
+	platform, err := parseProvisionContext(&openapi.ServiceInstanceProvisionRequest{
+		Context: map[string]interface{}{
+			"platform":          "cloudfoundry",
+			"organization_guid": "org",
+			"organization_name": "team",
+			"space_guid":        "space",
+			"instance_name":     "api",
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, platformCloudFoundry, platform.Platform)
+	assert.Equal(t, &cloudFoundryContext{OrganizationGUID: "org", OrganizationName: "team", SpaceGUID: "space", InstanceName: "api"}, platform.CloudFoundry)
+	assert.Nil(t, platform.Kubernetes)
+
+	platform, err = parseProvisionContext(&openapi.ServiceInstanceProvisionRequest{OrganizationGuid: "org", SpaceGuid: "space"})
+	assert.NoError(t, err)
+	assert.Equal(t, platformCloudFoundry, platform.Platform, "requests with an org come from Cloud Foundry")
+	assert.Equal(t, "space", platform.CloudFoundry.SpaceGUID)
+
+	_, err = parseProvisionContext(&openapi.ServiceInstanceProvisionRequest{
+		OrganizationGuid: "org",
+		Context:          map[string]interface{}{"platform": "cloudfoundry", "organization_guid": "other"},
+	})
+	assert.EqualError(t, err, "organization_guid of context and request differ")
+
+	_, err = parseProvisionContext(&openapi.ServiceInstanceProvisionRequest{
+		Context: map[string]interface{}{"platform": "cloudfoundry", "space_guid": 42},
+	})
+	assert.Error(t, err)
+}
+
+func TestParseKubernetesContext(t *testing.T) {
+	platform, err := parseProvisionContext(&openapi.ServiceInstanceProvisionRequest{
+		Context: map[string]interface{}{"platform": "kubernetes", "namespace": "apps", "clusterid": "cluster-1"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, platformKubernetes, platform.Platform)
+	assert.Equal(t, &kubernetesContext{Namespace: "apps", ClusterID: "cluster-1"}, platform.Kubernetes)
+	assert.Nil(t, platform.CloudFoundry)
+
+	_, err = parseProvisionContext(&openapi.ServiceInstanceProvisionRequest{
+		Context: map[string]interface{}{"platform": "kubernetes", "clusterid": "cluster-1"},
+	})
+	assert.EqualError(t, err, "kubernetes context requires namespace")
+
+	platform, err = parseProvisionContext(&openapi.ServiceInstanceProvisionRequest{
+		Context: map[string]interface{}{"platform": "nomad", "organization_guid": "org"},
+	})
+	assert.NoError(t, err, "unknown platforms are not rejected")
+	assert.Equal(t, &platformContext{Platform: "nomad"}, platform)
+
+	platform, err = parseProvisionContext(&openapi.ServiceInstanceProvisionRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, "", platform.Platform)
+}
+
+const kubernetesProvisionBody = `{"service_id": "cf", "plan_id": "cloudcontroller", "context": {"platform": "kubernetes", "namespace": "apps", "clusterid": "cluster-1"}}`
+
+func TestProvisionFromKubernetes(t *testing.T) {
+	_, cleanup := useFakeFoundation(t)
+	defer cleanup()
+
+	assert.Equal(t, http.StatusOK, provisionWith(NewRouter(staticDir), "k1", kubernetesProvisionBody).Code)
+
+	instance, err := instanceStore.GetInstance(context.Background(), "k1")
+	assert.NoError(t, err)
+	assert.Equal(t, platformKubernetes, instance.Platform)
+	assert.Equal(t, "cf-a", instance.Foundation)
+	assert.Equal(t, "apps", instance.Context["namespace"])
+	assert.Empty(t, instance.OrganizationGUID)
+
+	response := provisionWith(NewRouter(staticDir), "k2", `{"service_id": "cf", "plan_id": "cloudcontroller", "context": {"platform": "kubernetes"}}`)
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Contains(t, response.Body.String(), "requires namespace")
+}
+
+func TestProvisionFromUnknownPlatform(t *testing.T) {
+	_, cleanup := useFakeFoundation(t)
+	defer cleanup()
+
+	response := provisionWith(NewRouter(staticDir), "n1", `{"service_id": "cf", "plan_id": "cloudcontroller", "context": {"platform": "nomad", "organization_guid": "org"}}`)
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	instance, err := instanceStore.GetInstance(context.Background(), "n1")
+	assert.NoError(t, err)
+	assert.Equal(t, "nomad", instance.Platform)
+	assert.Empty(t, instance.OrganizationGUID, "no typed context")
+
+	response = sendBinding(http.MethodPut, "n1", "b1", `{}`)
+	assert.Equal(t, http.StatusCreated, response.Code)
+	assert.NotContains(t, bindingCredentialsOf(t, response), "role")
+}
+
+func TestBindFromKubernetes(t *testing.T) {
+	fake, cleanup := useFakeFoundation(t)
+	defer cleanup()
+	defer useFakeFoundationConfig(t, fake, `
+plans:
+  cloudcontroller:
+    roles: [space_developer]
+    defaultRole: space_developer
+    defaultScopes: [cloud_controller.read]
+`)()
+	provisionWith(NewRouter(staticDir), "k1", kubernetesProvisionBody)
+
+	response := sendBinding(http.MethodPut, "k1", "b1", `{}`)
+	assert.Equal(t, http.StatusCreated, response.Code)
+	credentials := bindingCredentialsOf(t, response)
+	assert.NotContains(t, credentials, "role", "no default role for kubernetes")
+	assert.NotContains(t, credentials, "space_guid")
+	assert.Equal(t, []interface{}{"cloud_controller.read"}, credentials["scopes"])
+	assert.NotNil(t, fake.Client("cf-api-broker-b1"))
+	assert.Nil(t, fake.Roles("cf-api-broker-b1"))
+
+	response = sendBinding(http.MethodPut, "k1", "b2", `{"parameters": {"role": "space_developer"}}`)
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Contains(t, response.Body.String(), "role space_developer requires a Cloud Foundry platform")
+}
+
+func TestAdminInstancesByPlatform(t *testing.T) {
+	defer useMemoryStore()()
+	ctx := context.Background()
+	instanceStore.PutInstance(ctx, &store.Instance{ID: "c1", Platform: platformCloudFoundry})
+	instanceStore.PutInstance(ctx, &store.Instance{ID: "k1", Platform: platformKubernetes})
+
+	page := struct {
+		Resources []store.Instance `json:"resources"`
+	}{}
+	assert.Equal(t, http.StatusOK, getAdmin(t, "/admin/v1/instances/?platform=kubernetes", &page))
+	assert.Len(t, page.Resources, 1)
+	assert.Equal(t, "k1", page.Resources[0].ID)
+}
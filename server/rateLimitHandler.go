@@ -0,0 +1,124 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sklevenz/cf-api-broker/config"
+	"github.com/sklevenz/cf-api-broker/ratelimit"
+)
+
+const (
+	headerRetryAfter   string = "Retry-After"
+	headerForwardedFor string = "X-Forwarded-For"
+	anonymousIdentity  string = "anonymous"
+	unknownClientIP    string = "unknown"
+)
+
+// routeGroupLimiter limits requests of one route group per client IP and per
+// authenticated identity
+type routeGroupLimiter struct {
+	ip       *ratelimit.Limiter
+	identity *ratelimit.Limiter
+}
+
+func newRouteGroupLimiter(cfg config.RateLimit) *routeGroupLimiter {
+	return &routeGroupLimiter{
+		ip:       ratelimit.NewLimiter(cfg.IP.Rate, cfg.IP.Burst),
+		identity: ratelimit.NewLimiter(cfg.Identity.Rate, cfg.Identity.Burst),
+	}
+}
+
+// newAuthLockout creates the lockout for clients failing authentication
+func newAuthLockout() *ratelimit.Lockout {
+	cfg := config.Get().Server.RateLimits.AuthFailures
+	return ratelimit.NewLockout(cfg.Threshold, cfg.Lockout, cfg.MaxLockout)
+}
+
+// protect chains rate limiting by client IP, lockout of clients failing
+// authentication, authentication and rate limiting by identity. A nil auth
+// handler means the routes are public.
+func (l *routeGroupLimiter) protect(next http.Handler, auth mux.MiddlewareFunc, lockout *ratelimit.Lockout) http.Handler {
+	limited := l.limitIdentity(next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := clientIP(r)
+
+		if ok, wait := l.ip.Allow(ip); !ok {
+			tooManyRequests(w, wait, fmt.Errorf("rate limit exceeded for client %v", ip))
+			return
+		}
+
+		if auth == nil {
+			limited.ServeHTTP(w, r)
+			return
+		}
+
+		if locked, wait := lockout.Locked(ip); locked {
+			tooManyRequests(w, wait, fmt.Errorf("too many failed authentication attempts from client %v", ip))
+			return
+		}
+
+		authenticated := false
+		auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authenticated = true
+			limited.ServeHTTP(w, r)
+		})).ServeHTTP(w, r)
+
+		if authenticated {
+			lockout.Success(ip)
+		} else {
+			requestLogger(r).Warnf("Authentication failed for client %v", ip)
+			lockout.Failure(ip)
+		}
+	})
+}
+
+func (l *routeGroupLimiter) limitIdentity(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity := principal(r)
+		if identity == "" {
+			identity = anonymousIdentity
+		}
+
+		if ok, wait := l.identity.Allow(identity); !ok {
+			tooManyRequests(w, wait, fmt.Errorf("rate limit exceeded for %v", identity))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientIP returns the IP address of the client. Behind a trusted proxy
+// like the Cloud Foundry router the address appended last to
+// X-Forwarded-For is used, earlier entries can be forged by the client.
+func clientIP(r *http.Request) string {
+	if config.Get().Server.RateLimits.TrustForwardedFor {
+		if forwarded := r.Header.Values(headerForwardedFor); len(forwarded) > 0 {
+			addresses := strings.Split(forwarded[len(forwarded)-1], ",")
+			if ip := strings.TrimSpace(addresses[len(addresses)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if host == "" {
+		return unknownClientIP
+	}
+	return host
+}
+
+func tooManyRequests(w http.ResponseWriter, wait time.Duration, err error) {
+	w.Header().Set(headerRetryAfter, fmt.Sprintf("%v", int(math.Ceil(wait.Seconds()))))
+	handleHTTPError(w, http.StatusTooManyRequests, err)
+}
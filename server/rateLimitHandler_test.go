@@ -0,0 +1,106 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const rateLimitConfig = `
+server:
+  authtype: basic
+  basicauth:
+    username: username
+    password: password
+  admin:
+    authtype: basic
+    basicauth:
+      username: admin
+      password: admin
+  rateLimits:
+    trustForwardedFor: true
+    public:
+      ip:
+        rate: 1
+        burst: 2
+    platform:
+      identity:
+        rate: 1
+        burst: 3
+    authFailures:
+      threshold: 2
+      lockout: 10s
+      maxLockout: 1m
+`
+
+func serve(router http.Handler, path string, ip string, user string, password string) *httptest.ResponseRecorder {
+	request, _ := http.NewRequest(http.MethodGet, path, nil)
+	request.Header.Set(headerForwardedFor, "10.0.0.1, "+ip)
+	if user != "" {
+		request.SetBasicAuth(user, password)
+	}
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	return response
+}
+
+func TestRateLimitByIP(t *testing.T) {
+	defer useConfig(t, rateLimitConfig)()
+	router := NewRouter(staticDir)
+
+	assert.Equal(t, http.StatusOK, serve(router, "/health/", "1.1.1.1", "", "").Code)
+	assert.Equal(t, http.StatusOK, serve(router, "/health/", "1.1.1.1", "", "").Code)
+
+	response := serve(router, "/health/", "1.1.1.1", "", "")
+	assert.Equal(t, http.StatusTooManyRequests, response.Code)
+	assert.Equal(t, "1", response.Header().Get(headerRetryAfter))
+
+	assert.Equal(t, http.StatusOK, serve(router, "/health/", "2.2.2.2", "", "").Code)
+}
+
+func TestRateLimitByIdentity(t *testing.T) {
+	defer useConfig(t, rateLimitConfig)()
+	router := NewRouter(staticDir)
+
+	assert.Equal(t, http.StatusOK, serve(router, "/", "1.1.1.1", "username", "password").Code)
+	assert.Equal(t, http.StatusOK, serve(router, "/", "2.2.2.2", "username", "password").Code)
+	assert.Equal(t, http.StatusOK, serve(router, "/", "3.3.3.3", "username", "password").Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve(router, "/", "4.4.4.4", "username", "password").Code)
+
+	assert.Equal(t, http.StatusOK, serve(router, "/version/", "4.4.4.4", "admin", "admin").Code)
+}
+
+func TestAuthFailureLockout(t *testing.T) {
+	defer useConfig(t, rateLimitConfig)()
+	router := NewRouter(staticDir)
+
+	assert.Equal(t, http.StatusUnauthorized, serve(router, "/", "1.1.1.1", "username", "wrong").Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(router, "/", "1.1.1.1", "username", "wrong").Code)
+
+	response := serve(router, "/", "1.1.1.1", "username", "password")
+	assert.Equal(t, http.StatusTooManyRequests, response.Code)
+	assert.Equal(t, "10", response.Header().Get(headerRetryAfter))
+
+	assert.Equal(t, http.StatusOK, serve(router, "/", "2.2.2.2", "username", "password").Code)
+	assert.Equal(t, http.StatusOK, serve(router, "/health/", "1.1.1.1", "", "").Code)
+}
+
+func TestClientIP(t *testing.T) {
+	defer useConfig(t, `
+server:
+  rateLimits:
+    trustForwardedFor: false
+`)()
+	request, _ := http.NewRequest(http.MethodGet, "/", nil)
+	request.RemoteAddr = "192.168.0.1:1234"
+	assert.Equal(t, "192.168.0.1", clientIP(request))
+
+	request.Header.Add(headerForwardedFor, "6.6.6.6, 10.0.0.1")
+	request.Header.Add(headerForwardedFor, "10.0.0.2")
+	assert.Equal(t, "192.168.0.1", clientIP(request), "X-Forwarded-For is ignored without a trusted proxy")
+
+	defer useConfig(t, rateLimitConfig)()
+	assert.Equal(t, "10.0.0.2", clientIP(request))
+}
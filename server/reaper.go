@@ -0,0 +1,101 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/sklevenz/cf-api-broker/config"
+	"github.com/sklevenz/cf-api-broker/store"
+)
+
+const defaultReaperInterval time.Duration = time.Minute
+
+// StartBindingReaper periodically revokes the credentials of expired
+// bindings. The returned function stops the reaper.
+func StartBindingReaper() func(ctx context.Context) error {
+	interval := durationOrDefault(config.Get().Reaper.Interval, defaultReaperInterval)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			if _, err := reapBindings(ctx, time.Now()); err != nil {
+				log.Errorf("Error reaping expired bindings: %v", err)
+			}
+			cancel()
+		}
+	}()
+
+	return func(ctx context.Context) error {
+		close(stop)
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// reapBindings revokes the credentials of bindings expired at now and marks
+// the bindings expired. Bindings stay in the store until they are unbound.
+// Bindings of instances with an operation in progress are skipped.
+func reapBindings(ctx context.Context, now time.Time) (int, error) {
+	bindings, err := instanceStore.ListBindings(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	reaped := 0
+	for _, binding := range bindings {
+		if binding.State == store.StateExpired || !binding.Expired(now) {
+			continue
+		}
+		logger := log.WithFields(log.Fields{"instance_id": binding.InstanceID, "binding_id": binding.ID})
+
+		instance, err := instanceStore.GetInstance(ctx, binding.InstanceID)
+		if err != nil {
+			logger.Warnf("Expired binding not revoked: %v", err)
+			continue
+		}
+		if instance.State == store.StateInProgress {
+			continue
+		}
+
+		client, err := foundationClient(instance.Foundation)
+		if err == nil {
+			err = revokeCredentials(ctx, client, binding)
+		}
+		if err == nil {
+			err = revokeSourceCredentials(ctx, binding)
+		}
+		if err == nil {
+			err = revokeRetiredCredentials(ctx, binding)
+		}
+		if err != nil {
+			logger.Errorf("Error revoking credentials of expired binding: %v", err)
+			continue
+		}
+
+		binding.State = store.StateExpired
+		binding.UpdatedAt = now.UTC()
+		if err := instanceStore.PutBinding(ctx, binding); err != nil {
+			return reaped, err
+		}
+		logger.WithField("foundation", instance.Foundation).Info("Revoked credentials of expired binding")
+		reaped++
+	}
+	return reaped, nil
+}
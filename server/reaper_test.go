@@ -0,0 +1,103 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/sklevenz/cf-api-broker/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBindingExpiry(t *testing.T) {
+	defer useConfig(t, `
+plans:
+  ttl:
+    credentialTTL: 10h
+    renewBefore: 1h
+  default-renewal:
+    credentialTTL: 10h
+`)()
+	now := time.Now()
+
+	expiresAt, renewBefore := bindingExpiry("ttl", now)
+	assert.Equal(t, now.Add(10*time.Hour), expiresAt)
+	assert.Equal(t, now.Add(9*time.Hour), renewBefore)
+
+	_, renewBefore = bindingExpiry("default-renewal", now)
+	assert.Equal(t, now.Add(8*time.Hour), renewBefore)
+
+	expiresAt, renewBefore = bindingExpiry("unknown", now)
+	assert.True(t, expiresAt.IsZero())
+	assert.True(t, renewBefore.IsZero())
+}
+
+func TestReapBindings(t *testing.T) {
+	fake, cleanup := useBindingFoundation(t)
+	defer cleanup()
+
+	sendBinding(http.MethodPut, "i1", "b1", `{}`)
+	sendBinding(http.MethodPut, "i1", "b2", `{}`)
+	ctx := context.Background()
+	fresh, _ := instanceStore.GetBinding(ctx, "b2")
+	fresh.ExpiresAt = time.Now().Add(3 * time.Hour)
+	instanceStore.PutBinding(ctx, fresh)
+
+	reaped, err := reapBindings(ctx, time.Now().Add(2*time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, reaped)
+	assert.Nil(t, fake.Client("cf-api-broker-b1"))
+	assert.NotNil(t, fake.Client("cf-api-broker-b2"))
+
+	expired, _ := instanceStore.GetBinding(ctx, "b1")
+	assert.Equal(t, store.StateExpired, expired.State)
+
+	reaped, _ = reapBindings(ctx, time.Now().Add(2*time.Hour))
+	assert.Equal(t, 0, reaped, "expired bindings are reaped once")
+
+	response := sendBinding(http.MethodPut, "i1", "b1", `{}`)
+	assert.Equal(t, http.StatusConflict, response.Code, "no revoked credentials for repeated requests")
+	assert.Contains(t, response.Body.String(), "expired")
+
+	assert.Equal(t, http.StatusOK, sendBinding(http.MethodDelete, "i1", "b1", "").Code, "expired bindings can be unbound")
+}
+
+func TestReapBindingsSkipsOperationInProgress(t *testing.T) {
+	fake, cleanup := useBindingFoundation(t)
+	defer cleanup()
+
+	sendBinding(http.MethodPut, "i1", "b1", `{}`)
+	ctx := context.Background()
+	instance, _ := instanceStore.GetInstance(ctx, "i1")
+	instance.State = store.StateInProgress
+	instanceStore.PutInstance(ctx, instance)
+
+	reaped, err := reapBindings(ctx, time.Now().Add(2*time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, reaped)
+	assert.NotNil(t, fake.Client("cf-api-broker-b1"))
+}
+
+func TestAdminExpiredBindings(t *testing.T) {
+	_, cleanup := useBindingFoundation(t)
+	defer cleanup()
+
+	sendBinding(http.MethodPut, "i1", "b1", `{}`)
+	sendBinding(http.MethodPut, "i1", "b2", `{}`)
+	ctx := context.Background()
+	binding, _ := instanceStore.GetBinding(ctx, "b1")
+	binding.ExpiresAt = time.Now().Add(-time.Minute)
+	instanceStore.PutBinding(ctx, binding)
+
+	page := struct {
+		Resources []adminBinding `json:"resources"`
+	}{}
+	assert.Equal(t, http.StatusOK, getAdmin(t, "/admin/v1/bindings/?expired=true", &page))
+	assert.Len(t, page.Resources, 1)
+	assert.Equal(t, "b1", page.Resources[0].ID)
+
+	reapBindings(ctx, time.Now())
+	assert.Equal(t, http.StatusOK, getAdmin(t, "/admin/v1/bindings/?state=expired", &page))
+	assert.Len(t, page.Resources, 1)
+}
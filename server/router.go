@@ -1,11 +1,10 @@
 package server
 
 import (
-	"log"
 	"net/http"
-	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/sklevenz/cf-api-broker/metrics"
 )
 
 const (
@@ -26,31 +25,46 @@ func NewRouter(staticDir string) http.Handler {
 
 	v2Router := router.PathPrefix("/v2/").Subrouter()
 	v2Router.Use(apiVersionHandler)
-	v2Router.Use(requestIdentityLogHandler)
-	v2Router.Use(originatingIdentityLogHandler)
+	v2Router.Use(originatingIdentityHandler)
 	v2Router.Use(etagHandler)
+	v2Router.Use(auditHandler)
 	v2Router.HandleFunc("/catalog/", catalogHandler).Name("v2.catalog").Methods(http.MethodGet)
 	v2Router.HandleFunc("/service_instances/{instance_id}/", createServiceHandler).Name("v2.service_instances").Methods(http.MethodPut)
+	v2Router.HandleFunc("/service_instances/{instance_id}/", updateServiceHandler).Name("v2.service_instances").Methods(http.MethodPatch)
+	v2Router.HandleFunc("/service_instances/{instance_id}/", getServiceHandler).Name("v2.service_instances").Methods(http.MethodGet)
+	v2Router.HandleFunc("/service_instances/{instance_id}/last_operation/", lastOperationHandler).Name("v2.service_instances.last_operation").Methods(http.MethodGet)
+	v2Router.HandleFunc("/service_instances/{instance_id}/service_bindings/{binding_id}/", bindHandler).Name("v2.service_bindings").Methods(http.MethodPut)
+	v2Router.HandleFunc("/service_instances/{instance_id}/service_bindings/{binding_id}/", unbindHandler).Name("v2.service_bindings").Methods(http.MethodDelete)
+
+	adminRouter := router.PathPrefix("/admin/v1/").Subrouter()
+	adminRouter.Use(auditHandler)
+	adminRouter.HandleFunc("/audit/", auditQueryHandler).Name("admin.audit").Methods(http.MethodGet)
+	adminRouter.HandleFunc("/instances/", instancesHandler).Name("admin.instances").Methods(http.MethodGet)
+	adminRouter.HandleFunc("/instances/{instance_id}/", instanceHandler).Name("admin.instance").Methods(http.MethodGet)
+	adminRouter.HandleFunc("/instances/{instance_id}/operations/", instanceOperationsHandler).Name("admin.instance.operations").Methods(http.MethodGet)
+	adminRouter.HandleFunc("/instances/{instance_id}/migrations/", migrateInstanceHandler).Name("admin.instance.migrations").Methods(http.MethodPost)
+	adminRouter.HandleFunc("/bindings/", bindingsHandler).Name("admin.bindings").Methods(http.MethodGet)
+	adminRouter.HandleFunc("/foundations/", foundationsHandler).Name("admin.foundations").Methods(http.MethodGet)
+	adminRouter.HandleFunc("/foundations/{foundation}/", foundationHandler).Name("admin.foundation").Methods(http.MethodGet)
+	adminRouter.HandleFunc("/foundations/{foundation}/cordon/", cordonHandler).Name("admin.foundation.cordon").Methods(http.MethodPut, http.MethodDelete)
+	adminRouter.HandleFunc("/foundations/{foundation}/drain/", drainHandler).Name("admin.foundation.drain").Methods(http.MethodGet)
 
 	router.HandleFunc("/version/", versionHandler).Name("version").Methods(http.MethodGet)
 	router.HandleFunc("/health/", healthHandler).Name("health").Methods(http.MethodGet)
+	router.HandleFunc("/health/live", healthHandler).Name("health.live").Methods(http.MethodGet)
+	router.HandleFunc("/health/ready", readyHandler).Name("health.ready").Methods(http.MethodGet)
+	router.HandleFunc("/dashboard/{instance_id}/", dashboardHandler).Name("dashboard").Methods(http.MethodGet)
+	router.Handle("/metrics", metrics.Handler()).Name("metrics").Methods(http.MethodGet)
 	router.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir(staticDir)))).Name("static").Methods(http.MethodGet)
 	router.PathPrefix("/").Handler(http.FileServer(http.Dir(staticDir))).Name("home").Methods(http.MethodGet)
 
-	router.Use(authHandler)
+	router.Use(tracingHandler)
 
 	router.Use(logHandler)
 
-	return router
-}
+	router.Use(metricsHandler)
 
-func logHandler(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		log.Println("--- new request ------------------------------------")
-		log.Printf("raw request object: %v", r)
+	router.Use(routePolicyHandler())
 
-		start := time.Now()
-		next.ServeHTTP(w, r)
-		log.Printf("execution time: %v", time.Since(start))
-	})
+	return router
 }
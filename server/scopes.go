@@ -0,0 +1,196 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sklevenz/cf-api-broker/config"
+	"github.com/sklevenz/cf-api-broker/store"
+)
+
+// roleScopes maps the Cloud Foundry roles a binding can request to the UAA
+// scopes its client needs to act in that role
+var roleScopes = map[string][]string{
+	"space_auditor":   {"cloud_controller.read"},
+	"space_developer": {"cloud_controller.read", "cloud_controller.write"},
+	"space_manager":   {"cloud_controller.read", "cloud_controller.write"},
+	"org_auditor":     {"cloud_controller.read"},
+	"org_manager":     {"cloud_controller.read", "cloud_controller.write"},
+}
+
+// roleTarget fails if instance has no org, or for space roles no space, to
+// grant role in
+func roleTarget(instance *store.Instance, role string) error {
+	if instance.OrganizationGUID == "" {
+		return fmt.Errorf("role %v requires an instance in an organization", role)
+	}
+	if strings.HasPrefix(role, "space_") && instance.SpaceGUID == "" {
+		return fmt.Errorf("role %v requires an instance in a space", role)
+	}
+	return nil
+}
+
+// bindingParameters are the binding parameters understood by the broker
+type bindingParameters struct {
+	Role   string   `json:"role"`
+	Scopes []string `json:"scopes"`
+}
+
+// grant is the role and scopes given to the credentials of a binding
+type grant struct {
+	Role   string
+	Scopes []string
+}
+
+// grantBinding checks the role and scopes requested with the parameters of
+// a binding against the allow-lists of the plan of instance. Without a
+// request the default role or scopes of the plan are granted. Explicit scopes
+// are granted in addition to the scopes of the role. Roles are Cloud Foundry
+// roles granted in the org or space of the instance, instances without them
+// get no default role and requesting a role fails.
+func grantBinding(instance *store.Instance, parameters map[string]interface{}) (grant, error) {
+	requested, err := parseBindingParameters(parameters)
+	if err != nil {
+		return grant{}, err
+	}
+	planID := instance.PlanID
+	plan := config.Get().Plans[planID]
+
+	result := grant{}
+	if plan.DefaultRole != "" && roleTarget(instance, plan.DefaultRole) == nil {
+		result.Role = plan.DefaultRole
+	}
+	if requested.Role != "" {
+		if err := requireCloudFoundry(instance.Platform, "role "+requested.Role); err != nil {
+			return grant{}, err
+		}
+		if !contains(plan.Roles, requested.Role) {
+			return grant{}, fmt.Errorf("role %v is not allowed for plan %v", requested.Role, planID)
+		}
+		if err := roleTarget(instance, requested.Role); err != nil {
+			return grant{}, err
+		}
+		result.Role = requested.Role
+	}
+	for _, scope := range requested.Scopes {
+		if !contains(plan.Scopes, scope) {
+			return grant{}, fmt.Errorf("scope %v is not allowed for plan %v", scope, planID)
+		}
+	}
+
+	result.Scopes, err = planScopes(plan, result.Role, requested.Scopes)
+	if err != nil {
+		return grant{}, err
+	}
+	return result, nil
+}
+
+// regrantBinding derives the scopes of an existing binding from the current
+// configuration of the plan of instance. The binding keeps its role as long
+// as the instance has the org or space to grant it in, the scopes it
+// requested are kept as long as the plan still allows them.
+func regrantBinding(instance *store.Instance, binding *store.Binding) (grant, error) {
+	requested, err := parseBindingParameters(binding.Parameters)
+	if err != nil {
+		return grant{}, err
+	}
+	plan := config.Get().Plans[instance.PlanID]
+
+	allowed := []string{}
+	for _, scope := range requested.Scopes {
+		if contains(plan.Scopes, scope) {
+			allowed = append(allowed, scope)
+		}
+	}
+	role := binding.Role
+	if role != "" && roleTarget(instance, role) != nil {
+		role = ""
+	}
+	scopes, err := planScopes(plan, role, allowed)
+	if err != nil {
+		return grant{}, err
+	}
+	return grant{Role: role, Scopes: scopes}, nil
+}
+
+// planScopes adds the scopes implied by role to scopes and falls back to the
+// default scopes of plan if there are none
+func planScopes(plan config.Plan, role string, scopes []string) ([]string, error) {
+	scopes = append([]string{}, scopes...)
+	if role != "" {
+		implied, ok := roleScopes[role]
+		if !ok {
+			return nil, fmt.Errorf("unknown role %v", role)
+		}
+		scopes = append(scopes, implied...)
+	}
+	if len(scopes) == 0 {
+		scopes = plan.DefaultScopes
+	}
+	if len(scopes) == 0 {
+		scopes = defaultBindingScopes
+	}
+	return uniqueSorted(scopes), nil
+}
+
+// parseBindingParameters decodes the role and scopes of binding parameters
+func parseBindingParameters(parameters map[string]interface{}) (bindingParameters, error) {
+	result := bindingParameters{}
+	if len(parameters) == 0 {
+		return result, nil
+	}
+
+	data, err := json.Marshal(parameters)
+	if err != nil {
+		return result, err
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return result, fmt.Errorf("invalid binding parameters: %v", err)
+	}
+	return result, nil
+}
+
+// bindingSchema describes the binding parameters accepted for a plan
+func bindingSchema(planID string) map[string]interface{} {
+	plan := config.Get().Plans[planID]
+	properties := map[string]interface{}{}
+	if len(plan.Roles) > 0 {
+		properties["role"] = map[string]interface{}{"type": "string", "enum": plan.Roles}
+	}
+	if len(plan.Scopes) > 0 {
+		properties["scopes"] = map[string]interface{}{
+			"type":  "array",
+			"items": map[string]interface{}{"type": "string", "enum": plan.Scopes},
+		}
+	}
+
+	return map[string]interface{}{
+		"$schema":    "http://json-schema.org/draft-04/schema#",
+		"type":       "object",
+		"properties": properties,
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func uniqueSorted(values []string) []string {
+	seen := map[string]bool{}
+	result := []string{}
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
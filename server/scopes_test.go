@@ -0,0 +1,111 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/sklevenz/cf-api-broker/store"
+	"github.com/stretchr/testify/assert"
+)
+
+const scopedPlans = `
+plans:
+  scoped:
+    roles: [space_auditor, space_developer, unknown_role]
+    scopes: [cloud_controller.read, routing.routes.read]
+    defaultRole: space_auditor
+  explicit:
+    scopes: [cloud_controller.read]
+    defaultScopes: [cloud_controller.read]
+`
+
+func TestGrantBinding(t *testing.T) {
+	defer useConfig(t, scopedPlans)()
+
+	granted, err := grantBinding(&store.Instance{PlanID: "scoped", OrganizationGUID: "org", SpaceGUID: "space"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, grant{Role: "space_auditor", Scopes: []string{"cloud_controller.read"}}, granted, "default role")
+
+	granted, err = grantBinding(&store.Instance{PlanID: "scoped", OrganizationGUID: "org", SpaceGUID: "space"}, map[string]interface{}{"role": "space_developer", "scopes": []interface{}{"routing.routes.read"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "space_developer", granted.Role)
+	assert.Equal(t, []string{"cloud_controller.read", "cloud_controller.write", "routing.routes.read"}, granted.Scopes)
+
+	granted, err = grantBinding(&store.Instance{PlanID: "scoped"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, grant{Scopes: []string{"cloud_controller.read", "cloud_controller.write"}}, granted, "no default role without org")
+
+	granted, err = grantBinding(&store.Instance{PlanID: "scoped", OrganizationGUID: "org"}, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, granted.Role, "no default space role without space")
+
+	granted, err = grantBinding(&store.Instance{PlanID: "explicit"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, grant{Scopes: []string{"cloud_controller.read"}}, granted, "default scopes")
+
+	granted, err = grantBinding(&store.Instance{PlanID: "unconfigured"}, map[string]interface{}{"other": "ignored"})
+	assert.NoError(t, err)
+	assert.Equal(t, defaultBindingScopes, granted.Scopes)
+}
+
+func TestGrantBindingRejected(t *testing.T) {
+	defer useConfig(t, scopedPlans)()
+
+	_, err := grantBinding(&store.Instance{PlanID: "scoped", OrganizationGUID: "org", SpaceGUID: "space"}, map[string]interface{}{"role": "org_manager"})
+	assert.EqualError(t, err, "role org_manager is not allowed for plan scoped")
+
+	_, err = grantBinding(&store.Instance{PlanID: "scoped", OrganizationGUID: "org", SpaceGUID: "space"}, map[string]interface{}{"scopes": []interface{}{"cloud_controller.admin"}})
+	assert.EqualError(t, err, "scope cloud_controller.admin is not allowed for plan scoped")
+
+	_, err = grantBinding(&store.Instance{PlanID: "scoped", OrganizationGUID: "org", SpaceGUID: "space"}, map[string]interface{}{"role": "unknown_role"})
+	assert.EqualError(t, err, "unknown role unknown_role")
+
+	_, err = grantBinding(&store.Instance{PlanID: "scoped"}, map[string]interface{}{"role": "space_auditor"})
+	assert.EqualError(t, err, "role space_auditor requires an instance in an organization")
+
+	_, err = grantBinding(&store.Instance{PlanID: "scoped", OrganizationGUID: "org"}, map[string]interface{}{"role": "space_developer"})
+	assert.EqualError(t, err, "role space_developer requires an instance in a space")
+
+	_, err = grantBinding(&store.Instance{PlanID: "explicit"}, map[string]interface{}{"role": "space_auditor"})
+	assert.Error(t, err, "plan allows no roles")
+
+	_, err = grantBinding(&store.Instance{PlanID: "scoped", OrganizationGUID: "org", SpaceGUID: "space"}, map[string]interface{}{"scopes": "cloud_controller.read"})
+	assert.Error(t, err, "scopes must be a list")
+}
+
+func TestBindingSchema(t *testing.T) {
+	defer useConfig(t, scopedPlans)()
+
+	schema := bindingSchema("scoped")
+	properties := schema["properties"].(map[string]interface{})
+	assert.Equal(t, []string{"space_auditor", "space_developer", "unknown_role"}, properties["role"].(map[string]interface{})["enum"])
+	assert.Contains(t, properties, "scopes")
+
+	assert.Empty(t, bindingSchema("unconfigured")["properties"])
+}
+
+func TestBindWithRole(t *testing.T) {
+	fake, cleanup := useBindingFoundation(t)
+	defer cleanup()
+	defer useFakeFoundationConfig(t, fake, `
+plans:
+  cloudcontroller:
+    roles: [space_auditor, space_developer]
+`)()
+
+	response := sendBinding(http.MethodPut, "i1", "b1", `{"parameters": {"role": "space_developer"}}`)
+	assert.Equal(t, http.StatusCreated, response.Code)
+	credentials := bindingCredentialsOf(t, response)
+	assert.Equal(t, "space_developer", credentials["role"])
+	assert.Equal(t, []interface{}{"cloud_controller.read", "cloud_controller.write"}, credentials["scopes"])
+	assert.Equal(t, []interface{}{"cloud_controller.read", "cloud_controller.write"}, fake.Client("cf-api-broker-b1")["authorities"])
+
+	response = sendBinding(http.MethodPut, "i1", "b2", `{"predecessor_binding_id": "b1", "parameters": {"role": "space_auditor"}}`)
+	assert.Equal(t, http.StatusCreated, response.Code)
+	assert.Equal(t, "space_developer", bindingCredentialsOf(t, response)["role"], "rotation keeps the role of the predecessor")
+
+	response = sendBinding(http.MethodPut, "i1", "b3", `{"parameters": {"role": "org_manager"}}`)
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Contains(t, response.Body.String(), "not allowed")
+	assert.Nil(t, fake.Client("cf-api-broker-b3"))
+}
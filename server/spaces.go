@@ -0,0 +1,80 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sklevenz/cf-api-broker/foundation"
+	"github.com/sklevenz/cf-api-broker/store"
+)
+
+// errUnknownSpace is returned if the org or space of an instance does not
+// exist on its foundation
+type errUnknownSpace struct {
+	message string
+}
+
+func (e *errUnknownSpace) Error() string {
+	return e.message
+}
+
+// resolveSpace looks up the org and space of an instance on a foundation and
+// records their names in the instance. The space is optional.
+func resolveSpace(ctx context.Context, foundationName string, instance *store.Instance) error {
+	client, err := foundationClient(foundationName)
+	if err != nil {
+		return err
+	}
+
+	org, err := client.Organization(ctx, instance.OrganizationGUID)
+	if errors.Is(err, foundation.ErrNotFound) {
+		return &errUnknownSpace{fmt.Sprintf("organization %v does not exist on foundation %v", instance.OrganizationGUID, foundationName)}
+	}
+	if err != nil {
+		return err
+	}
+	instance.OrganizationName = org.Name
+
+	if instance.SpaceGUID == "" {
+		return nil
+	}
+	space, err := client.Space(ctx, instance.SpaceGUID)
+	if errors.Is(err, foundation.ErrNotFound) {
+		return &errUnknownSpace{fmt.Sprintf("space %v does not exist on foundation %v", instance.SpaceGUID, foundationName)}
+	}
+	if err != nil {
+		return err
+	}
+	if space.OrganizationGUID != org.GUID {
+		return &errUnknownSpace{fmt.Sprintf("space %v does not belong to organization %v", instance.SpaceGUID, instance.OrganizationGUID)}
+	}
+	instance.SpaceName = space.Name
+
+	return nil
+}
+
+// grantCredentials gives the client of a binding its Cloud Foundry role in
+// the org and space of the instance. Instances without the org or space of
+// the role get no role.
+func grantCredentials(ctx context.Context, client *foundation.Client, instance *store.Instance, binding *store.Binding) error {
+	if binding.Role == "" || roleTarget(instance, binding.Role) != nil {
+		return nil
+	}
+	return client.GrantRole(ctx, binding.ClientID, binding.Role, instance.OrganizationGUID, instance.SpaceGUID)
+}
+
+// revokeCredentials removes the UAA client of a binding and its Cloud
+// Controller user with all roles
+func revokeCredentials(ctx context.Context, client *foundation.Client, binding *store.Binding) error {
+	if binding.ClientID == "" {
+		return nil
+	}
+	if err := client.DeleteUAAClient(ctx, binding.ClientID); err != nil {
+		return err
+	}
+	if binding.Role != "" {
+		return client.DeleteUser(ctx, binding.ClientID)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/sklevenz/cf-api-broker/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProvisionResolvesSpace(t *testing.T) {
+	_, cleanup := useFakeFoundation(t)
+	defer cleanup()
+
+	assert.Equal(t, http.StatusOK, provision(NewRouter(staticDir), "i1").Code)
+
+	instance, err := instanceStore.GetInstance(context.Background(), "i1")
+	assert.NoError(t, err)
+	assert.Equal(t, "org-name", instance.OrganizationName)
+	assert.Equal(t, "space-name", instance.SpaceName)
+}
+
+func TestProvisionUnknownSpace(t *testing.T) {
+	fake, cleanup := useFakeFoundation(t)
+	defer cleanup()
+	fake.AddOrganization("other-org", "other")
+	fake.AddSpace("other-space", "other", "other-org")
+
+	for body, message := range map[string]string{
+		`{"service_id": "cf", "plan_id": "cloudcontroller", "organization_guid": "missing", "space_guid": "space"}`:   "organization missing does not exist on foundation cf-a",
+		`{"service_id": "cf", "plan_id": "cloudcontroller", "organization_guid": "org", "space_guid": "missing"}`:     "space missing does not exist on foundation cf-a",
+		`{"service_id": "cf", "plan_id": "cloudcontroller", "organization_guid": "org", "space_guid": "other-space"}`: "space other-space does not belong to organization org",
+	} {
+		response := provisionWith(NewRouter(staticDir), "rejected", body)
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+		assert.Contains(t, response.Body.String(), message)
+
+		_, err := instanceStore.GetInstance(context.Background(), "rejected")
+		assert.Equal(t, store.ErrNotFound, err)
+	}
+}
+
+func TestBindGrantsSpaceRole(t *testing.T) {
+	fake, cleanup := useBindingFoundation(t)
+	defer cleanup()
+	defer useFakeFoundationConfig(t, fake, `
+plans:
+  cloudcontroller:
+    roles: [space_developer, org_auditor]
+`)()
+
+	response := sendBinding(http.MethodPut, "i1", "b1", `{"parameters": {"role": "space_developer"}}`)
+	assert.Equal(t, http.StatusCreated, response.Code)
+	credentials := bindingCredentialsOf(t, response)
+	assert.Equal(t, "org", credentials["organization_guid"])
+	assert.Equal(t, "space", credentials["space_guid"])
+	assert.Equal(t, []string{"organization_user org", "space_developer space"}, fake.Roles("cf-api-broker-b1"))
+
+	sendBinding(http.MethodPut, "i1", "b2", `{"parameters": {"role": "org_auditor"}}`)
+	assert.Equal(t, []string{"organization_user org", "organization_auditor org"}, fake.Roles("cf-api-broker-b2"))
+
+	assert.Equal(t, http.StatusOK, sendBinding(http.MethodDelete, "i1", "b1", "").Code)
+	assert.Nil(t, fake.Roles("cf-api-broker-b1"), "roles are revoked")
+}
+
+func TestBindRoleWithoutSpace(t *testing.T) {
+	fake, cleanup := useBindingFoundation(t)
+	defer cleanup()
+	defer useFakeFoundationConfig(t, fake, `
+plans:
+  cloudcontroller:
+    roles: [space_developer, org_auditor]
+    defaultRole: space_developer
+`)()
+	provisionWith(NewRouter(staticDir), "i2", `{"service_id": "cf", "plan_id": "cloudcontroller", "context": {"platform": "cloudfoundry", "organization_guid": "org"}}`)
+	provisionWith(NewRouter(staticDir), "i3", `{"service_id": "cf", "plan_id": "cloudcontroller"}`)
+
+	response := sendBinding(http.MethodPut, "i2", "b1", `{"parameters": {"role": "space_developer"}}`)
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Contains(t, response.Body.String(), "requires an instance in a space")
+	assert.Nil(t, fake.Client("cf-api-broker-b1"))
+
+	response = sendBinding(http.MethodPut, "i2", "b2", `{"parameters": {"role": "org_auditor"}}`)
+	assert.Equal(t, http.StatusCreated, response.Code)
+	assert.Equal(t, []string{"organization_user org", "organization_auditor org"}, fake.Roles("cf-api-broker-b2"))
+
+	response = sendBinding(http.MethodPut, "i2", "b3", `{}`)
+	assert.Equal(t, http.StatusCreated, response.Code)
+	assert.Nil(t, bindingCredentialsOf(t, response)["role"], "no default space role without space")
+
+	response = sendBinding(http.MethodPut, "i3", "b4", `{}`)
+	assert.Equal(t, http.StatusCreated, response.Code)
+	assert.Nil(t, bindingCredentialsOf(t, response)["role"], "no default role without org")
+	assert.Equal(t, http.StatusBadRequest, sendBinding(http.MethodPut, "i3", "b5", `{"parameters": {"role": "org_auditor"}}`).Code)
+}
+
+func TestBindRoleFailure(t *testing.T) {
+	fake, cleanup := useBindingFoundation(t)
+	defer cleanup()
+	defer useFakeFoundationConfig(t, fake, `
+plans:
+  cloudcontroller:
+    defaultRole: space_auditor
+`)()
+
+	fake.Fail("POST /v3/roles")
+	assert.Equal(t, http.StatusInternalServerError, sendBinding(http.MethodPut, "i1", "b1", `{}`).Code)
+	assert.Nil(t, fake.Client("cf-api-broker-b1"), "client is removed")
+	assert.Nil(t, fake.Roles("cf-api-broker-b1"))
+}
+
+func TestMigrateRequiresSpaceOnTarget(t *testing.T) {
+	defer useMemoryStore()()
+	source, target, cleanup := useMigrationFoundations(t)
+	defer cleanup()
+	source.AddOrganization("org", "team")
+	seedMigration(t, source, "client-1")
+
+	ctx := context.Background()
+	instance, _ := instanceStore.GetInstance(ctx, "i1")
+	instance.OrganizationGUID = "org"
+	instanceStore.PutInstance(ctx, instance)
+
+	assert.Equal(t, http.StatusAccepted, postAdmin("/admin/v1/instances/i1/migrations/", `{"target": "cf-b"}`).Code)
+	migrations.Wait()
+
+	instance, _ = instanceStore.GetInstance(ctx, "i1")
+	assert.Equal(t, "cf-a", instance.Foundation)
+	assert.Equal(t, 0, target.Clients())
+
+	operations, _ := instanceStore.ListOperations(ctx, "i1")
+	assert.Equal(t, store.StateFailed, operations[len(operations)-1].State)
+	assert.Contains(t, operations[len(operations)-1].Description, "organization org does not exist on foundation cf-b")
+}
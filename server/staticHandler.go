@@ -4,59 +4,118 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"runtime"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/sklevenz/cf-api-broker/config"
 )
 
+const headerAccept string = "Accept"
+
 var (
 	buildVersion string = "n/a"
 	buildCommit  string = "n/a"
+	buildTime    string = "n/a"
+
+	startTime = time.Now()
 )
 
+// versionInfo describes the running broker. Foundations are listed by name
+// only, never with credentials.
+type versionInfo struct {
+	BuildVersion string   `json:"buildVersion"`
+	BuildCommit  string   `json:"buildCommit"`
+	BuildTime    string   `json:"buildTime"`
+	GoVersion    string   `json:"goVersion"`
+	APIVersion   string   `json:"apiVersion"`
+	Features     []string `json:"features"`
+	ConfigHash   string   `json:"configHash"`
+	StartTime    string   `json:"startTime"`
+	Uptime       string   `json:"uptime"`
+	Foundations  []string `json:"foundations"`
+}
+
 // SetBuildVersion get build information from calling application
-func SetBuildVersion(version string, commit string) {
+func SetBuildVersion(version string, commit string, builtAt string) {
 	buildVersion = version
 	buildCommit = commit
+	buildTime = builtAt
 }
 
-func healthHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set(headerContentType, contentTypeJSON)
-	json.NewEncoder(w).Encode(map[string]bool{"ok": true})
-}
+// enabledFeatures lists the optional features switched on in configuration
+func enabledFeatures() []string {
+	cfg := config.Get()
+	features := []string{
+		"auth." + cfg.Server.AuthType,
+		"admin_auth." + cfg.Server.Admin.AuthType,
+	}
 
-func versionHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set(headerContentType, contentTypeJSON)
-	json.NewEncoder(w).Encode(map[string]string{"buildVersion": buildVersion, "buildCommit": buildCommit})
+	if cfg.Server.TLS.CertFile != "" {
+		features = append(features, "tls")
+	}
+	if cfg.Tracing.Endpoint != "" {
+		features = append(features, "tracing")
+	}
+	if cfg.Audit.File != "" {
+		features = append(features, "audit.file")
+	}
+	if cfg.Audit.Syslog.Network != "" {
+		features = append(features, "audit.syslog")
+	}
+	if cfg.Store.Type != "" {
+		features = append(features, "store."+cfg.Store.Type)
+	} else {
+		features = append(features, "store."+config.StoreTypeMemory)
+	}
+
+	return features
 }
 
-func authHandler(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-
-		if config.Get().Server.AuthType == config.AuthTypeBasic {
-
-			// handle basic auth
-			u, p, ok := r.BasicAuth()
-			if !ok || len(strings.TrimSpace(u)) < 1 || len(strings.TrimSpace(p)) < 1 {
-				unauthorised(w)
-				return
-			}
-
-			if u != config.Get().Server.BasicAuth.UserName || p != config.Get().Server.BasicAuth.Password {
-				unauthorised(w)
-				return
-			}
-		} else {
-			err := fmt.Errorf("Config error: unsupported AuthType: \"%v\"", config.Get().Server.AuthType)
-			handleHTTPError(w, http.StatusInternalServerError, err)
-			return
-		}
-
-		next.ServeHTTP(w, r)
-	})
+func newVersionInfo() versionInfo {
+	cfs := config.Get().CloudFoundries
+	foundations := make([]string, 0, len(cfs))
+	for name := range cfs {
+		foundations = append(foundations, name)
+	}
+	sort.Strings(foundations)
+
+	return versionInfo{
+		BuildVersion: buildVersion,
+		BuildCommit:  buildCommit,
+		BuildTime:    buildTime,
+		GoVersion:    runtime.Version(),
+		APIVersion:   supportedAPIVersionValue,
+		Features:     enabledFeatures(),
+		ConfigHash:   fmt.Sprintf("%v", config.GetLastModifiedHash()),
+		StartTime:    startTime.UTC().Format(time.RFC3339),
+		Uptime:       time.Since(startTime).Round(time.Second).String(),
+		Foundations:  foundations,
+	}
 }
 
-func unauthorised(rw http.ResponseWriter) {
-	rw.Header().Set("WWW-Authenticate", "Basic realm=Restricted")
-	rw.WriteHeader(http.StatusUnauthorized)
+// versionHandler returns build and runtime information as JSON or, if the
+// client accepts text/plain but not JSON, as text
+func versionHandler(w http.ResponseWriter, r *http.Request) {
+	info := newVersionInfo()
+
+	accept := r.Header.Get(headerAccept)
+	if strings.Contains(accept, "text/plain") && !strings.Contains(accept, "application/json") {
+		w.Header().Set(headerContentType, contentTypeTEXT)
+		fmt.Fprintf(w, "buildVersion: %v\n", info.BuildVersion)
+		fmt.Fprintf(w, "buildCommit: %v\n", info.BuildCommit)
+		fmt.Fprintf(w, "buildTime: %v\n", info.BuildTime)
+		fmt.Fprintf(w, "goVersion: %v\n", info.GoVersion)
+		fmt.Fprintf(w, "apiVersion: %v\n", info.APIVersion)
+		fmt.Fprintf(w, "features: %v\n", strings.Join(info.Features, ", "))
+		fmt.Fprintf(w, "configHash: %v\n", info.ConfigHash)
+		fmt.Fprintf(w, "startTime: %v\n", info.StartTime)
+		fmt.Fprintf(w, "uptime: %v\n", info.Uptime)
+		fmt.Fprintf(w, "foundations: %v\n", strings.Join(info.Foundations, ", "))
+		return
+	}
+
+	w.Header().Set(headerContentType, contentTypeJSON)
+	json.NewEncoder(w).Encode(info)
 }
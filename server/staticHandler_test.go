@@ -1,8 +1,11 @@
 package server
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"runtime"
 	"testing"
 
 	"github.com/sklevenz/cf-api-broker/config"
@@ -15,6 +18,7 @@ const (
 
 func init() {
 	config.Read("./../config/config.yaml")
+	ConfigureLogging()
 }
 
 func TestBasicAuth403(t *testing.T) {
@@ -62,13 +66,41 @@ func TestStaticCSS(t *testing.T) {
 
 func TestVersion(t *testing.T) {
 	request, _ := http.NewRequest(http.MethodGet, "/version/", nil)
-	request.SetBasicAuth("username", "password")
+	request.SetBasicAuth("admin", "admin")
 	response := httptest.NewRecorder()
 
 	NewRouter(staticDir).ServeHTTP(response, request)
 
 	assert.Equal(t, contentTypeJSON, response.Header().Get(headerContentType))
-	assert.JSONEq(t, `{"buildVersion":"n/a", "buildCommit":"n/a"}`, response.Body.String())
+	assert.Equal(t, http.StatusOK, response.Result().StatusCode)
+
+	info := versionInfo{}
+	assert.Nil(t, json.Unmarshal(response.Body.Bytes(), &info))
+	assert.Equal(t, "n/a", info.BuildVersion)
+	assert.Equal(t, "n/a", info.BuildCommit)
+	assert.Equal(t, "n/a", info.BuildTime)
+	assert.Equal(t, runtime.Version(), info.GoVersion)
+	assert.Equal(t, supportedAPIVersionValue, info.APIVersion)
+	assert.Equal(t, fmt.Sprintf("%v", config.GetLastModifiedHash()), info.ConfigHash)
+	assert.Contains(t, info.Features, "auth.basic")
+	assert.Contains(t, info.Features, "audit.syslog")
+	assert.Contains(t, info.Features, "store.memory")
+	assert.NotEmpty(t, info.Uptime)
+	assert.Equal(t, []string{"cf-eu10", "cf-eu10-001", "cf-eu10-002"}, info.Foundations)
+	assert.NotContains(t, response.Body.String(), "admin-eu10")
+}
+
+func TestVersionText(t *testing.T) {
+	request, _ := http.NewRequest(http.MethodGet, "/version/", nil)
+	request.SetBasicAuth("admin", "admin")
+	request.Header.Set(headerAccept, "text/plain")
+	response := httptest.NewRecorder()
+
+	NewRouter(staticDir).ServeHTTP(response, request)
+
+	assert.Equal(t, contentTypeTEXT, response.Header().Get(headerContentType))
+	assert.Contains(t, response.Body.String(), "apiVersion: "+supportedAPIVersionValue+"\n")
+	assert.Contains(t, response.Body.String(), "foundations: cf-eu10, cf-eu10-001, cf-eu10-002\n")
 	assert.Equal(t, http.StatusOK, response.Result().StatusCode)
 }
 func TestHealth(t *testing.T) {
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/sklevenz/cf-api-broker/config"
+)
+
+// certReloader loads server certificate and client CA bundle and reloads them
+// whenever the files change on disk
+type certReloader struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+
+	clientAuth tls.ClientAuthType
+
+	mutex        sync.Mutex
+	cert         *tls.Certificate
+	certModified time.Time
+	clientCAs    *x509.CertPool
+	caModified   time.Time
+}
+
+// NewTLSConfig creates a TLS configuration from the server tls configuration.
+// It returns nil if no certificate is configured. Certificates are reloaded
+// on change without restarting the server.
+func NewTLSConfig() (*tls.Config, error) {
+	cfg := config.Get().Server
+
+	mtls := cfg.AuthType == config.AuthTypeMTLS || cfg.Admin.AuthType == config.AuthTypeMTLS
+
+	if cfg.TLS.CertFile == "" && cfg.TLS.KeyFile == "" {
+		if mtls {
+			return nil, errors.New("Config error: auth type mtls requires tls certFile and keyFile")
+		}
+		return nil, nil
+	}
+
+	reloader := &certReloader{
+		certFile:     cfg.TLS.CertFile,
+		keyFile:      cfg.TLS.KeyFile,
+		clientCAFile: cfg.TLS.ClientCAFile,
+		clientAuth:   tls.NoClientCert,
+	}
+
+	if mtls && reloader.clientCAFile == "" {
+		return nil, errors.New("Config error: auth type mtls requires tls clientCAFile")
+	}
+
+	// client certificates are optional during the handshake to keep public
+	// routes reachable, the auth handler rejects requests without certificate
+	if reloader.clientCAFile != "" {
+		reloader.clientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	// fail early on invalid files
+	if err := reloader.reload(); err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		GetConfigForClient: reloader.getConfigForClient,
+	}, nil
+}
+
+func (c *certReloader) getConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	if err := c.reload(); err != nil {
+		log.Errorf("Error reloading TLS certificates, keep using previous ones: %v", err)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{*c.cert},
+		ClientCAs:    c.clientCAs,
+		ClientAuth:   c.clientAuth,
+	}, nil
+}
+
+// reload reads certificate and CA files if their modification time changed
+func (c *certReloader) reload() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	certModified, err := modTime(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+
+	if c.cert == nil || !certModified.Equal(c.certModified) {
+		cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+		if err != nil {
+			return fmt.Errorf("loading certificate %v failed: %v", c.certFile, err)
+		}
+		c.cert = &cert
+		c.certModified = certModified
+		log.Infof("Loaded TLS certificate %v", c.certFile)
+	}
+
+	if c.clientCAFile == "" {
+		return nil
+	}
+
+	caModified, err := modTime(c.clientCAFile)
+	if err != nil {
+		return err
+	}
+
+	if c.clientCAs == nil || !caModified.Equal(c.caModified) {
+		data, err := ioutil.ReadFile(c.clientCAFile)
+		if err != nil {
+			return err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return fmt.Errorf("no certificates found in client CA bundle %v", c.clientCAFile)
+		}
+		c.clientCAs = pool
+		c.caModified = caModified
+		log.Infof("Loaded client CA bundle %v", c.clientCAFile)
+	}
+
+	return nil
+}
+
+// modTime returns the latest modification time of the given files
+func modTime(files ...string) (time.Time, error) {
+	latest := time.Time{}
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return latest, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
@@ -0,0 +1,190 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCert(t *testing.T, subject pkix.Name, parent *testCert, dnsNames ...string) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      subject,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     dnsNames,
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	signerCert, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		signerCert, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signerCert, &key.PublicKey, signerKey)
+	assert.Nil(t, err)
+	cert, _ := x509.ParseCertificate(der)
+
+	return &testCert{cert: cert, key: key}
+}
+
+func (c *testCert) certPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw})
+}
+
+func (c *testCert) keyPEM() []byte {
+	der, _ := x509.MarshalECPrivateKey(c.key)
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+}
+
+func (c *testCert) tlsCertificate() tls.Certificate {
+	cert, _ := tls.X509KeyPair(c.certPEM(), c.keyPEM())
+	return cert
+}
+
+func writeFile(t *testing.T, path string, data []byte, modified time.Time) {
+	assert.Nil(t, ioutil.WriteFile(path, data, 0600))
+	assert.Nil(t, os.Chtimes(path, modified, modified))
+}
+
+func TestNoTLSConfig(t *testing.T) {
+	tlsConfig, err := NewTLSConfig()
+
+	assert.Nil(t, err)
+	assert.Nil(t, tlsConfig)
+}
+
+func TestMTLSAuth(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "tls")
+	defer os.RemoveAll(dir)
+
+	ca := newTestCert(t, pkix.Name{CommonName: "ca"}, nil)
+	serverCert := newTestCert(t, pkix.Name{CommonName: "broker"}, ca, "localhost")
+	platform := newTestCert(t, pkix.Name{CommonName: "cf-platform", Organization: []string{"cf-api-broker"}}, ca)
+	sanPlatform := newTestCert(t, pkix.Name{CommonName: "other"}, ca, "platform.example.com")
+	stranger := newTestCert(t, pkix.Name{CommonName: "stranger"}, ca)
+
+	now := time.Now()
+	writeFile(t, filepath.Join(dir, "cert.pem"), serverCert.certPEM(), now)
+	writeFile(t, filepath.Join(dir, "key.pem"), serverCert.keyPEM(), now)
+	writeFile(t, filepath.Join(dir, "ca.pem"), ca.certPEM(), now)
+
+	defer useConfig(t, fmt.Sprintf(`
+server:
+  authtype: mtls
+  mtls:
+    subjects:
+    - "CN=cf-platform,O=cf-api-broker"
+    sans:
+    - platform.example.com
+  tls:
+    certFile: %[1]v/cert.pem
+    keyFile: %[1]v/key.pem
+    clientCAFile: %[1]v/ca.pem
+`, dir))()
+
+	tlsConfig, err := NewTLSConfig()
+	assert.Nil(t, err)
+
+	server := httptest.NewUnstartedServer(NewRouter(staticDir))
+	server.TLS = tlsConfig
+	server.StartTLS()
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	get := func(client *testCert) (int, error) {
+		clientTLS := &tls.Config{RootCAs: roots}
+		if client != nil {
+			clientTLS.Certificates = []tls.Certificate{client.tlsCertificate()}
+		}
+		httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: clientTLS}}
+		response, err := httpClient.Get(server.URL + "/")
+		if err != nil {
+			return 0, err
+		}
+		response.Body.Close()
+		return response.StatusCode, nil
+	}
+
+	status, err := get(platform)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, status)
+
+	status, err = get(sanPlatform)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, status)
+
+	status, err = get(stranger)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	status, err = get(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
+
+func TestCertificateReload(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "tls")
+	defer os.RemoveAll(dir)
+
+	ca := newTestCert(t, pkix.Name{CommonName: "ca"}, nil)
+	first := newTestCert(t, pkix.Name{CommonName: "first"}, ca)
+	second := newTestCert(t, pkix.Name{CommonName: "second"}, ca)
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	modified := time.Now().Add(-time.Minute)
+	writeFile(t, certFile, first.certPEM(), modified)
+	writeFile(t, keyFile, first.keyPEM(), modified)
+
+	reloader := &certReloader{certFile: certFile, keyFile: keyFile}
+	tlsConfig, err := reloader.getConfigForClient(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, first.cert.Raw, tlsConfig.Certificates[0].Certificate[0])
+
+	writeFile(t, certFile, second.certPEM(), time.Now())
+	writeFile(t, keyFile, second.keyPEM(), time.Now())
+
+	tlsConfig, err = reloader.getConfigForClient(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, second.cert.Raw, tlsConfig.Certificates[0].Certificate[0])
+
+	// broken files keep the previous certificate
+	writeFile(t, certFile, []byte("broken"), time.Now().Add(time.Minute))
+
+	tlsConfig, err = reloader.getConfigForClient(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, second.cert.Raw, tlsConfig.Certificates[0].Certificate[0])
+}
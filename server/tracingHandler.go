@@ -0,0 +1,43 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/sklevenz/cf-api-broker/tracing"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/semconv"
+)
+
+// tracingHandler wraps each request in a server span named by its mux
+// route, continuing the trace of the caller given by a traceparent header
+func tracingHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := unknownRoute
+		template := r.URL.Path
+		if route := mux.CurrentRoute(r); route != nil {
+			if route.GetName() != "" {
+				name = route.GetName()
+			}
+			if t, err := route.GetPathTemplate(); err == nil {
+				template = t
+			}
+		}
+
+		ctx, span := tracing.StartServer(r, name,
+			semconv.HTTPMethodKey.String(r.Method),
+			semconv.HTTPRouteKey.String(template),
+			semconv.HTTPTargetKey.String(r.URL.Path))
+		defer span.End()
+
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		status := recorder.code()
+		span.SetAttributes(semconv.HTTPStatusCodeKey.Int(status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, fmt.Sprintf("HTTP status %v", status))
+		}
+	})
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sklevenz/cf-api-broker/tracing"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/semconv"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracingSpanPerRoute(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	defer tracing.SetupWithExporter(exporter)(context.Background())
+
+	request, _ := http.NewRequest(http.MethodGet, "/v2/catalog/", nil)
+	request.SetBasicAuth("username", "password")
+	request.Header.Set(headerAPIVersion, "2.14")
+	request.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	response := httptest.NewRecorder()
+
+	NewRouter(staticDir).ServeHTTP(response, request)
+
+	spans := exporter.GetSpans()
+	assert.Len(t, spans, 1)
+
+	span := spans[0]
+	assert.Equal(t, "v2.catalog", span.Name)
+	assert.Equal(t, trace.SpanKindServer, span.SpanKind)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext.TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", span.Parent.SpanID().String())
+	assert.Contains(t, span.Attributes, semconv.HTTPStatusCodeKey.Int(http.StatusOK))
+	assert.Contains(t, span.Attributes, attribute.String(string(semconv.HTTPRouteKey), "/v2/catalog/"))
+}
+
+func TestTracingNewTrace(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	defer tracing.SetupWithExporter(exporter)(context.Background())
+
+	request, _ := http.NewRequest(http.MethodGet, "/health/", nil)
+	response := httptest.NewRecorder()
+
+	NewRouter(staticDir).ServeHTTP(response, request)
+
+	spans := exporter.GetSpans()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, "health", spans[0].Name)
+	assert.False(t, spans[0].Parent.IsValid())
+}
@@ -2,16 +2,22 @@ package server
 
 import (
 	"bytes"
-	"encoding/base64"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
+	"reflect"
 	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
 	"github.com/sklevenz/cf-api-broker/config"
+	"github.com/sklevenz/cf-api-broker/metrics"
 	"github.com/sklevenz/cf-api-broker/openapi"
+	"github.com/sklevenz/cf-api-broker/placement"
+	"github.com/sklevenz/cf-api-broker/store"
 )
 
 const (
@@ -22,15 +28,6 @@ const (
 	headerAPIRequestIdentity    string = "X-Broker-API-Request-Identity"
 )
 
-type userIDType struct {
-	UserID string `json:"user_id"`
-}
-
-type originatingIdentityType struct {
-	Platform string     `json:"platform"`
-	UserID   userIDType `json:"user_id_object"`
-}
-
 func handleOSBError(w http.ResponseWriter, code int, err openapi.Error) {
 	output, _ := json.Marshal(err)
 
@@ -51,54 +48,6 @@ func handleHTTPError(w http.ResponseWriter, code int, err error) {
 	w.Write(output)
 }
 
-func parseOriginatingIdentityHeader(value string) (*originatingIdentityType, error) {
-	value = strings.TrimSpace(value)
-	values := strings.Split(value, " ")
-
-	originatingIdentity := &originatingIdentityType{}
-	originatingIdentity.Platform = values[0]
-
-	encoded, err := base64.StdEncoding.DecodeString(values[1])
-
-	if err != nil {
-		log.Printf("Error in Originating Identity Header, user_id not base64 encoded: %v", value)
-		return nil, err
-	}
-
-	json.Unmarshal([]byte(encoded), &originatingIdentity.UserID)
-
-	return originatingIdentity, nil
-}
-
-func originatingIdentityLogHandler(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		headerValue := r.Header.Get(headerAPIOrginatingIdentity)
-		if headerValue != "" {
-			originatingIdentity, err := parseOriginatingIdentityHeader(headerValue)
-			if err == nil {
-				log.Printf("Originating Identity: %v", originatingIdentity)
-			}
-		} else {
-			log.Printf("Header %v not set", headerAPIOrginatingIdentity)
-		}
-
-		next.ServeHTTP(w, r)
-	})
-}
-
-func requestIdentityLogHandler(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		headerValue := r.Header.Get(headerAPIRequestIdentity)
-		if headerValue != "" {
-			log.Printf("Request Identity: %v", headerValue)
-		} else {
-			log.Printf("Header %v not set", headerAPIRequestIdentity)
-		}
-
-		next.ServeHTTP(w, r)
-	})
-}
-
 func apiVersionHandler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		supportedAPIVersion := strings.Split(supportedAPIVersionValue, ".")[0]
@@ -106,7 +55,7 @@ func apiVersionHandler(next http.Handler) http.Handler {
 
 		if requestedAPIVersionValue == "" {
 			err := fmt.Errorf("HTTP Status: (%v) - mandatory request header %v not set", http.StatusPreconditionFailed, headerAPIVersion)
-			log.Printf("Error: %v", err)
+			requestLogger(r).Warnf("Error: %v", err)
 			handleHTTPError(w, http.StatusPreconditionFailed, err)
 			return
 		}
@@ -114,7 +63,7 @@ func apiVersionHandler(next http.Handler) http.Handler {
 		requestedAPIVersion := strings.Split(requestedAPIVersionValue, ".")[0]
 		if supportedAPIVersion != requestedAPIVersion {
 			err := fmt.Errorf("HTTP Status: (%v) - requested API version is %v but supported API version is %v", http.StatusPreconditionFailed, r.Header.Get(headerAPIVersion), supportedAPIVersionValue)
-			log.Printf("Error: %v", err)
+			requestLogger(r).Warnf("Error: %v", err)
 			handleHTTPError(w, http.StatusPreconditionFailed, err)
 			return
 		}
@@ -157,6 +106,7 @@ func buildCatalog() *openapi.Catalog {
 	service.Bindable = true
 	service.InstancesRetrievable = true
 	service.BindingsRetrievable = true
+	service.BindingRotatable = true
 	service.AllowContextUpdates = true
 	service.Metadata = map[string]interface{}{}
 	service.DashboardClient = openapi.DashboardClient{}
@@ -174,8 +124,9 @@ func buildCatalog() *openapi.Catalog {
 	plan.Bindable = true
 	plan.PlanUpdateable = true
 	plan.Schemas = openapi.SchemasObject{}
+	plan.Schemas.ServiceBinding.Create.Parameters = bindingSchema(plan.Id)
 	plan.MaximumPollingDuration = 10
-	plan.MaintenanceInfo = openapi.MaintenanceInfo{}
+	plan.MaintenanceInfo = planMaintenanceInfo(plan.Id)
 
 	plans = append(plans, plan)
 
@@ -183,11 +134,14 @@ func buildCatalog() *openapi.Catalog {
 	services = append(services, service)
 	catalog.Services = services
 
-	log.Printf("Catalog: %v", catalog)
+	log.Debugf("Catalog: %v", catalog)
 
 	return &catalog
 }
 
+// createServiceHandler places and stores a new instance. Repeating the request
+// for an existing instance returns it unchanged, requests with different
+// attributes conflict with it.
 func createServiceHandler(w http.ResponseWriter, r *http.Request) {
 	var provisionData = &openapi.ServiceInstanceProvisionRequest{}
 	err := json.NewDecoder(r.Body).Decode(&provisionData)
@@ -196,8 +150,64 @@ func createServiceHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	platform, err := parseProvisionContext(provisionData)
+	if err != nil {
+		handleHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := checkMaintenanceInfo(provisionData.PlanId, provisionData.MaintenanceInfo); err != nil {
+		handleMaintenanceInfoConflict(w, err)
+		return
+	}
+
 	instanceID := mux.Vars(r)["instance_id"]
-	js, err := json.Marshal(createServiceInstance(instanceID, provisionData))
+	existing, err := instanceStore.GetInstance(r.Context(), instanceID)
+	if err == nil {
+		addLogField(r, "foundation", existing.Foundation)
+		if !sameInstance(existing, provisionData, platform) {
+			handleHTTPError(w, http.StatusConflict, fmt.Errorf("instance %v exists with different attributes", instanceID))
+			return
+		}
+		writeProvisionResponse(w, r, provisionResponse(existing, time.Now()))
+		return
+	}
+	if !errors.Is(err, store.ErrNotFound) {
+		handleHTTPError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	foundationName, err := placeInstance(r.Context(), nil, "")
+	if err == placement.ErrNoFoundation {
+		requestLogger(r).Warnf("Error placing service instance: %v", err)
+		handleHTTPError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	if err != nil {
+		requestLogger(r).Errorf("Error placing service instance: %v", err)
+		handleHTTPError(w, http.StatusInternalServerError, err)
+		return
+	}
+	addLogField(r, "foundation", foundationName)
+
+	service, err := createServiceInstance(r.Context(), instanceID, foundationName, provisionData, platform)
+	var unknownSpace *errUnknownSpace
+	if errors.As(err, &unknownSpace) {
+		requestLogger(r).Warnf("Error creating service instance: %v", err)
+		handleHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		requestLogger(r).Errorf("Error creating service instance: %v", err)
+		handleHTTPError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeProvisionResponse(w, r, service)
+}
+
+func writeProvisionResponse(w http.ResponseWriter, r *http.Request, service *openapi.ServiceInstanceProvisionResponse) {
+	js, err := json.Marshal(service)
 	if err != nil {
 		handleHTTPError(w, http.StatusInternalServerError, err)
 		return
@@ -206,13 +216,279 @@ func createServiceHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set(headerContentType, contentTypeJSON)
 	reader := bytes.NewReader(js)
 	http.ServeContent(w, r, "xxx", config.GetLastModified(), reader)
+}
+
+// sameInstance reports whether a repeated provision request asks for the
+// existing instance. Requests with other service, plan, parameters, platform,
+// org or space conflict with it.
+func sameInstance(instance *store.Instance, provisionData *openapi.ServiceInstanceProvisionRequest, platform *platformContext) bool {
+	organizationGUID, spaceGUID := "", ""
+	if cf := platform.CloudFoundry; cf != nil {
+		organizationGUID, spaceGUID = cf.OrganizationGUID, cf.SpaceGUID
+	}
 
+	return instance.ServiceID == provisionData.ServiceId &&
+		instance.PlanID == provisionData.PlanId &&
+		instance.Platform == platform.Platform &&
+		instance.OrganizationGUID == organizationGUID &&
+		instance.SpaceGUID == spaceGUID &&
+		sameParameters(instance.Parameters, provisionData.Parameters)
 }
 
-func createServiceInstance(instanceID string, provisionData *openapi.ServiceInstanceProvisionRequest) *openapi.ServiceInstanceProvisionResponse {
-	service := &openapi.ServiceInstanceProvisionResponse{
-		Metadata: openapi.ServiceInstanceMetadata{},
+// sameParameters reports whether two requests sent the same parameters, no
+// parameters and empty parameters are the same
+func sameParameters(a map[string]interface{}, b map[string]interface{}) bool {
+	return len(a) == 0 && len(b) == 0 || reflect.DeepEqual(a, b)
+}
+
+// provisionResponse describes a provisioned instance
+func provisionResponse(instance *store.Instance, now time.Time) *openapi.ServiceInstanceProvisionResponse {
+	return &openapi.ServiceInstanceProvisionResponse{
+		DashboardUrl: dashboardURL(instance.ID, now),
+		Metadata:     osbMetadata(instance.Metadata),
 	}
+}
 
-	return service
+// createServiceInstance stores an instance placed on foundationName. The org
+// and space of Cloud Foundry instances have to exist on the foundation.
+func createServiceInstance(ctx context.Context, instanceID string, foundationName string, provisionData *openapi.ServiceInstanceProvisionRequest, platform *platformContext) (*openapi.ServiceInstanceProvisionResponse, error) {
+	now := time.Now().UTC()
+	instance := &store.Instance{
+		ID:         instanceID,
+		ServiceID:  provisionData.ServiceId,
+		PlanID:     provisionData.PlanId,
+		Platform:   platform.Platform,
+		Context:    provisionData.Context,
+		Parameters: provisionData.Parameters,
+		Foundation: foundationName,
+		State:      store.StateSucceeded,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+
+		MaintenanceVersion: planMaintenanceInfo(provisionData.PlanId).Version,
+	}
+	if cf := platform.CloudFoundry; cf != nil {
+		instance.OrganizationGUID = cf.OrganizationGUID
+		instance.SpaceGUID = cf.SpaceGUID
+	}
+	if instance.OrganizationGUID != "" {
+		if err := resolveSpace(ctx, foundationName, instance); err != nil {
+			return nil, err
+		}
+	}
+	metadata, err := instanceMetadata(foundationName, instance)
+	if err != nil {
+		return nil, err
+	}
+	instance.Metadata = metadata
+	if err := instanceStore.PutInstance(ctx, instance); err != nil {
+		return nil, err
+	}
+	metrics.Instances.WithLabelValues(foundationName, instance.PlanID).Inc()
+
+	operation := &store.Operation{
+		ID:         newUUID(),
+		InstanceID: instanceID,
+		Type:       store.OperationProvision,
+		State:      store.StateSucceeded,
+		StartedAt:  now,
+		UpdatedAt:  now,
+	}
+	if err := instanceStore.PutOperation(ctx, operation); err != nil {
+		return nil, err
+	}
+
+	return provisionResponse(instance, now), nil
+}
+
+// updateServiceHandler changes the plan, parameters or context of an instance.
+// Requests for a new maintenance version of the plan upgrade the instance.
+func updateServiceHandler(w http.ResponseWriter, r *http.Request) {
+	updateData := &openapi.ServiceInstanceUpdateRequest{}
+	if err := json.NewDecoder(r.Body).Decode(updateData); err != nil {
+		handleHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	instanceID := mux.Vars(r)["instance_id"]
+	instance, err := instanceStore.GetInstance(r.Context(), instanceID)
+	if errors.Is(err, store.ErrNotFound) {
+		handleHTTPError(w, http.StatusNotFound, fmt.Errorf("instance %v not found", instanceID))
+		return
+	}
+	if err != nil {
+		handleHTTPError(w, http.StatusInternalServerError, err)
+		return
+	}
+	addLogField(r, "foundation", instance.Foundation)
+
+	if instance.State == store.StateInProgress {
+		handleOSBError(w, http.StatusUnprocessableEntity, openapi.Error{
+			Error:       "ConcurrencyError",
+			Description: fmt.Sprintf("instance %v has an operation in progress", instanceID),
+		})
+		return
+	}
+
+	if updateData.PlanId == "" {
+		updateData.PlanId = instance.PlanID
+	}
+	if err := checkMaintenanceInfo(updateData.PlanId, updateData.MaintenanceInfo); err != nil {
+		handleMaintenanceInfoConflict(w, err)
+		return
+	}
+
+	service, err := updateServiceInstance(r.Context(), instance, updateData)
+	if err != nil {
+		requestLogger(r).Errorf("Error updating service instance: %v", err)
+		handleHTTPError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, service)
+}
+
+// updateServiceInstance applies an update request to instance. If the request
+// moves the instance to a new maintenance version or plan the credentials of
+// its bindings are re-issued with the scopes of the plan.
+func updateServiceInstance(ctx context.Context, instance *store.Instance, updateData *openapi.ServiceInstanceUpdateRequest) (*openapi.ServiceInstanceProvisionResponse, error) {
+	now := time.Now().UTC()
+	operation := &store.Operation{
+		ID:         newUUID(),
+		InstanceID: instance.ID,
+		Type:       store.OperationUpdate,
+		State:      store.StateSucceeded,
+		Progress:   100,
+		StartedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	previousPlanID := instance.PlanID
+	instance.PlanID = updateData.PlanId
+	if updateData.Parameters != nil {
+		instance.Parameters = updateData.Parameters
+	}
+	if updateData.Context != nil {
+		instance.Context = updateData.Context
+	}
+
+	version := updateData.MaintenanceInfo.Version
+	change := ""
+	switch {
+	case version != "" && version != instance.MaintenanceVersion:
+		change = fmt.Sprintf("upgraded from maintenance version %v to %v", instance.MaintenanceVersion, version)
+	case previousPlanID != instance.PlanID:
+		change = fmt.Sprintf("changed plan from %v to %v", previousPlanID, instance.PlanID)
+	}
+	if change != "" {
+		upgraded, err := upgradeInstance(ctx, instance)
+		if err != nil {
+			operation.State = store.StateFailed
+			operation.Description = fmt.Sprintf("%v failed: %v", change, err)
+			instanceStore.PutOperation(ctx, operation)
+			return nil, err
+		}
+		operation.Description = fmt.Sprintf("%v, re-issued credentials of %v bindings", change, upgraded)
+		if version != "" {
+			instance.MaintenanceVersion = version
+		}
+	}
+
+	instance.UpdatedAt = now
+	if err := instanceStore.PutInstance(ctx, instance); err != nil {
+		return nil, err
+	}
+	if previousPlanID != instance.PlanID {
+		metrics.Instances.WithLabelValues(instance.Foundation, previousPlanID).Dec()
+		metrics.Instances.WithLabelValues(instance.Foundation, instance.PlanID).Inc()
+	}
+	if err := instanceStore.PutOperation(ctx, operation); err != nil {
+		return nil, err
+	}
+
+	return provisionResponse(instance, now), nil
+}
+
+// lastOperationResponse is the last operation of an instance with the
+// metadata of the instance
+type lastOperationResponse struct {
+	openapi.LastOperationResource
+	Metadata openapi.ServiceInstanceMetadata `json:"metadata"`
+}
+
+// getServiceHandler returns an instance with the metadata stored when it was
+// placed and a freshly signed dashboard URL
+func getServiceHandler(w http.ResponseWriter, r *http.Request) {
+	instance, ok := requestInstance(w, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, &openapi.ServiceInstanceResource{
+		ServiceId:       instance.ServiceID,
+		PlanId:          instance.PlanID,
+		DashboardUrl:    dashboardURL(instance.ID, time.Now()),
+		Parameters:      instance.Parameters,
+		MaintenanceInfo: openapi.MaintenanceInfo{Version: instance.MaintenanceVersion},
+		Metadata:        osbMetadata(instance.Metadata),
+	})
+}
+
+// lastOperationHandler returns the operation named by the operation query
+// parameter or the latest operation of an instance
+func lastOperationHandler(w http.ResponseWriter, r *http.Request) {
+	instance, ok := requestInstance(w, r)
+	if !ok {
+		return
+	}
+
+	var operation *store.Operation
+	if operationID := r.URL.Query().Get("operation"); operationID != "" {
+		var err error
+		operation, err = instanceStore.GetOperation(r.Context(), instance.ID, operationID)
+		if errors.Is(err, store.ErrNotFound) {
+			handleHTTPError(w, http.StatusNotFound, fmt.Errorf("operation %v of instance %v not found", operationID, instance.ID))
+			return
+		}
+		if err != nil {
+			handleHTTPError(w, http.StatusInternalServerError, err)
+			return
+		}
+	} else {
+		operations, err := instanceStore.ListOperations(r.Context(), instance.ID)
+		if err != nil {
+			handleHTTPError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if len(operations) == 0 {
+			handleHTTPError(w, http.StatusNotFound, fmt.Errorf("instance %v has no operations", instance.ID))
+			return
+		}
+		operation = operations[len(operations)-1]
+	}
+
+	writeJSON(w, &lastOperationResponse{
+		LastOperationResource: openapi.LastOperationResource{
+			State:       operation.State,
+			Description: operation.Description,
+		},
+		Metadata: osbMetadata(instance.Metadata),
+	})
+}
+
+// requestInstance looks up the instance of a request and writes an error
+// response if it is unavailable
+func requestInstance(w http.ResponseWriter, r *http.Request) (*store.Instance, bool) {
+	instanceID := mux.Vars(r)["instance_id"]
+	instance, err := instanceStore.GetInstance(r.Context(), instanceID)
+	if errors.Is(err, store.ErrNotFound) {
+		handleHTTPError(w, http.StatusNotFound, fmt.Errorf("instance %v not found", instanceID))
+		return nil, false
+	}
+	if err != nil {
+		handleHTTPError(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	addLogField(r, "foundation", instance.Foundation)
+	return instance, true
 }
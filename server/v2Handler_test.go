@@ -2,16 +2,20 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"testing"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	log "github.com/sirupsen/logrus"
 	"github.com/sklevenz/cf-api-broker/config"
+	"github.com/sklevenz/cf-api-broker/metrics"
 	"github.com/sklevenz/cf-api-broker/openapi"
+	"github.com/sklevenz/cf-api-broker/store"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -90,10 +94,10 @@ func TestAPIOriginatingIdentity(t *testing.T) {
 
 	request.Header.Set(headerAPIOrginatingIdentity, "cloudfoundry eyANCiAgInVzZXJfaWQiOiAiNjgzZWE3NDgtMzA5Mi00ZmY0LWI2NTYtMzljYWNjNGQ1MzYwIg0KfQ==")
 
-	handler := originatingIdentityLogHandler(testHandler)
+	handler := logHandler(originatingIdentityHandler(testHandler))
 	handler.ServeHTTP(response, request)
 
-	assert.Contains(t, buf.String(), "cloudfoundry")
+	assert.Contains(t, buf.String(), "\"platform\":\"cloudfoundry\"")
 	assert.Contains(t, buf.String(), "683ea748-3092-4ff4-b656-39cacc4d5360")
 	assert.Equal(t, http.StatusOK, response.Result().StatusCode)
 }
@@ -114,10 +118,11 @@ func TestAPIRequestIdentity(t *testing.T) {
 
 	request.Header.Set(headerAPIRequestIdentity, "e26cee84-6b38-4456-b34e-d1a9f002c956")
 
-	handler := requestIdentityLogHandler(testHandler)
+	handler := logHandler(testHandler)
 	handler.ServeHTTP(response, request)
 
-	assert.Contains(t, buf.String(), "e26cee84-6b38-4456-b34e-d1a9f002c956")
+	assert.Contains(t, buf.String(), "\"request_id\":\"e26cee84-6b38-4456-b34e-d1a9f002c956\"")
+	assert.Equal(t, "e26cee84-6b38-4456-b34e-d1a9f002c956", response.Header().Get(headerAPIRequestIdentity))
 	assert.Equal(t, http.StatusOK, response.Result().StatusCode)
 }
 func TestHttpErrorHandler(t *testing.T) {
@@ -130,7 +135,7 @@ func TestHttpErrorHandler(t *testing.T) {
 		handleHTTPError(w, http.StatusInternalServerError, errors.New("blabla"))
 	})
 
-	handler := requestIdentityLogHandler(testHandler)
+	handler := logHandler(testHandler)
 	handler.ServeHTTP(response, request)
 
 	assert.Equal(t, http.StatusInternalServerError, response.Result().StatusCode)
@@ -154,7 +159,7 @@ func TestOSBErrorHandler(t *testing.T) {
 		handleOSBError(w, http.StatusInternalServerError, *err)
 	})
 
-	handler := requestIdentityLogHandler(testHandler)
+	handler := logHandler(testHandler)
 	handler.ServeHTTP(response, request)
 
 	assert.Equal(t, http.StatusInternalServerError, response.Result().StatusCode)
@@ -196,7 +201,7 @@ func TestCreateServiceHandler(t *testing.T) {
 				"parameter2": "foo"
 			},
 			"maintenance_info": {
-				"version": "2.1.1+abcdef"
+				"version": "1.0.0"
 			}
 		}`)
 
@@ -209,4 +214,44 @@ func TestCreateServiceHandler(t *testing.T) {
 	NewRouter(staticDir).ServeHTTP(response, request)
 
 	assert.Equal(t, http.StatusOK, response.Result().StatusCode)
+
+	instance, err := instanceStore.GetInstance(context.Background(), "abc")
+	assert.Nil(t, err)
+	assert.Equal(t, "cloudcontroller", instance.PlanID)
+	assert.Equal(t, "some-contextual-data", instance.Context["some_field"])
+
+	operations, err := instanceStore.ListOperations(context.Background(), "abc")
+	assert.Nil(t, err)
+	assert.Equal(t, store.OperationProvision, operations[len(operations)-1].Type)
+}
+
+func TestRepeatedProvision(t *testing.T) {
+	_, cleanup := useFakeFoundation(t)
+	defer cleanup()
+	gauge := metrics.Instances.WithLabelValues("cf-a", "cloudcontroller")
+	gauge.Set(0)
+	body := `{"service_id": "cf", "plan_id": "cloudcontroller", "context": {"platform": "cloudfoundry", "organization_guid": "org", "space_guid": "space"}, "parameters": {"size": 1}}`
+
+	assert.Equal(t, http.StatusOK, provisionWith(NewRouter(staticDir), "i1", body).Code)
+	assert.Equal(t, http.StatusCreated, sendBinding(http.MethodPut, "i1", "b1", `{}`).Code)
+	provisioned, _ := instanceStore.GetInstance(context.Background(), "i1")
+
+	assert.Equal(t, http.StatusOK, provisionWith(NewRouter(staticDir), "i1", body).Code, "identical request")
+	instance, _ := instanceStore.GetInstance(context.Background(), "i1")
+	assert.Equal(t, provisioned, instance)
+	assert.Equal(t, 1.0, testutil.ToFloat64(gauge), "the instance is counted once")
+	binding, err := instanceStore.GetBinding(context.Background(), "b1")
+	assert.NoError(t, err)
+	assert.Equal(t, "i1", binding.InstanceID)
+
+	conflicts := []string{
+		`{"service_id": "cf", "plan_id": "other", "context": {"platform": "cloudfoundry", "organization_guid": "org", "space_guid": "space"}, "parameters": {"size": 1}}`,
+		`{"service_id": "cf", "plan_id": "cloudcontroller", "context": {"platform": "cloudfoundry", "organization_guid": "org", "space_guid": "space"}, "parameters": {"size": 2}}`,
+		`{"service_id": "cf", "plan_id": "cloudcontroller", "context": {"platform": "cloudfoundry", "organization_guid": "org"}, "parameters": {"size": 1}}`,
+	}
+	for _, conflict := range conflicts {
+		assert.Equal(t, http.StatusConflict, provisionWith(NewRouter(staticDir), "i1", conflict).Code, conflict)
+	}
+	instance, _ = instanceStore.GetInstance(context.Background(), "i1")
+	assert.Equal(t, provisioned, instance, "conflicting requests leave the instance alone")
 }
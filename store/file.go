@@ -0,0 +1,156 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// fileData is the JSON document written by FileStore
+type fileData struct {
+	Instances  []*Instance     `json:"instances"`
+	Bindings   []*Binding      `json:"bindings"`
+	Operations []*Operation    `json:"operations"`
+	Cordons    map[string]bool `json:"cordons,omitempty"`
+}
+
+// FileStore keeps instances, bindings, operations and cordons in memory and writes a
+// JSON snapshot to a file after each change. The snapshot is replaced
+// atomically. It holds the client secrets of bindings in plain text and is
+// only readable by its owner, protect it like a credential store.
+type FileStore struct {
+	*MemoryStore
+	path  string
+	write sync.Mutex
+}
+
+// NewFileStore opens the store at path, creating the file if it does not
+// exist
+func NewFileStore(path string) (*FileStore, error) {
+	f := &FileStore{MemoryStore: NewMemoryStore(), path: path}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return f, f.save()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := fileData{}
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, err
+	}
+	for _, instance := range snapshot.Instances {
+		f.instances[instance.ID] = *instance
+	}
+	for _, binding := range snapshot.Bindings {
+		f.bindings[binding.ID] = *binding
+	}
+	for _, operation := range snapshot.Operations {
+		f.operations[operation.InstanceID] = append(f.operations[operation.InstanceID], *operation)
+	}
+	for foundation, cordoned := range snapshot.Cordons {
+		f.cordons[foundation] = cordoned
+	}
+	return f, nil
+}
+
+// Ping checks that the file is still accessible
+func (f *FileStore) Ping(ctx context.Context) error {
+	_, err := os.Stat(f.path)
+	return err
+}
+
+// PutInstance creates or replaces an instance
+func (f *FileStore) PutInstance(ctx context.Context, instance *Instance) error {
+	if err := f.MemoryStore.PutInstance(ctx, instance); err != nil {
+		return err
+	}
+	return f.save()
+}
+
+// DeleteInstance removes the instance with id
+func (f *FileStore) DeleteInstance(ctx context.Context, id string) error {
+	if err := f.MemoryStore.DeleteInstance(ctx, id); err != nil {
+		return err
+	}
+	return f.save()
+}
+
+// PutBinding creates or replaces a binding
+func (f *FileStore) PutBinding(ctx context.Context, binding *Binding) error {
+	if err := f.MemoryStore.PutBinding(ctx, binding); err != nil {
+		return err
+	}
+	return f.save()
+}
+
+// DeleteBinding removes the binding with id
+func (f *FileStore) DeleteBinding(ctx context.Context, id string) error {
+	if err := f.MemoryStore.DeleteBinding(ctx, id); err != nil {
+		return err
+	}
+	return f.save()
+}
+
+// PutOperation creates or replaces an operation
+func (f *FileStore) PutOperation(ctx context.Context, operation *Operation) error {
+	if err := f.MemoryStore.PutOperation(ctx, operation); err != nil {
+		return err
+	}
+	return f.save()
+}
+
+// PutCordon sets the cordon state of a foundation
+func (f *FileStore) PutCordon(ctx context.Context, foundation string, cordoned bool) error {
+	if err := f.MemoryStore.PutCordon(ctx, foundation, cordoned); err != nil {
+		return err
+	}
+	return f.save()
+}
+
+func (f *FileStore) save() error {
+	f.write.Lock()
+	defer f.write.Unlock()
+
+	snapshot := fileData{}
+	snapshot.Instances, _ = f.MemoryStore.ListInstances(context.Background())
+	snapshot.Bindings, _ = f.MemoryStore.ListBindings(context.Background())
+	snapshot.Cordons, _ = f.MemoryStore.ListCordons(context.Background())
+	f.mutex.RLock()
+	for _, operations := range f.operations {
+		for _, operation := range operations {
+			operation := operation
+			snapshot.Operations = append(snapshot.Operations, &operation)
+		}
+	}
+	f.mutex.RUnlock()
+
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(f.path), filepath.Base(f.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path)
+}
@@ -0,0 +1,52 @@
+package store
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.json")
+	s, err := NewFileStore(path)
+	assert.NoError(t, err)
+
+	testStore(t, s)
+
+	reopened, err := NewFileStore(path)
+	assert.NoError(t, err)
+	instance, err := reopened.GetInstance(context.Background(), "b")
+	assert.NoError(t, err)
+	assert.Equal(t, "cf-eu10", instance.Foundation)
+	_, err = reopened.GetBinding(context.Background(), "x")
+	assert.NoError(t, err)
+	operations, _ := reopened.ListOperations(context.Background(), "b")
+	assert.Len(t, operations, 2)
+	cordons, _ := reopened.ListCordons(context.Background())
+	assert.True(t, cordons["cf-eu10"], "cordons survive restarts")
+
+	files, _ := ioutil.ReadDir(filepath.Dir(path))
+	assert.Len(t, files, 1, "temporary snapshot files are removed")
+}
+
+func TestFileStorePing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.json")
+	s, err := NewFileStore(path)
+	assert.NoError(t, err)
+	assert.NoError(t, s.Ping(context.Background()))
+
+	os.Remove(path)
+	assert.Error(t, s.Ping(context.Background()))
+}
+
+func TestFileStoreCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.json")
+	ioutil.WriteFile(path, []byte("{"), 0600)
+
+	_, err := NewFileStore(path)
+	assert.Error(t, err)
+}
@@ -0,0 +1,191 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// MemoryStore keeps instances, bindings, operations and cordons in memory
+type MemoryStore struct {
+	mutex      sync.RWMutex
+	instances  map[string]Instance
+	bindings   map[string]Binding
+	operations map[string][]Operation
+	cordons    map[string]bool
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		instances:  map[string]Instance{},
+		bindings:   map[string]Binding{},
+		operations: map[string][]Operation{},
+		cordons:    map[string]bool{},
+	}
+}
+
+// Ping always succeeds
+func (m *MemoryStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+// GetInstance returns a copy of the instance with id
+func (m *MemoryStore) GetInstance(ctx context.Context, id string) (*Instance, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	instance, ok := m.instances[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &instance, nil
+}
+
+// PutInstance creates or replaces an instance
+func (m *MemoryStore) PutInstance(ctx context.Context, instance *Instance) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.instances[instance.ID] = *instance
+	return nil
+}
+
+// DeleteInstance removes the instance with id
+func (m *MemoryStore) DeleteInstance(ctx context.Context, id string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.instances[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.instances, id)
+	return nil
+}
+
+// ListInstances returns copies of all instances ordered by id
+func (m *MemoryStore) ListInstances(ctx context.Context) ([]*Instance, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	instances := make([]*Instance, 0, len(m.instances))
+	for _, instance := range m.instances {
+		instance := instance
+		instances = append(instances, &instance)
+	}
+	sort.Slice(instances, func(i, j int) bool { return instances[i].ID < instances[j].ID })
+	return instances, nil
+}
+
+// GetBinding returns a copy of the binding with id
+func (m *MemoryStore) GetBinding(ctx context.Context, id string) (*Binding, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	binding, ok := m.bindings[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &binding, nil
+}
+
+// PutBinding creates or replaces a binding
+func (m *MemoryStore) PutBinding(ctx context.Context, binding *Binding) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.bindings[binding.ID] = *binding
+	return nil
+}
+
+// DeleteBinding removes the binding with id
+func (m *MemoryStore) DeleteBinding(ctx context.Context, id string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.bindings[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.bindings, id)
+	return nil
+}
+
+// ListBindings returns copies of all bindings ordered by id
+func (m *MemoryStore) ListBindings(ctx context.Context) ([]*Binding, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	bindings := make([]*Binding, 0, len(m.bindings))
+	for _, binding := range m.bindings {
+		binding := binding
+		bindings = append(bindings, &binding)
+	}
+	sort.Slice(bindings, func(i, j int) bool { return bindings[i].ID < bindings[j].ID })
+	return bindings, nil
+}
+
+// GetOperation returns a copy of the operation with id of an instance
+func (m *MemoryStore) GetOperation(ctx context.Context, instanceID string, id string) (*Operation, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	for _, operation := range m.operations[instanceID] {
+		if operation.ID == id {
+			return &operation, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// PutOperation appends an operation to the history of its instance or
+// replaces the operation with the same id
+func (m *MemoryStore) PutOperation(ctx context.Context, operation *Operation) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	operations := m.operations[operation.InstanceID]
+	for i := range operations {
+		if operations[i].ID == operation.ID {
+			operations[i] = *operation
+			return nil
+		}
+	}
+	m.operations[operation.InstanceID] = append(operations, *operation)
+	return nil
+}
+
+// ListOperations returns copies of the operations of an instance, oldest
+// first
+func (m *MemoryStore) ListOperations(ctx context.Context, instanceID string) ([]*Operation, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	operations := make([]*Operation, 0, len(m.operations[instanceID]))
+	for _, operation := range m.operations[instanceID] {
+		operation := operation
+		operations = append(operations, &operation)
+	}
+	sort.SliceStable(operations, func(i, j int) bool { return operations[i].StartedAt.Before(operations[j].StartedAt) })
+	return operations, nil
+}
+
+// ListCordons returns a copy of the cordon state by foundation
+func (m *MemoryStore) ListCordons(ctx context.Context) (map[string]bool, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	cordons := make(map[string]bool, len(m.cordons))
+	for foundation, cordoned := range m.cordons {
+		cordons[foundation] = cordoned
+	}
+	return cordons, nil
+}
+
+// PutCordon sets the cordon state of a foundation
+func (m *MemoryStore) PutCordon(ctx context.Context, foundation string, cordoned bool) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.cordons[foundation] = cordoned
+	return nil
+}
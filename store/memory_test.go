@@ -0,0 +1,93 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testStore(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	assert.NoError(t, s.Ping(ctx))
+
+	_, err := s.GetInstance(ctx, "a")
+	assert.Equal(t, ErrNotFound, err)
+	assert.Equal(t, ErrNotFound, s.DeleteInstance(ctx, "a"))
+
+	assert.NoError(t, s.PutInstance(ctx, &Instance{ID: "b", PlanID: "plan", Foundation: "cf-eu10", State: StateSucceeded}))
+	assert.NoError(t, s.PutInstance(ctx, &Instance{ID: "a", PlanID: "plan", State: StateInProgress}))
+
+	instance, err := s.GetInstance(ctx, "b")
+	assert.NoError(t, err)
+	assert.Equal(t, "cf-eu10", instance.Foundation)
+
+	// returned instances are copies
+	instance.Foundation = "changed"
+	instance, _ = s.GetInstance(ctx, "b")
+	assert.Equal(t, "cf-eu10", instance.Foundation)
+
+	instances, err := s.ListInstances(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, instances, 2)
+	assert.Equal(t, "a", instances[0].ID)
+	assert.Equal(t, "b", instances[1].ID)
+
+	assert.NoError(t, s.DeleteInstance(ctx, "a"))
+	instances, _ = s.ListInstances(ctx)
+	assert.Len(t, instances, 1)
+
+	_, err = s.GetBinding(ctx, "x")
+	assert.Equal(t, ErrNotFound, err)
+	assert.Equal(t, ErrNotFound, s.DeleteBinding(ctx, "x"))
+
+	assert.NoError(t, s.PutBinding(ctx, &Binding{ID: "y", InstanceID: "b", State: StateSucceeded}))
+	assert.NoError(t, s.PutBinding(ctx, &Binding{ID: "x", InstanceID: "b", State: StateSucceeded}))
+	binding, err := s.GetBinding(ctx, "x")
+	assert.NoError(t, err)
+	assert.Equal(t, "b", binding.InstanceID)
+
+	bindings, err := s.ListBindings(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, bindings, 2)
+	assert.Equal(t, "x", bindings[0].ID)
+
+	assert.NoError(t, s.DeleteBinding(ctx, "y"))
+	bindings, _ = s.ListBindings(ctx)
+	assert.Len(t, bindings, 1)
+
+	now := time.Now()
+	assert.NoError(t, s.PutOperation(ctx, &Operation{ID: "2", InstanceID: "b", Type: OperationBind, State: StateInProgress, StartedAt: now}))
+	assert.NoError(t, s.PutOperation(ctx, &Operation{ID: "1", InstanceID: "b", Type: OperationProvision, State: StateSucceeded, StartedAt: now.Add(-time.Minute)}))
+	assert.NoError(t, s.PutOperation(ctx, &Operation{ID: "2", InstanceID: "b", Type: OperationBind, State: StateSucceeded, StartedAt: now}))
+
+	operations, err := s.ListOperations(ctx, "b")
+	assert.NoError(t, err)
+	assert.Len(t, operations, 2)
+	assert.Equal(t, OperationProvision, operations[0].Type)
+	assert.Equal(t, StateSucceeded, operations[1].State)
+
+	operation, err := s.GetOperation(ctx, "b", "2")
+	assert.NoError(t, err)
+	assert.Equal(t, OperationBind, operation.Type)
+	_, err = s.GetOperation(ctx, "a", "2")
+	assert.Equal(t, ErrNotFound, err)
+
+	operations, err = s.ListOperations(ctx, "unknown")
+	assert.NoError(t, err)
+	assert.Empty(t, operations)
+
+	cordons, err := s.ListCordons(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, cordons)
+	assert.NoError(t, s.PutCordon(ctx, "cf-eu10", true))
+	assert.NoError(t, s.PutCordon(ctx, "cf-us10", false))
+	cordons, _ = s.ListCordons(ctx)
+	assert.Equal(t, map[string]bool{"cf-eu10": true, "cf-us10": false}, cordons)
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
@@ -0,0 +1,150 @@
+// Package store persists service instances managed by the broker.
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const (
+	// StateInProgress marks instances with a running operation
+	StateInProgress string = "in progress"
+	// StateSucceeded marks instances whose last operation succeeded
+	StateSucceeded string = "succeeded"
+	// StateFailed marks instances whose last operation failed
+	StateFailed string = "failed"
+	// StateExpired marks bindings whose credentials expired and were revoked
+	StateExpired string = "expired"
+
+	// OperationProvision creates an instance
+	OperationProvision string = "provision"
+	// OperationUpdate changes an instance
+	OperationUpdate string = "update"
+	// OperationDeprovision deletes an instance
+	OperationDeprovision string = "deprovision"
+	// OperationBind creates a binding
+	OperationBind string = "bind"
+	// OperationUnbind deletes a binding
+	OperationUnbind string = "unbind"
+	// OperationMigrate moves an instance to another foundation
+	OperationMigrate string = "migrate"
+)
+
+// ErrNotFound is returned if an entry does not exist
+var ErrNotFound = errors.New("not found")
+
+// Instance is a provisioned service instance. Platform is the platform that
+// provisioned it, its context holds the platform specific details.
+// MaintenanceVersion is the maintenance version of its plan it runs with.
+// Metadata is returned to the platform with the instance.
+type Instance struct {
+	ID                 string                 `json:"id"`
+	ServiceID          string                 `json:"service_id"`
+	PlanID             string                 `json:"plan_id"`
+	Platform           string                 `json:"platform,omitempty"`
+	OrganizationGUID   string                 `json:"organization_guid,omitempty"`
+	OrganizationName   string                 `json:"organization_name,omitempty"`
+	SpaceGUID          string                 `json:"space_guid,omitempty"`
+	SpaceName          string                 `json:"space_name,omitempty"`
+	Context            map[string]interface{} `json:"context,omitempty"`
+	Parameters         map[string]interface{} `json:"parameters,omitempty"`
+	Foundation         string                 `json:"foundation,omitempty"`
+	MaintenanceVersion string                 `json:"maintenance_version,omitempty"`
+	Metadata           Metadata               `json:"metadata"`
+	State              string                 `json:"state"`
+	CreatedAt          time.Time              `json:"created_at"`
+	UpdatedAt          time.Time              `json:"updated_at"`
+}
+
+// Metadata are the labels and attributes of an instance
+type Metadata struct {
+	Labels     map[string]string `json:"labels,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// Binding is a service binding of an instance with the UAA client that
+// holds its credentials. RotationRequired is set when the credentials moved
+// and the platform should rotate the binding. PredecessorID references the
+// binding a rotated binding replaces. Role is the Cloud Foundry role granted
+// to the client, if any. SourceFoundation is the foundation a migrated
+// binding was placed on when the platform got its credentials, the client
+// there stays valid until the binding is unbound. RetiredClients hold the
+// credentials replaced by an upgrade, which also stay valid until the binding
+// is unbound. Credentials expire at ExpiresAt unless it is zero and should be
+// renewed after RenewBefore.
+type Binding struct {
+	ID               string                 `json:"id"`
+	InstanceID       string                 `json:"instance_id"`
+	PredecessorID    string                 `json:"predecessor_id,omitempty"`
+	Parameters       map[string]interface{} `json:"parameters,omitempty"`
+	ClientID         string                 `json:"client_id,omitempty"`
+	ClientSecret     string                 `json:"client_secret,omitempty"`
+	Role             string                 `json:"role,omitempty"`
+	Scopes           []string               `json:"scopes,omitempty"`
+	RotationRequired bool                   `json:"rotation_required,omitempty"`
+	SourceFoundation string                 `json:"source_foundation,omitempty"`
+	RetiredClients   []RetiredClient        `json:"retired_clients,omitempty"`
+	ExpiresAt        time.Time              `json:"expires_at"`
+	RenewBefore      time.Time              `json:"renew_before"`
+	State            string                 `json:"state"`
+	CreatedAt        time.Time              `json:"created_at"`
+	UpdatedAt        time.Time              `json:"updated_at"`
+}
+
+// RetiredClient is a UAA client with its role on a foundation that a binding
+// was issued before its credentials were replaced
+type RetiredClient struct {
+	ClientID   string `json:"client_id"`
+	Role       string `json:"role,omitempty"`
+	Foundation string `json:"foundation"`
+}
+
+// Expired reports whether the credentials of the binding expired at t
+func (b *Binding) Expired(t time.Time) bool {
+	return !b.ExpiresAt.IsZero() && !t.Before(b.ExpiresAt)
+}
+
+// Operation is an entry in the operation history of an instance. Target is
+// the foundation a migration moves the instance to, so that an interrupted
+// migration can be resumed.
+type Operation struct {
+	ID          string    `json:"id"`
+	InstanceID  string    `json:"instance_id"`
+	BindingID   string    `json:"binding_id,omitempty"`
+	Type        string    `json:"type"`
+	Target      string    `json:"target,omitempty"`
+	State       string    `json:"state"`
+	Description string    `json:"description,omitempty"`
+	Progress    int       `json:"progress"`
+	StartedAt   time.Time `json:"started_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Store keeps service instances, their bindings and operation history
+type Store interface {
+	// Ping checks that the store is reachable
+	Ping(ctx context.Context) error
+	GetInstance(ctx context.Context, id string) (*Instance, error)
+	PutInstance(ctx context.Context, instance *Instance) error
+	DeleteInstance(ctx context.Context, id string) error
+	// ListInstances returns all instances ordered by id
+	ListInstances(ctx context.Context) ([]*Instance, error)
+
+	GetBinding(ctx context.Context, id string) (*Binding, error)
+	PutBinding(ctx context.Context, binding *Binding) error
+	DeleteBinding(ctx context.Context, id string) error
+	// ListBindings returns all bindings ordered by id
+	ListBindings(ctx context.Context) ([]*Binding, error)
+
+	GetOperation(ctx context.Context, instanceID string, id string) (*Operation, error)
+	// PutOperation creates or replaces an operation
+	PutOperation(ctx context.Context, operation *Operation) error
+	// ListOperations returns the operations of an instance, oldest first
+	ListOperations(ctx context.Context, instanceID string) ([]*Operation, error)
+
+	// ListCordons returns the cordon state of foundations set through the
+	// admin API by foundation name
+	ListCordons(ctx context.Context) (map[string]bool, error)
+	PutCordon(ctx context.Context, foundation string, cordoned bool) error
+}
@@ -0,0 +1,17 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBindingExpired(t *testing.T) {
+	now := time.Now()
+
+	assert.False(t, (&Binding{}).Expired(now), "without expiry")
+	assert.False(t, (&Binding{ExpiresAt: now.Add(time.Second)}).Expired(now))
+	assert.True(t, (&Binding{ExpiresAt: now}).Expired(now))
+	assert.True(t, (&Binding{ExpiresAt: now.Add(-time.Second)}).Expired(now))
+}
@@ -0,0 +1,116 @@
+package store
+
+import (
+	"context"
+
+	"github.com/sklevenz/cf-api-broker/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// tracedStore records a span for each store operation
+type tracedStore struct {
+	store Store
+}
+
+// Traced wraps store so that each operation is traced
+func Traced(store Store) Store {
+	return &tracedStore{store: store}
+}
+
+func (t *tracedStore) Ping(ctx context.Context) error {
+	ctx, span := tracing.Start(ctx, "store.Ping")
+	err := t.store.Ping(ctx)
+	tracing.End(span, err)
+	return err
+}
+
+func (t *tracedStore) GetInstance(ctx context.Context, id string) (*Instance, error) {
+	ctx, span := tracing.Start(ctx, "store.GetInstance", attribute.String("instance_id", id))
+	instance, err := t.store.GetInstance(ctx, id)
+	tracing.End(span, err)
+	return instance, err
+}
+
+func (t *tracedStore) PutInstance(ctx context.Context, instance *Instance) error {
+	ctx, span := tracing.Start(ctx, "store.PutInstance", attribute.String("instance_id", instance.ID))
+	err := t.store.PutInstance(ctx, instance)
+	tracing.End(span, err)
+	return err
+}
+
+func (t *tracedStore) DeleteInstance(ctx context.Context, id string) error {
+	ctx, span := tracing.Start(ctx, "store.DeleteInstance", attribute.String("instance_id", id))
+	err := t.store.DeleteInstance(ctx, id)
+	tracing.End(span, err)
+	return err
+}
+
+func (t *tracedStore) ListInstances(ctx context.Context) ([]*Instance, error) {
+	ctx, span := tracing.Start(ctx, "store.ListInstances")
+	instances, err := t.store.ListInstances(ctx)
+	tracing.End(span, err)
+	return instances, err
+}
+
+func (t *tracedStore) GetBinding(ctx context.Context, id string) (*Binding, error) {
+	ctx, span := tracing.Start(ctx, "store.GetBinding", attribute.String("binding_id", id))
+	binding, err := t.store.GetBinding(ctx, id)
+	tracing.End(span, err)
+	return binding, err
+}
+
+func (t *tracedStore) PutBinding(ctx context.Context, binding *Binding) error {
+	ctx, span := tracing.Start(ctx, "store.PutBinding", attribute.String("binding_id", binding.ID))
+	err := t.store.PutBinding(ctx, binding)
+	tracing.End(span, err)
+	return err
+}
+
+func (t *tracedStore) DeleteBinding(ctx context.Context, id string) error {
+	ctx, span := tracing.Start(ctx, "store.DeleteBinding", attribute.String("binding_id", id))
+	err := t.store.DeleteBinding(ctx, id)
+	tracing.End(span, err)
+	return err
+}
+
+func (t *tracedStore) ListBindings(ctx context.Context) ([]*Binding, error) {
+	ctx, span := tracing.Start(ctx, "store.ListBindings")
+	bindings, err := t.store.ListBindings(ctx)
+	tracing.End(span, err)
+	return bindings, err
+}
+
+func (t *tracedStore) GetOperation(ctx context.Context, instanceID string, id string) (*Operation, error) {
+	ctx, span := tracing.Start(ctx, "store.GetOperation", attribute.String("instance_id", instanceID))
+	operation, err := t.store.GetOperation(ctx, instanceID, id)
+	tracing.End(span, err)
+	return operation, err
+}
+
+func (t *tracedStore) PutOperation(ctx context.Context, operation *Operation) error {
+	ctx, span := tracing.Start(ctx, "store.PutOperation", attribute.String("instance_id", operation.InstanceID))
+	err := t.store.PutOperation(ctx, operation)
+	tracing.End(span, err)
+	return err
+}
+
+func (t *tracedStore) ListOperations(ctx context.Context, instanceID string) ([]*Operation, error) {
+	ctx, span := tracing.Start(ctx, "store.ListOperations", attribute.String("instance_id", instanceID))
+	operations, err := t.store.ListOperations(ctx, instanceID)
+	tracing.End(span, err)
+	return operations, err
+}
+
+func (t *tracedStore) ListCordons(ctx context.Context) (map[string]bool, error) {
+	ctx, span := tracing.Start(ctx, "store.ListCordons")
+	cordons, err := t.store.ListCordons(ctx)
+	tracing.End(span, err)
+	return cordons, err
+}
+
+func (t *tracedStore) PutCordon(ctx context.Context, foundation string, cordoned bool) error {
+	ctx, span := tracing.Start(ctx, "store.PutCordon", attribute.String("foundation", foundation))
+	err := t.store.PutCordon(ctx, foundation, cordoned)
+	tracing.End(span, err)
+	return err
+}
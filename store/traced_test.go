@@ -0,0 +1,24 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sklevenz/cf-api-broker/tracing"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracedStore(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	defer tracing.SetupWithExporter(exporter)(context.Background())
+
+	s := Traced(NewMemoryStore())
+	testStore(t, s)
+
+	spans := exporter.GetSpans()
+	assert.Equal(t, "store.Ping", spans[0].Name)
+	assert.Equal(t, "store.GetInstance", spans[1].Name)
+	assert.Equal(t, codes.Error, spans[1].StatusCode)
+}
@@ -0,0 +1,119 @@
+// Package tracing sets up OpenTelemetry tracing. Spans are exported via
+// OTLP/HTTP and W3C trace context is propagated to and from other services.
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlphttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/semconv"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	serviceName       string = "cf-api-broker"
+	instrumentationID string = "github.com/sklevenz/cf-api-broker"
+)
+
+// Options configure the OTLP/HTTP export of spans
+type Options struct {
+	// Endpoint is host and port of the OTLP/HTTP receiver
+	Endpoint string
+	// Insecure disables TLS towards the receiver
+	Insecure bool
+	// SampleRatio is the fraction of new traces sampled, traces started by
+	// a caller follow the caller's sampling decision
+	SampleRatio float64
+	// ServiceVersion is reported as service.version resource attribute
+	ServiceVersion string
+}
+
+func init() {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+}
+
+// Setup installs a tracer provider exporting spans in batches via OTLP/HTTP
+// and returns a function flushing and shutting down the export
+func Setup(ctx context.Context, options Options) (func(context.Context) error, error) {
+	driverOptions := []otlphttp.Option{otlphttp.WithEndpoint(options.Endpoint)}
+	if options.Insecure {
+		driverOptions = append(driverOptions, otlphttp.WithInsecure())
+	}
+
+	exporter, err := otlp.NewExporter(ctx, otlphttp.NewDriver(driverOptions...))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(options.SampleRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.ServiceNameKey.String(serviceName),
+			semconv.ServiceVersionKey.String(options.ServiceVersion),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// SetupWithExporter installs a tracer provider sampling all traces and
+// exporting spans synchronously, e.g. to an in-memory exporter in tests
+func SetupWithExporter(exporter sdktrace.SpanExporter) func(context.Context) error {
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithSyncer(exporter),
+		sdktrace.WithSampler(sdktrace.AlwaysSample()),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown
+}
+
+// Start starts a span as child of the span in ctx, e.g. around store
+// operations. The span must be finished with End.
+func Start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationID).Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// StartServer starts a server span for an incoming request continuing the
+// trace of the caller given by the traceparent header
+func StartServer(r *http.Request, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	return otel.Tracer(instrumentationID).Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(attributes...))
+}
+
+// End records err on span and ends it
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Transport wraps base so each outbound request is traced in a client span
+// and carries the trace context in its traceparent header
+func Transport(base http.RoundTripper) http.RoundTripper {
+	return otelhttp.NewTransport(base)
+}
+
+// TraceID returns the trace id of the span in ctx or an empty string
+func TraceID(ctx context.Context) string {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.IsValid() {
+		return ""
+	}
+	return spanContext.TraceID().String()
+}
@@ -0,0 +1,73 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestStartAndEnd(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	defer SetupWithExporter(exporter)(context.Background())
+
+	ctx, parent := Start(context.Background(), "parent")
+	_, child := Start(ctx, "store.get")
+	End(child, errors.New("not found"))
+	End(parent, nil)
+
+	spans := exporter.GetSpans()
+	assert.Len(t, spans, 2)
+	assert.Equal(t, "store.get", spans[0].Name)
+	assert.Equal(t, codes.Error, spans[0].StatusCode)
+	assert.Equal(t, spans[1].SpanContext.SpanID(), spans[0].Parent.SpanID())
+	assert.Equal(t, TraceID(ctx), spans[0].SpanContext.TraceID().String())
+}
+
+func TestTransportPropagatesTraceContext(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	defer SetupWithExporter(exporter)(context.Background())
+
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+	}))
+	defer server.Close()
+
+	ctx, span := Start(context.Background(), "provision")
+	request, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	response, err := (&http.Client{Transport: Transport(nil)}).Do(request)
+	assert.Nil(t, err)
+	response.Body.Close()
+	End(span, nil)
+
+	assert.Contains(t, traceparent, TraceID(ctx))
+
+	spans := exporter.GetSpans()
+	assert.Len(t, spans, 2)
+	assert.Equal(t, trace.SpanKindClient, spans[0].SpanKind)
+	assert.Equal(t, span.SpanContext().SpanID(), spans[0].Parent.SpanID())
+}
+
+func TestStartServerContinuesTrace(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	defer SetupWithExporter(exporter)(context.Background())
+
+	request, _ := http.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	ctx, span := StartServer(request, "v2.catalog")
+	End(span, nil)
+
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", TraceID(ctx))
+	spans := exporter.GetSpans()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, "00f067aa0ba902b7", spans[0].Parent.SpanID().String())
+	assert.True(t, spans[0].Parent.IsRemote())
+}